@@ -0,0 +1,102 @@
+package b3app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cachedAnalysis is the extraction of a version of a file, cached so that the file is not read again.
+//
+// Only the model output is cached: the document type rules are applied again on every use.
+type cachedAnalysis struct {
+	Key        string      `json:"key"` // See analysisKey.
+	MD5        string      `json:"md5"` // Checksum of the content analyzed.
+	Analyzed   time.Time   `json:"analyzed"`
+	Extraction *Extraction `json:"extraction"`
+	Warnings   []string    `json:"warnings,omitempty"` // Raised while decoding the extraction.
+}
+
+// analysisKey identifies an analysis of a content: its checksum, the pages read, the extraction prompt and the reader model.
+// Any change of the prompt, including the taxonomy or the language it contains, invalidates the cache.
+func (a *App) analysisKey(md5, pages string) string {
+	h := sha256.New()
+	for _, s := range []string{md5, pages, extractionPromptVersion, a.Config.Expert(ExpertReader).Model, a.extractionInstruction()} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// analysisPath returns the path to the cached analysis of the pages of a file, like "<id>@3-5.json",
+// or of the whole file if pages is empty.
+// There is only one per file and pages: analyzing a new version replaces it.
+func analysisPath(fileID, pages string) (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	name := fileID
+	if pages != "" {
+		name += "@" + pages
+	}
+	return filepath.Join(dir, "analyses", name+".json"), nil
+}
+
+// loadAnalysis returns the cached analysis of a file for key, or nil if there is none.
+// Errors are ignored: the file is then analyzed again.
+func loadAnalysis(fileID, pages, key string) *cachedAnalysis {
+	path, err := analysisPath(fileID, pages)
+	if err != nil {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	c := &cachedAnalysis{}
+	if err := json.Unmarshal(data, c); err != nil || c.Key != key || c.Extraction == nil {
+		return nil
+	}
+	return c
+}
+
+// storeAnalysis caches the analysis of the pages of a file.
+func storeAnalysis(fileID, pages string, c *cachedAnalysis) error {
+	path, err := analysisPath(fileID, pages)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode analysis: %w", err)
+	}
+	if err := writePrivateFile(path, data); err != nil {
+		return fmt.Errorf("failed to write analysis: %w", err)
+	}
+	return nil
+}
+
+// forgetAnalysis deletes the cached analyses of a file, whole or by pages, if any.
+func forgetAnalysis(fileID string) error {
+	path, err := analysisPath(fileID, "")
+	if err != nil {
+		return err
+	}
+	excerpts, err := filepath.Glob(strings.TrimSuffix(path, ".json") + "@*.json")
+	if err != nil {
+		return fmt.Errorf("failed to list analyses: %w", err)
+	}
+	for _, p := range append(excerpts, path) {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to delete analysis: %w", err)
+		}
+	}
+	return nil
+}
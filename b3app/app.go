@@ -3,6 +3,7 @@ package b3app
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"google.golang.org/api/drive/v3"
 	"google.golang.org/api/option"
@@ -12,12 +13,47 @@ import (
 // Google Drive service client.
 type App struct {
 	DriveService *drive.Service
+	// Scope is the set of Drive permissions granted at login.
+	Scope ScopeMode
+	// Config is the user configuration.
+	Config *Config
+	// Offline is true when the App works from the local index only, see NewOffline.
+	Offline bool
+	// DriveID is the ID of the shared drive holding the vault, empty for the user's own Drive.
+	DriveID string
+
+	// SessionChanges are the changes in the vault since the last session,
+	// known after the first call to Sync.
+	SessionChanges *IndexChanges
+
+	mu        sync.Mutex
+	folderIDs map[string]string // Vault folder IDs resolved during this session, by role.
+
+	indexMu sync.Mutex
+	index   *Index
+
+	searchMu    sync.Mutex
+	searchIndex *SearchIndex // Inverted index of the last search.
+	searchKey   string       // searchKey of the files searchIndex was built from.
+
+	files   fileLister   // Lists the files of the vault, Drive if nil.
+	changes changeLister // Lists the changes of the vault, Drive if nil.
 }
 
 // New creates and returns a new, fully initialized App instance.
 // It handles the authentication flow to get a valid Google API client.
-func New(ctx context.Context) (*App, error) {
-	httpClient, err := getClient()
+// If cfg is nil, the configuration is loaded from the default location.
+func New(ctx context.Context, cfg *Config) (*App, error) {
+	if cfg == nil {
+		var err error
+		if cfg, err = LoadConfig(""); err != nil {
+			return nil, err
+		}
+	} else if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	httpClient, scope, err := getClient(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("could not get authenticated client: %w", err)
 	}
@@ -27,5 +63,11 @@ func New(ctx context.Context) (*App, error) {
 		return nil, fmt.Errorf("could not create drive service: %w", err)
 	}
 
-	return &App{DriveService: driveService}, nil
+	app := &App{DriveService: driveService, Scope: scope, Config: cfg}
+	if cfg.Vault.SharedDrive != "" {
+		if app.DriveID, err = app.findSharedDrive(ctx, cfg.Vault.SharedDrive); err != nil {
+			return nil, err
+		}
+	}
+	return app, nil
 }
@@ -0,0 +1,35 @@
+package b3app
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestApp returns an offline App with the default configuration, and an index of the files,
+// whose local state lives in a temporary directory.
+func newTestApp(t testing.TB, files ...IndexFile) *App {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	idx := &Index{
+		Version: indexVersion, B3FolderID: "b3", B4FolderID: "b4",
+		Folders: map[string]IndexFolder{}, Files: map[string]IndexFile{},
+	}
+	for _, f := range files {
+		idx.Files[f.ID] = f
+	}
+	return &App{Config: DefaultConfig(), Offline: true, index: idx}
+}
+
+// testFile returns a file of the index, in the folder of ID parent, like "b3".
+func testFile(parent, id, name string, m *Metadata) IndexFile {
+	return IndexFile{
+		File: File{
+			ID: id, Name: name, MimeType: "application/pdf", MD5Checksum: "md5-" + id,
+			Created: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Modified: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			Description: "A document.", Metadata: m,
+		},
+		Parent: parent,
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/pkg/browser"
 	"golang.org/x/oauth2"
@@ -16,18 +17,72 @@ import (
 	"google.golang.org/api/drive/v3"
 )
 
-// TODO: Replace with your actual client ID and secret from Google Cloud Console.
-// These credentials should be for a "Desktop app" OAuth 2.0 client ID.
-var googleOauthConfig = &oauth2.Config{
-	ClientID:     "999716078375-50cl3182oudsaom3sfhogg0k57m714c5.apps.googleusercontent.com",
-	ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
-	RedirectURL:  "http://localhost:8080",
-	Scopes:       []string{drive.DriveScope},
-	Endpoint:     google.Endpoint,
+// oauthConfig returns the OAuth 2.0 configuration for the client described in cfg,
+// requesting the permissions of mode.
+//
+// The client should be a "Desktop app" OAuth 2.0 client ID; its secret is read
+// from the GOOGLE_CLIENT_SECRET environment variable.
+func oauthConfig(cfg *Config, mode ScopeMode) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     cfg.Auth.ClientID,
+		ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
+		RedirectURL:  cfg.Auth.RedirectURL,
+		Scopes:       mode.scopes(),
+		Endpoint:     google.Endpoint,
+	}
+}
+
+// ScopeMode selects the set of Google Drive permissions requested by B3.
+type ScopeMode string
+
+const (
+	// ScopeFull grants B3 access to the whole Google Drive (drive scope).
+	// This is the default, and the only mode where B3 can see documents the
+	// user uploaded through other apps.
+	ScopeFull ScopeMode = "full"
+	// ScopeFile restricts B3 to the files it created or that the user
+	// explicitly opened with it (drive.file scope).
+	ScopeFile ScopeMode = "file"
+)
+
+// ParseScopeMode converts a user provided string into a ScopeMode.
+func ParseScopeMode(s string) (ScopeMode, error) {
+	switch m := ScopeMode(strings.ToLower(strings.TrimSpace(s))); m {
+	case "":
+		return ScopeFull, nil
+	case ScopeFull, ScopeFile:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown scope mode %q, expected %q or %q", s, ScopeFull, ScopeFile)
+	}
+}
+
+// scopes returns the OAuth scopes to request for this mode.
+func (m ScopeMode) scopes() []string {
+	if m == ScopeFile {
+		return []string{drive.DriveFileScope}
+	}
+	return []string{drive.DriveScope}
+}
+
+// Limitations describes, in plain words, the operations that are unavailable
+// or degraded in this mode. It is empty for ScopeFull.
+func (m ScopeMode) Limitations() []string {
+	if m != ScopeFile {
+		return nil
+	}
+	return []string{
+		"Only files created by B3 (downloads, merges, generated docs) or explicitly opened with B3 are visible; documents uploaded with other apps into B3/B4 are not listed.",
+		"Reading, updating, archiving or deleting a file B3 did not create fails with 'not found'.",
+		"B3 and B4 folders are created by B3 itself if it cannot see existing ones.",
+	}
 }
 
 // Login initiates the OAuth 2.0 flow to get and store a user token.
-func Login() error {
+// The token grants the permissions described by mode.
+func Login(cfg *Config, mode ScopeMode) error {
+	googleOauthConfig := oauthConfig(cfg, mode)
+
 	// Create a random state string for CSRF protection.
 	stateBytes := make([]byte, 16)
 	if _, err := rand.Read(stateBytes); err != nil {
@@ -95,69 +150,105 @@ func Login() error {
 		return fmt.Errorf("failed to exchange authorization code for token: %w", err)
 	}
 
-	return saveToken(tok)
+	if err := saveToken(tok); err != nil {
+		return err
+	}
+	return saveScopeMode(mode)
 }
 
 // getTokenPath returns the path to the token file.
 func getTokenPath() (string, error) {
-	configDir, err := os.UserConfigDir()
+	dir, err := configDir()
 	if err != nil {
-		return "", fmt.Errorf("failed to get user config directory: %w", err)
+		return "", err
 	}
-	return filepath.Join(configDir, "b3", "token.json"), nil
+	return filepath.Join(dir, "token.json"), nil
 }
 
-// saveToken saves a token to a file.
-func saveToken(token *oauth2.Token) error {
+// getScopePath returns the path to the file recording the granted scope mode.
+func getScopePath() (string, error) {
 	tokenPath, err := getTokenPath()
 	if err != nil {
-		return fmt.Errorf("failed to determine token path: %w", err)
+		return "", err
 	}
+	return filepath.Join(filepath.Dir(tokenPath), "scope"), nil
+}
 
-	// Ensure the directory exists.
-	if err := os.MkdirAll(filepath.Dir(tokenPath), 0700); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
+// saveScopeMode records the scope mode granted during login.
+func saveScopeMode(mode ScopeMode) error {
+	scopePath, err := getScopePath()
+	if err != nil {
+		return fmt.Errorf("failed to determine scope path: %w", err)
 	}
+	if err := writePrivateFile(scopePath, []byte(mode)); err != nil {
+		return fmt.Errorf("failed to save scope mode: %w", err)
+	}
+	return nil
+}
 
-	// Open the file with secure permissions (read/write for user only).
-	f, err := os.OpenFile(tokenPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+// loadScopeMode returns the scope mode granted during login.
+// Tokens obtained before scope modes existed were always full scope.
+func loadScopeMode() (ScopeMode, error) {
+	scopePath, err := getScopePath()
 	if err != nil {
-		return fmt.Errorf("unable to cache oauth token: %w", err)
+		return "", fmt.Errorf("failed to determine scope path: %w", err)
 	}
-	defer f.Close()
+	data, err := os.ReadFile(scopePath)
+	if os.IsNotExist(err) {
+		return ScopeFull, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read scope mode: %w", err)
+	}
+	return ParseScopeMode(string(data))
+}
 
-	// Encode the token as JSON and write to the file.
-	if err := json.NewEncoder(f).Encode(token); err != nil {
-		return fmt.Errorf("failed to encode token to file: %w", err)
+// saveToken saves a token to a file.
+func saveToken(token *oauth2.Token) error {
+	tokenPath, err := getTokenPath()
+	if err != nil {
+		return fmt.Errorf("failed to determine token path: %w", err)
 	}
 
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to encode token: %w", err)
+	}
+	if err := writePrivateFile(tokenPath, data); err != nil {
+		return fmt.Errorf("unable to cache oauth token: %w", err)
+	}
 	return nil
 }
 
 // getClient uses a stored token to configure an HTTP client.
-func getClient() (*http.Client, error) {
+// It also returns the scope mode that was granted to that token.
+func getClient(cfg *Config) (*http.Client, ScopeMode, error) {
 	tokenPath, err := getTokenPath()
 	if err != nil {
-		return nil, fmt.Errorf("failed to determine token path: %w", err)
+		return nil, "", fmt.Errorf("failed to determine token path: %w", err)
+	}
+	mode, err := loadScopeMode()
+	if err != nil {
+		return nil, "", err
 	}
 
 	f, err := os.Open(tokenPath)
 	if err != nil {
 		// If the file doesn't exist, the user needs to log in.
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("not logged in. Please run 'b3 login' to authorize the application")
+			return nil, "", fmt.Errorf("not logged in. Please run 'b3 login' to authorize the application")
 		}
-		return nil, fmt.Errorf("failed to open token file: %w", err)
+		return nil, "", fmt.Errorf("failed to open token file: %w", err)
 	}
 	defer f.Close()
 
 	tok := &oauth2.Token{}
 	if err := json.NewDecoder(f).Decode(tok); err != nil {
 		if err == io.EOF {
-			return nil, fmt.Errorf("token file is empty. Please run 'b3 login' again")
+			return nil, "", fmt.Errorf("token file is empty. Please run 'b3 login' again")
 		}
-		return nil, fmt.Errorf("failed to decode token from file: %w", err)
+		return nil, "", fmt.Errorf("failed to decode token from file: %w", err)
 	}
 
-	return googleOauthConfig.Client(context.Background(), tok), nil
+	return oauthConfig(cfg, mode).Client(context.Background(), tok), mode, nil
 }
@@ -1,8 +1,10 @@
 package b3app
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"log"
+	"slices"
 
 	"github.com/etnz/b3/expert"
 	"google.golang.org/genai"
@@ -10,16 +12,18 @@ import (
 
 // NewB3Expert creates and configures an Expert specifically for the B3 application.
 // This expert knows how to interact with the Google Drive files via the App dependency.
-func NewB3Expert(app *App, b3Files, b4Files []File) *expert.Expert {
+//
+// Its system prompt carries a compact summary of the vault, refreshed after each call of a tool changing it;
+// the details are fetched on demand with the tools.
+func NewB3Expert(app *App) *expert.Expert {
 	// Define the functions (tools) the B3 expert can use.
 
-	// creates the B3 Expert (this one doesn't need, yet, a strong description, it will not be called)
-	expert := expert.NewExpert("B3",
-		"A personal data assistant for Google Drive.",
-		NewAdminExpert(),
+	allTools := []expert.Tool{
+		NewAdminExpert(app.Config),
 		NewB3FilesTool(app),
 		NewB4FilesTool(app),
 		NewReadFileTool(app),
+		NewReadTextTool(app),
 		NewB4MergeTool(app),
 		NewDownloadToB4Tool(app),
 		NewCreateDocTool(app),
@@ -27,12 +31,48 @@ func NewB3Expert(app *App, b3Files, b4Files []File) *expert.Expert {
 		NewFillFormTool(app),
 		NewB4DeleteTool(app),
 		NewUpdateFileTool(app),
-	)
+		NewSearchFilesTool(app),
+		NewFindRelevantDocumentsTool(app),
+		NewQueryFilesTool(app),
+		NewCheckConsistencyTool(app),
+	}
+	var exp *expert.Expert
+	var prompt string
+	// refresh updates the system prompt with the current state of the vault.
+	// The chat keeps a pointer to the expert Config, so that the next message uses it.
+	refresh := func(ctx context.Context) {
+		if _, err := app.Sync(ctx); err != nil {
+			log.Printf("warning: could not synchronize the vault, its summary may be outdated: %v", err)
+		}
+		exp.Config.SystemInstruction = &genai.Content{Parts: []*genai.Part{
+			{Text: prompt + b3VaultPrompt(app)},
+		}}
+	}
 
-	b3FilesJSON, _ := json.MarshalIndent(b3Files, "", "  ")
-	b4FilesJSON, _ := json.MarshalIndent(b4Files, "", "  ")
+	// Only keep the tools enabled in the configuration, and offline, the read-only ones.
+	var tools []expert.Tool
+	for _, t := range allTools {
+		name := t.Declare().Name
+		check, offline := offlineTools[name]
+		if !app.Config.ToolEnabled(name) || (app.Offline && !offline) {
+			continue
+		}
+		if app.Offline && check != nil {
+			t = &offlineTool{Tool: t, app: app, check: check}
+		}
+		if mutatingTools[name] {
+			t = &refreshingTool{Tool: t, refresh: refresh}
+		}
+		tools = append(tools, t)
+	}
 
-	systemPrompt := fmt.Sprintf(`
+	// creates the B3 Expert (this one doesn't need, yet, a strong description, it will not be called)
+	exp = expert.NewExpert("B3",
+		"A personal data assistant for Google Drive.",
+		tools...,
+	)
+
+	prompt = fmt.Sprintf(`
 You are **B3**, the Bureaucratic Barrier Buster (B3). You are a precise, proactive, and meticulous personal data assistant. You live in the user's terminal and are the sole guardian of their most sensitive data.
 
 * **Your Name:** B3, a pun on "be free." Your mission is to help the user conquer bureaucracy.
@@ -51,7 +91,7 @@ When listing files in the B3 folder:
   * for poorly named files or the ones with no or problematic description, 
     * read the source file
     * extract all critical data (names, dates, IDs, addresses), 
-	* and use your tools to **update their descriptions**.
+	* and use your tools to **update their descriptions** and their structured **metadata** (document type, holder, issuer, dates, identifiers, address, amounts, language).
   * Proactively look for what's missing. If you see a car registration but there are no insurance policy number, or you see references to a spouse but don't have their ID, **ask the user to provide the missing information or document.**
 
 Based on the user request, figure out if you need information or context about an ongoing procedure if that is the case 
@@ -83,34 +123,116 @@ Help the user keep the ball rolling providing next steps until completion.
 When a procedure appears to be completed and have generated new document (contract, receipt, etc.) propose to
 archive those documents into B3.
 
+To gather the documents a procedure requires, use the FindRelevantDocuments tool for each requirement
+(like "something that proves where I live"), then read the candidates to confirm they fit.
+
 Usually a process started in B4 end up with one or more docs that need to be archived in the B3 folder. 
 When asked to archive a document, read it carefully, along with the surrounding files to figure out the whole context, and update the file name, and description and use the 'archive' option to perform the operation
 
+Name and file documents according to their type:
+%s%s`, app.Config.taxonomyInstruction(), app.Config.languageInstruction())
+
+	exp.ModelName = app.Config.Expert(ExpertB3).Model
+	exp.Config = app.Config.GenerateContentConfig(ExpertB3)
+	exp.Config.SystemInstruction = &genai.Content{Parts: []*genai.Part{
+		{Text: prompt + b3VaultPrompt(app)},
+	}}
+	return exp
+}
+
+// b3VaultPrompt returns the part of the B3 system prompt describing the current state of the vault.
+func b3VaultPrompt(app *App) string {
+	p := `
 ---
-CURRENT FILE INDEX:
-This is the current list of files available to you. Use this as your primary source of truth.
-If you modify a file or the user mentions adding one, you should use the B3Files or B4Files tools to get a fresh list.
-
-B3 Files:
-%s
-
-B4 Files:
-%s
-`, string(b3FilesJSON), string(b4FilesJSON))
-
-	expert.ModelName = "gemini-2.5-pro"
-	expert.Config = &genai.GenerateContentConfig{
-		SystemInstruction: &genai.Content{Parts: []*genai.Part{
-			{Text: systemPrompt},
-		}},
+VAULT SUMMARY:
+This summary is kept up to date, but does not list all files: fetch the details on demand.
+To find a specific document, prefer the SearchFiles tool, or QueryFiles to filter on dates, types or metadata.
+Use the B3Files or B4Files tools to get the full list of files with their descriptions.
+To copy an identifier or an amount exactly as printed, ReadText returns the raw text of a PDF instantly; ReadFile analyzes a document in depth.
+Before filling a form with personal details, CheckConsistency tells which documents disagree on them.
+
+` + app.VaultSummary()
+
+	if app.Offline {
+		p += fmt.Sprintf(`
+OFFLINE MODE:
+You have no access to Google Drive. The file index was %s and may be outdated:
+say so when it matters. You can only read files the user pinned for offline use, and cannot modify anything.
+`, app.Staleness())
+	}
+
+	p += expirationsPrompt(app)
+
+	if !app.SessionChanges.Empty() {
+		p += `
+CHANGES SINCE THE LAST SESSION:
+These files were added, modified, moved or removed since the user last talked to you.
+Mention them briefly and check the new or modified ones.
+`
+		for _, c := range []struct {
+			verb  string
+			files []File
+		}{{"added", app.SessionChanges.Added}, {"modified", app.SessionChanges.Modified}, {"moved", app.SessionChanges.Moved}, {"removed", app.SessionChanges.Removed}} {
+			for _, f := range c.files {
+				p += fmt.Sprintf("  * %s: %s/%s (ID %s)\n", c.verb, f.Path, f.Name, f.ID)
+			}
+		}
 	}
-	return expert
+	return p
+}
+
+// offlineTools are the tools that can work without access to Google Drive, with the check telling
+// whether a call can, or nil if they always can.
+var offlineTools = map[string]func(app *App, args map[string]any) error{
+	"Admin":                 nil,
+	"B3Files":               nil,
+	"B4Files":               nil,
+	"ReadFile":              pinnedOffline,
+	"ReadText":              pinnedOffline,
+	"CheckConsistency":      nil,
+	"SearchFiles":           nil,
+	"FindRelevantDocuments": embedderOffline,
+}
+
+// pinnedOffline checks that the file to read has a local copy.
+func pinnedOffline(app *App, args map[string]any) error {
+	fileID, _ := args["file_id"].(string)
+	pinned, err := Pinned()
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(pinned, fileID) {
+		return fmt.Errorf("%w, and file %s has no local copy (pin it with 'b3 pin %s' while online)", ErrOffline, fileID, fileID)
+	}
+	return nil
+}
+
+// embedderOffline checks that the embedder works without network: only the hash embedder does.
+func embedderOffline(app *App, args map[string]any) error {
+	if app.Config.Embeddings.Embedder != EmbedderHash {
+		return fmt.Errorf("B3 is offline, and the %s embedder needs the network: set embeddings.embedder to %s to find documents offline", app.Config.Embeddings.Embedder, EmbedderHash)
+	}
+	return nil
+}
+
+// offlineTool wraps a tool that only works offline for some calls, so that the others fail before trying.
+type offlineTool struct {
+	expert.Tool
+	app   *App
+	check func(app *App, args map[string]any) error
+}
+
+func (t *offlineTool) Call(ctx context.Context, args map[string]any) genai.FunctionResponse {
+	if err := t.check(t.app, args); err != nil {
+		return genai.FunctionResponse{Response: map[string]any{"error": err.Error()}}
+	}
+	return t.Tool.Call(ctx, args)
 }
 
 // NewAdminExpert creates an expert knowledgeable in administrative procedures.
 // This expert uses Google Search to devise plans for tasks like registering with
 // government agencies and can outline the necessary steps and documents.
-func NewAdminExpert() *expert.Expert {
+func NewAdminExpert(cfg *Config) *expert.Expert {
 	exp := expert.NewExpert("Admin",
 		`
 Your primary consultant for navigating bureaucracy.
@@ -125,13 +247,13 @@ Delegate any administrative task to this expert to receive a precise, actionable
 
 The expert maintains the context of the conversation, allowing for follow-up questions to clarify details of the plan.
 `)
-	exp.ModelName = "gemini-2.5-pro" // A powerful model for reasoning and planning
-	exp.Config = &genai.GenerateContentConfig{
-		Tools: []*genai.Tool{
-			{GoogleSearch: &genai.GoogleSearch{}},
-		},
-		SystemInstruction: &genai.Content{Parts: []*genai.Part{
-			{Text: `
+	exp.ModelName = cfg.Expert(ExpertAdmin).Model
+	exp.Config = cfg.GenerateContentConfig(ExpertAdmin)
+	exp.Config.Tools = []*genai.Tool{
+		{GoogleSearch: &genai.GoogleSearch{}},
+	}
+	exp.Config.SystemInstruction = &genai.Content{Parts: []*genai.Part{
+		{Text: `
 You are a world-class administrative expert. Your sole purpose is to provide users with clear, actionable, and trustworthy plans to navigate bureaucracy. You are precise, thorough, and always prioritize official sources.
 
 ### Your Mission
@@ -153,8 +275,7 @@ For any user request (e.g., "how do I get a passport?"), you must follow this ex
 * **Official Sources Only:** Your credibility depends on the quality of your sources. Always base your plan on official government or agency websites.
 * **No Ambiguity:** Be explicit. Clearly state document names, form numbers, and provide direct URLs.
 * **Assume Nothing:** The user is relying on you for a complete plan. Do not leave out steps or assume they know where to find something.
-`},
-		}},
-	}
+` + cfg.languageInstruction()},
+	}}
 	return exp
 }
@@ -0,0 +1,28 @@
+package b3app
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOfflineChecks(t *testing.T) {
+	a := newTestApp(t)
+	if err := writePinned(&pinnedFile{ID: "pinned", Name: "Passport.pdf", Content: []byte("%PDF")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pinnedOffline(a, map[string]any{"file_id": "pinned"}); err != nil {
+		t.Errorf("reading a pinned file offline = %v, want no error", err)
+	}
+	if err := pinnedOffline(a, map[string]any{"file_id": "other"}); !errors.Is(err, ErrOffline) {
+		t.Errorf("reading a file without local copy offline = %v, want ErrOffline", err)
+	}
+
+	a.Config.Embeddings.Embedder = EmbedderGemini
+	if err := embedderOffline(a, nil); err == nil {
+		t.Errorf("finding documents offline with the %s embedder succeeded", EmbedderGemini)
+	}
+	a.Config.Embeddings.Embedder = EmbedderHash
+	if err := embedderOffline(a, nil); err != nil {
+		t.Errorf("finding documents offline with the %s embedder = %v, want no error", EmbedderHash, err)
+	}
+}
@@ -0,0 +1,420 @@
+package b3app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/genai"
+)
+
+// Reasons for a file to be analyzed again.
+const (
+	ReasonMissing    = "missing description"
+	ReasonStale      = "modified since described"
+	ReasonShort      = "short description"
+	ReasonGeneric    = "generic name"
+	ReasonNoMetadata = "no metadata"
+	ReasonIncomplete = "incomplete metadata"
+)
+
+// minDescriptionRunes is the length under which a description is too short to be useful.
+const minDescriptionRunes = 80
+
+// genericNames are the words of file names that say nothing about the document, like "Scan_0001.pdf".
+var genericNames = map[string]bool{
+	"": true, "scan": true, "img": true, "image": true, "dsc": true, "photo": true, "document": true, "doc": true,
+	"file": true, "fichier": true, "untitled": true, "sans titre": true, "copy of": true, "copie de": true, "download": true,
+}
+
+// isGenericName reports whether a file name says nothing about the document.
+func isGenericName(name string) bool {
+	base := strings.TrimSuffix(name, path.Ext(name))
+	var words []string
+	for _, t := range tokenize(base) {
+		// Numbers say nothing either, even glued to a word like in "DSC01234".
+		if w := strings.Trim(t.term, "0123456789"); w != "" {
+			words = append(words, w)
+		}
+	}
+	return genericNames[strings.Join(words, " ")]
+}
+
+// describeSlack is how long the update writing a description may take: it changes the modified time of the file.
+const describeSlack = time.Minute
+
+// modifiedSinceDescribed reports whether the file has changed since its description and metadata were written:
+// its content checksum differs from the one described, or, without checksums like for Google Workspace files,
+// it was modified after the description.
+func modifiedSinceDescribed(f File) bool {
+	m := f.Metadata
+	if m == nil {
+		return false
+	}
+	if m.SourceMD5 != "" && f.MD5Checksum != "" {
+		return m.SourceMD5 != f.MD5Checksum
+	}
+	described, err := time.Parse(time.RFC3339, m.Described)
+	if err != nil || f.Modified.IsZero() {
+		return false
+	}
+	return f.Modified.After(described.Add(describeSlack))
+}
+
+// reviewReasons returns why the description of f should be written again, if it should.
+func (c *Config) reviewReasons(f File) []string {
+	prose := stripMetadata(f.Description)
+	if prose == "" && f.Metadata == nil {
+		return []string{ReasonMissing}
+	}
+	var reasons []string
+	if modifiedSinceDescribed(f) {
+		reasons = append(reasons, ReasonStale)
+	}
+	if utf8.RuneCountInString(prose) < minDescriptionRunes {
+		reasons = append(reasons, ReasonShort)
+	}
+	if isGenericName(f.Name) {
+		reasons = append(reasons, ReasonGeneric)
+	}
+	switch {
+	case f.Metadata == nil:
+		reasons = append(reasons, ReasonNoMetadata)
+	case len(c.checkMetadata(f.Metadata)) > 0:
+		reasons = append(reasons, ReasonIncomplete)
+	}
+	return reasons
+}
+
+// Status of an IndexProposal.
+const (
+	ProposalPending  = "pending"  // Not analyzed yet.
+	ProposalAnalyzed = "analyzed" // Analyzed, waiting for a review.
+	ProposalFailed   = "failed"   // The analysis failed, it is retried on the next run.
+	ProposalTooLong  = "too_long" // Too long to be read at once, it is left to read section by section.
+	ProposalApplied  = "applied"
+	ProposalRejected = "rejected"
+)
+
+// IndexProposal is a new name, description and metadata proposed for a file.
+type IndexProposal struct {
+	File     File      `json:"file"` // The file when the run started.
+	Reasons  []string  `json:"reasons"`
+	Status   string    `json:"status"`
+	Analysis *Analysis `json:"analysis,omitempty"`
+	Name     string    `json:"name,omitempty"` // The proposed name.
+	Error    string    `json:"error,omitempty"`
+}
+
+// IndexRun is a batch analysis of the vault files, saved after every step so that it can be resumed.
+type IndexRun struct {
+	mu        sync.Mutex
+	Started   time.Time        `json:"started"`
+	Proposals []*IndexProposal `json:"proposals"`
+}
+
+// NewIndexRun starts a batch analysis of the files of B3 and B4 whose description is missing, stale or poor,
+// at most limit if positive.
+//
+// Files whose proposal was rejected are skipped until their content changes.
+func (a *App) NewIndexRun(limit int) *IndexRun {
+	r := &IndexRun{Started: time.Now()}
+	rejected := loadRejections()
+	for _, f := range append(a.indexedFiles("B3"), a.indexedFiles("B4")...) {
+		if limit > 0 && len(r.Proposals) == limit {
+			break
+		}
+		if isCalendar(f) || rejected[f.ID] == fileVersion(f) {
+			continue
+		}
+		if reasons := a.Config.reviewReasons(f); len(reasons) > 0 {
+			r.Proposals = append(r.Proposals, &IndexProposal{File: f, Reasons: reasons, Status: ProposalPending})
+		}
+	}
+	return r
+}
+
+// indexRunPath returns the path to the state of the current batch analysis.
+func indexRunPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "index-run.json"), nil
+}
+
+// LoadIndexRun reads the batch analysis interrupted earlier. It returns nil if there is none.
+func LoadIndexRun() (*IndexRun, error) {
+	path, err := indexRunPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the previous run: %w", err)
+	}
+	r := &IndexRun{}
+	if err := json.Unmarshal(data, r); err != nil {
+		return nil, fmt.Errorf("failed to decode the previous run %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Save writes the state of the run.
+func (r *IndexRun) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.save()
+}
+
+func (r *IndexRun) save() error {
+	path, err := indexRunPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode the run: %w", err)
+	}
+	if err := writePrivateFile(path, data); err != nil {
+		return fmt.Errorf("failed to write the run: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes the state of the run, once it is over.
+func (r *IndexRun) Remove() error {
+	path, err := indexRunPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove the run: %w", err)
+	}
+	return nil
+}
+
+// Count returns the number of proposals with the given status.
+func (r *IndexRun) Count(status string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, p := range r.Proposals {
+		if p.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Analyze analyzes the pending and failed proposals of the run, concurrently, within the configured rate limit.
+// The run is saved after each analysis, and progress, if not nil, is called.
+//
+// It stops at the first error saving the run, or when ctx is done.
+func (a *App) Analyze(ctx context.Context, client *genai.Client, r *IndexRun, progress func(p *IndexProposal)) error {
+	var todo []*IndexProposal
+	for _, p := range r.Proposals {
+		if p.Status == ProposalPending || p.Status == ProposalFailed {
+			todo = append(todo, p)
+		}
+	}
+	if len(todo) == 0 {
+		return nil
+	}
+
+	// One request per tick, whatever the number of workers.
+	limiter := time.NewTicker(time.Minute / time.Duration(a.Config.Analysis.RateLimit))
+	defer limiter.Stop()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	jobs := make(chan *IndexProposal)
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+	for range min(a.Config.Analysis.Concurrency, len(todo)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				analysis, err := a.AnalyzeFile(ctx, client, p.File.ID, "", false)
+				if ctx.Err() != nil {
+					return // Interrupted, the proposal stays as it was.
+				}
+
+				r.mu.Lock()
+				switch {
+				case errors.Is(err, ErrTooLong):
+					// Reading it again would fail again: it is not proposed again until it changes.
+					p.Status, p.Error = ProposalTooLong, err.Error()
+					if err := recordRejection(p.File); err != nil {
+						log.Printf("warning: could not record that %s is too long, it will be analyzed again: %v", p.File.Name, err)
+					}
+				case err != nil:
+					p.Status, p.Error = ProposalFailed, err.Error()
+				default:
+					p.Status, p.Error, p.Analysis = ProposalAnalyzed, "", analysis
+					p.Name = proposedName(p.File.Name, analysis.SuggestedName)
+				}
+				err = r.save()
+				r.mu.Unlock()
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					cancel()
+					return
+				}
+				if progress != nil {
+					progress(p)
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, p := range todo {
+		select {
+		case <-ctx.Done():
+			break feed
+		case <-limiter.C:
+		}
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- p:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return ctx.Err()
+	}
+}
+
+// proposedName returns the suggested name, with the extension of the current name.
+func proposedName(current, suggested string) string {
+	suggested = strings.TrimSpace(suggested)
+	if suggested == "" {
+		return current
+	}
+	ext := path.Ext(current)
+	if ext != "" && !strings.EqualFold(path.Ext(suggested), ext) {
+		suggested += ext
+	}
+	return suggested
+}
+
+// ErrInvalidIdentifiers is returned by Apply for a proposal with identifiers failing their check digits.
+var ErrInvalidIdentifiers = errors.New("invalid identifiers")
+
+// Apply updates the file with the proposed name, description and metadata.
+// Identifiers failing their check digits are refused with ErrInvalidIdentifiers, unless acceptInvalid is set
+// because the user reviewed them.
+func (a *App) Apply(ctx context.Context, r *IndexRun, p *IndexProposal, acceptInvalid bool) error {
+	if p.Status != ProposalAnalyzed {
+		return fmt.Errorf("proposal for %s is %s, not analyzed", p.File.Name, p.Status)
+	}
+	if p.Analysis.Metadata != nil && !acceptInvalid {
+		if invalid := p.Analysis.Metadata.invalidIdentifiers(); len(invalid) > 0 {
+			return fmt.Errorf("%w in %s: %s", ErrInvalidIdentifiers, p.File.Name, strings.Join(invalid, "; "))
+		}
+	}
+	name := p.Name
+	if name == p.File.Name {
+		name = ""
+	}
+	if err := a.UpdateFile(ctx, p.File.ID, name, p.Analysis.Description, p.Analysis.Metadata, false); err != nil {
+		return err
+	}
+	return r.decide(p, ProposalApplied)
+}
+
+// Reject records that the proposal is not wanted, and that the file is not to be analyzed again
+// by the next runs, as long as its content does not change.
+func (r *IndexRun) Reject(p *IndexProposal) error {
+	if err := recordRejection(p.File); err != nil {
+		return err
+	}
+	return r.decide(p, ProposalRejected)
+}
+
+// fileVersion identifies the content of a file: its MD5 checksum, or its modified time for Google Workspace files.
+func fileVersion(f File) string {
+	if f.MD5Checksum != "" {
+		return f.MD5Checksum
+	}
+	return f.Modified.UTC().Format(time.RFC3339)
+}
+
+// rejectionsPath returns the path to the files not to propose again: their proposal was rejected,
+// or they are too long to be read at once.
+func rejectionsPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "index-rejected.json"), nil
+}
+
+// loadRejections returns the version of the files not to propose again, see fileVersion, by file ID.
+func loadRejections() map[string]string {
+	rejected := make(map[string]string)
+	path, err := rejectionsPath()
+	if err != nil {
+		return rejected
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return rejected
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &rejected)
+	}
+	if err != nil {
+		log.Printf("warning: could not read the rejected proposals, they may be proposed again: %v", err)
+	}
+	return rejected
+}
+
+// recordRejection adds the current version of the file to the files not to propose again.
+func recordRejection(f File) error {
+	path, err := rejectionsPath()
+	if err != nil {
+		return err
+	}
+	rejected := loadRejections()
+	rejected[f.ID] = fileVersion(f)
+	data, err := json.Marshal(rejected)
+	if err != nil {
+		return fmt.Errorf("failed to encode the rejected proposals: %w", err)
+	}
+	if err := writePrivateFile(path, data); err != nil {
+		return fmt.Errorf("failed to write the rejected proposals: %w", err)
+	}
+	return nil
+}
+
+// decide records the status of a reviewed proposal.
+func (r *IndexRun) decide(p *IndexProposal, status string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p.Status = status
+	return r.save()
+}
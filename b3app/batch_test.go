@@ -0,0 +1,116 @@
+package b3app
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsGenericName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"Scan_0001.pdf", true},
+		{"IMG_20240312_101523.jpg", true},
+		{"DSC01234.JPG", true},
+		{"document.pdf", true},
+		{"Document (3).pdf", true},
+		{"Copy of 123.pdf", true},
+		{"Sans titre.pdf", true},
+		{"fichier-2.docx", true},
+		{"2024-03-12.pdf", true},
+		{"", true},
+		{"Passport - Marie Curie.pdf", false},
+		{"Scan passport.pdf", false},
+		{"Facture EDF mars 2024.pdf", false},
+		{"Copy of lease.pdf", false},
+	}
+	for _, tt := range tests {
+		if got := isGenericName(tt.name); got != tt.want {
+			t.Errorf("isGenericName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProposedName(t *testing.T) {
+	tests := []struct {
+		current, suggested, want string
+	}{
+		{"Scan_0001.pdf", "Passport - Marie Curie", "Passport - Marie Curie.pdf"},
+		{"Scan_0001.pdf", "Passport - Marie Curie.pdf", "Passport - Marie Curie.pdf"},
+		{"Scan_0001.PDF", "Passport - Marie Curie.pdf", "Passport - Marie Curie.pdf"},
+		{"Scan_0001.pdf", "  Lease - 36 quai de Béthune  ", "Lease - 36 quai de Béthune.pdf"},
+		{"photo.jpg", "Invoice 2024.03.pdf", "Invoice 2024.03.pdf.jpg"},
+		{"Scan_0001.pdf", "", "Scan_0001.pdf"},
+		{"Scan_0001.pdf", "   ", "Scan_0001.pdf"},
+		{"Budget", "Household budget 2024", "Household budget 2024"}, // A Google Sheet has no extension.
+	}
+	for _, tt := range tests {
+		if got := proposedName(tt.current, tt.suggested); got != tt.want {
+			t.Errorf("proposedName(%q, %q) = %q, want %q", tt.current, tt.suggested, got, tt.want)
+		}
+	}
+}
+
+func TestModifiedSinceDescribed(t *testing.T) {
+	described := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	at := described.Format(time.RFC3339)
+	tests := []struct {
+		name     string
+		md5      string
+		modified time.Time
+		m        *Metadata
+		want     bool
+	}{
+		{"no metadata", "a", described.AddDate(1, 0, 0), nil, false},
+		{"same content", "a", described.AddDate(1, 0, 0), &Metadata{SourceMD5: "a", Described: at}, false},
+		{"new content", "b", described, &Metadata{SourceMD5: "a", Described: at}, true},
+		{"workspace file unchanged", "", described.Add(10 * time.Second), &Metadata{Described: at}, false},
+		{"workspace file modified", "", described.Add(time.Hour), &Metadata{Described: at}, true},
+		{"metadata without checksum", "a", described.Add(time.Hour), &Metadata{Described: at}, true},
+		{"unknown description time", "", described.Add(time.Hour), &Metadata{}, false},
+	}
+	for _, tt := range tests {
+		f := File{Name: "f", MD5Checksum: tt.md5, Modified: tt.modified, Metadata: tt.m}
+		if got := modifiedSinceDescribed(f); got != tt.want {
+			t.Errorf("%s: modifiedSinceDescribed() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewIndexRunSkipsRejected(t *testing.T) {
+	scan := testFile("b3", "scan", "Scan_0001.pdf", nil)
+	sheet := testFile("b3", "sheet", "Untitled", nil)
+	sheet.MD5Checksum, sheet.MimeType = "", "application/vnd.google-apps.spreadsheet"
+	a := newTestApp(t, scan, sheet)
+
+	ids := func(r *IndexRun) string {
+		var ids []string
+		for _, p := range r.Proposals {
+			ids = append(ids, p.File.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+	r := a.NewIndexRun(0)
+	if got := ids(r); got != "scan,sheet" {
+		t.Fatalf("NewIndexRun() proposes %s, want scan,sheet", got)
+	}
+	for _, p := range r.Proposals {
+		p.Status = ProposalAnalyzed
+		if err := r.Reject(p); err != nil {
+			t.Fatalf("Reject() error = %v", err)
+		}
+	}
+	if got := ids(a.NewIndexRun(0)); got != "" {
+		t.Errorf("after rejections, NewIndexRun() proposes %s, want none", got)
+	}
+
+	// New versions are proposed again.
+	scan.MD5Checksum = "new"
+	sheet.Modified = sheet.Modified.Add(time.Hour)
+	a.index.Files["scan"], a.index.Files["sheet"] = scan, sheet
+	if got := ids(a.NewIndexRun(0)); got != "scan,sheet" {
+		t.Errorf("after changes, NewIndexRun() proposes %s, want scan,sheet", got)
+	}
+}
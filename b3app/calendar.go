@@ -0,0 +1,199 @@
+package b3app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// CalendarName is the name of the calendar uploaded to B4.
+const CalendarName = "B3 calendar.ics"
+
+// isCalendar reports whether f is the calendar uploaded by 'b3 calendar -upload': it is generated, not a document to describe.
+func isCalendar(f File) bool {
+	return f.Path == "B4" && f.Name == CalendarName
+}
+
+// CalendarEvent is an important date of the vault, as an all-day event.
+type CalendarEvent struct {
+	// UID identifies the event across exports, so that importing the calendar again updates it.
+	UID         string
+	Date        string // YYYY-MM-DD.
+	Summary     string
+	Description string
+	FileID      string
+	// Alarms are the reminders, as RFC 5545 durations relative to the start of the day, like "-P7D" or "PT9H".
+	Alarms []string
+}
+
+// deadlineKinds are the kinds of extracted dates that are deadlines of a procedure, like paying a tax.
+var deadlineKinds = []string{"due", "deadline", "notice", "appointment", "hearing", "limit"}
+
+// isDeadline reports whether an extracted date of that kind is a deadline, like "due" or "payment_deadline".
+func isDeadline(kind string) bool {
+	for _, k := range deadlineKinds {
+		if strings.Contains(kind, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// CalendarEvents returns the important dates of the vault from now on: expiry dates, renewal reminders,
+// the last days to terminate contracts, and the deadlines read in the documents already analyzed.
+func (a *App) CalendarEvents(now time.Time) []CalendarEvent {
+	today := now.Format(dateLayout)
+	var events []CalendarEvent
+	for _, e := range a.expirations(now) {
+		if e.ExpiryDate < today {
+			continue
+		}
+		who := ""
+		if e.Holder != "" {
+			who = " of " + e.Holder
+		}
+		where := fmt.Sprintf("%s/%s", e.File.Path, e.File.Name)
+		events = append(events, CalendarEvent{
+			UID: "expiry-" + e.File.ID, Date: e.ExpiryDate, FileID: e.File.ID,
+			Summary:     fmt.Sprintf("%s%s expires", e.Label, who),
+			Description: fmt.Sprintf("%s expires today.\n%s", e.Label+who, where),
+			Alarms:      []string{"-P14D"},
+		})
+		// A contract renews when it is not terminated: the notice is the only reminder needed then.
+		if e.RenewBy != e.ExpiryDate && e.RenewBy != e.NoticeBy {
+			events = append(events, CalendarEvent{
+				UID: "renewal-" + e.File.ID, Date: e.RenewBy, FileID: e.File.ID,
+				Summary:     fmt.Sprintf("Renew the %s%s", strings.ToLower(e.Label), who),
+				Description: fmt.Sprintf("Start the renewal now: %s expires on %s.\n%s", e.Label+who, e.ExpiryDate, where),
+				Alarms:      []string{"-P7D", "PT9H"},
+			})
+		}
+		if e.NoticeBy != "" {
+			events = append(events, CalendarEvent{
+				UID: "notice-" + e.File.ID, Date: e.NoticeBy, FileID: e.File.ID,
+				Summary:     fmt.Sprintf("Last day to terminate the %s%s", strings.ToLower(e.Label), who),
+				Description: fmt.Sprintf("To terminate it, give notice today at the latest: %s ends, or renews, on %s.\n%s", e.Label+who, e.ExpiryDate, where),
+				Alarms:      []string{"-P14D", "PT9H"},
+			})
+		}
+	}
+
+	// Deadlines are only known from the analyses of the documents, they are not part of the metadata.
+	for _, f := range append(a.indexedFiles("B3"), a.indexedFiles("B4")...) {
+		if f.MD5Checksum == "" {
+			continue
+		}
+		c := loadAnalysis(f.ID, "", a.analysisKey(f.MD5Checksum, ""))
+		if c == nil {
+			continue
+		}
+		for _, d := range c.Extraction.Dates {
+			if !isDeadline(d.Kind) || d.Value < today {
+				continue
+			}
+			events = append(events, CalendarEvent{
+				UID: "deadline-" + f.ID + "-" + d.Kind + "-" + d.Value, Date: d.Value, FileID: f.ID,
+				Summary:     fmt.Sprintf("%s: %s", strings.TrimSuffix(f.Name, path.Ext(f.Name)), strings.ReplaceAll(d.Kind, "_", " ")),
+				Description: fmt.Sprintf("%s date of %s/%s.", d.Kind, f.Path, f.Name),
+				Alarms:      []string{"-P3D", "PT9H"},
+			})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Date != events[j].Date {
+			return events[i].Date < events[j].Date
+		}
+		return events[i].UID < events[j].UID
+	})
+	return events
+}
+
+// WriteICS writes the events as an RFC 5545 iCalendar, stamped with now.
+func WriteICS(w io.Writer, events []CalendarEvent, now time.Time) error {
+	var b bytes.Buffer
+	line := func(s string) {
+		// Lines are folded at 75 octets, continuation lines starting with a space, without splitting a UTF-8 character.
+		for len(s) > 75 {
+			cut := 75
+			for cut > 0 && s[cut]&0xC0 == 0x80 {
+				cut--
+			}
+			b.WriteString(s[:cut] + "\r\n")
+			s = " " + s[cut:]
+		}
+		b.WriteString(s + "\r\n")
+	}
+	stamp := now.UTC().Format("20060102T150405Z")
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//etnz//b3//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:B3")
+	for _, e := range events {
+		start, err := time.Parse(dateLayout, e.Date)
+		if err != nil {
+			return fmt.Errorf("invalid date %q for event %s: %w", e.Date, e.UID, err)
+		}
+		line("BEGIN:VEVENT")
+		line("UID:" + icsText(e.UID) + "@b3")
+		line("DTSTAMP:" + stamp)
+		line("DTSTART;VALUE=DATE:" + start.Format("20060102"))
+		line("DTEND;VALUE=DATE:" + start.AddDate(0, 0, 1).Format("20060102"))
+		line("SUMMARY:" + icsText(e.Summary))
+		if e.Description != "" {
+			line("DESCRIPTION:" + icsText(e.Description))
+		}
+		if e.FileID != "" {
+			line("URL:https://drive.google.com/file/d/" + e.FileID + "/view")
+		}
+		line("TRANSP:TRANSPARENT")
+		for _, trigger := range e.Alarms {
+			line("BEGIN:VALARM")
+			line("ACTION:DISPLAY")
+			line("TRIGGER:" + trigger)
+			line("DESCRIPTION:" + icsText(e.Summary))
+			line("END:VALARM")
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// icsText escapes a TEXT value of an iCalendar.
+func icsText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// UploadCalendar uploads the calendar to B4, replacing the content of the previous upload if any,
+// so that calendars subscribed to it stay up to date.
+func (a *App) UploadCalendar(ctx context.Context, content []byte) (*File, error) {
+	if err := a.checkOnline(); err != nil {
+		return nil, err
+	}
+	for _, f := range a.indexedFiles("B4") {
+		if isCalendar(f) {
+			updated, err := a.filesUpdate(ctx, f.ID, &drive.File{}).Media(bytes.NewReader(content)).Do()
+			if err != nil {
+				return nil, fmt.Errorf("could not update %s: %w", CalendarName, err)
+			}
+			return &File{ID: updated.Id, Name: updated.Name}, nil
+		}
+	}
+	b4FolderID, err := a.findB4FolderID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.CreateFile(ctx, CalendarName, "Important dates of the vault, generated by 'b3 calendar': document expirations, renewals, notice periods and deadlines.", "text/calendar", b4FolderID, bytes.NewReader(content))
+}
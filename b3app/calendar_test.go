@@ -0,0 +1,105 @@
+package b3app
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestICSText(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Passport", "Passport"},
+		{"Tax, 2025; due", `Tax\, 2025\; due`},
+		{`C:\Drive`, `C:\\Drive`},
+		{"line 1\nline 2\r\nline 3", `line 1\nline 2\nline 3`},
+	}
+	for _, tt := range tests {
+		if got := icsText(tt.in); got != tt.want {
+			t.Errorf("icsText(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestWriteICS(t *testing.T) {
+	long := strings.Repeat("Attestation d'assurance habitation résiliée, ", 5)
+	events := []CalendarEvent{
+		{UID: "expiry-a", Date: "2031-03-12", Summary: "Passport of Marie Curie expires", Description: "Passport expires today.\nB3/Identity/passport.pdf", FileID: "a", Alarms: []string{"-P14D"}},
+		{UID: "notice-b", Date: "2026-12-31", Summary: long, Description: long + "€€€€€€€€€€€€€€€€€€€€€€€€€€€€€€€"},
+	}
+	var b bytes.Buffer
+	if err := WriteICS(&b, events, time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("WriteICS() error = %v", err)
+	}
+	out := b.String()
+	if !strings.HasSuffix(out, "END:VCALENDAR\r\n") {
+		t.Errorf("WriteICS() does not end with END:VCALENDAR and a CRLF")
+	}
+	for i, l := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		if strings.Contains(l, "\n") {
+			t.Errorf("line %d %q ends with a bare LF", i, l)
+		}
+		if len(l) > 75 {
+			t.Errorf("line %d %q has %d octets, more than 75", i, l, len(l))
+		}
+		if !utf8.ValidString(l) {
+			t.Errorf("line %d %q splits a UTF-8 character", i, l)
+		}
+	}
+
+	unfolded := strings.ReplaceAll(out, "\r\n ", "")
+	for _, want := range []string{
+		"UID:expiry-a@b3\r\n",
+		"DTSTAMP:20261018T093000Z\r\n",
+		"DTSTART;VALUE=DATE:20310312\r\n",
+		"DTEND;VALUE=DATE:20310313\r\n",
+		"DESCRIPTION:Passport expires today.\\nB3/Identity/passport.pdf\r\n",
+		"URL:https://drive.google.com/file/d/a/view\r\n",
+		"TRIGGER:-P14D\r\n",
+		"DTEND;VALUE=DATE:20270101\r\n",
+		"SUMMARY:" + icsText(long) + "\r\n",
+		"DESCRIPTION:" + icsText(long) + "€€€€€€€€€€€€€€€€€€€€€€€€€€€€€€€\r\n",
+	} {
+		if !strings.Contains(unfolded, want) {
+			t.Errorf("WriteICS() = %q, want it to contain %q", unfolded, want)
+		}
+	}
+	if n := strings.Count(out, "BEGIN:VALARM"); n != 1 {
+		t.Errorf("WriteICS() has %d alarms, want 1", n)
+	}
+}
+
+func TestWriteICSInvalidDate(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteICS(&b, []CalendarEvent{{UID: "x", Date: "31/12/2026"}}, time.Now()); err == nil {
+		t.Error("WriteICS() with an invalid date = nil error, want one")
+	}
+}
+
+func TestIsDeadline(t *testing.T) {
+	for kind, want := range map[string]bool{
+		"due": true, "payment_deadline": true, "appointment": true, "hearing_date": true,
+		"issue": false, "birth": false, "expiry": false,
+	} {
+		if got := isDeadline(kind); got != want {
+			t.Errorf("isDeadline(%q) = %v, want %v", kind, got, want)
+		}
+	}
+}
+
+func TestCalendarIsNotADocument(t *testing.T) {
+	calendar := testFile("b4", "cal", CalendarName, nil)
+	calendar.Created = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := newTestApp(t, calendar, testFile("b4", "doc", "scan.pdf", nil))
+	for _, p := range a.NewIndexRun(0).Proposals {
+		if p.File.ID == "cal" {
+			t.Errorf("NewIndexRun() proposes to describe the calendar: %v", p.Reasons)
+		}
+	}
+	for _, f := range a.Lint(time.Now()) {
+		if f.File.ID == "cal" {
+			t.Errorf("Lint() reports the calendar: %s %s", f.Rule, f.Message)
+		}
+	}
+}
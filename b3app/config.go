@@ -0,0 +1,467 @@
+package b3app
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/genai"
+	"gopkg.in/yaml.v2"
+)
+
+// Names of the experts that can be configured in the 'experts' section.
+const (
+	ExpertB3     = "b3"     // The main conversational expert.
+	ExpertAdmin  = "admin"  // The administrative procedures expert.
+	ExpertReader = "reader" // The model reading documents for ReadFile.
+)
+
+// Config holds all user configurable settings of B3.
+//
+// It is read from ~/.config/b3/config.yaml (see ConfigPath), then overridden by
+// environment variables (see LoadConfig) and finally by command line flags.
+type Config struct {
+	// Vault locates the B3 and B4 folders.
+	Vault VaultConfig `yaml:"vault"`
+	// Auth configures the OAuth client used to access Google Drive.
+	Auth AuthConfig `yaml:"auth"`
+	// Drive tunes the access to the Google Drive API.
+	Drive DriveConfig `yaml:"drive"`
+	// Experts configures the model of each expert, keyed by ExpertB3, ExpertAdmin or ExpertReader.
+	Experts map[string]ExpertConfig `yaml:"experts"`
+	// Tools is the list of tool names made available to the B3 expert.
+	// All tools are enabled when empty.
+	Tools []string `yaml:"tools"`
+	// Language is the language B3 uses to talk to the user and write descriptions.
+	// When empty, B3 answers in the user's language.
+	Language string `yaml:"language"`
+	// Safety overrides the model safety settings.
+	Safety []SafetyConfig `yaml:"safety"`
+	// Types extends the built-in document types, or overrides them by name.
+	Types []DocumentType `yaml:"types"`
+	// Embeddings configures the semantic search.
+	Embeddings EmbeddingsConfig `yaml:"embeddings"`
+	// Analysis tunes the batch analysis of documents by 'b3 index'.
+	Analysis AnalysisConfig `yaml:"analysis"`
+	// Lint tunes the rules of 'b3 lint'.
+	Lint LintConfig `yaml:"lint"`
+	// Expiry tunes the tracking of documents to renew.
+	Expiry ExpiryConfig `yaml:"expiry"`
+}
+
+// VaultConfig locates the B3 and B4 folders.
+type VaultConfig struct {
+	B3Folder   string `yaml:"b3_folder"`    // Path of the B3 folder from the root of the Drive, like "Admin/Family/B3".
+	B4Folder   string `yaml:"b4_folder"`    // Path of the B4 folder from the root of the Drive.
+	B3FolderID string `yaml:"b3_folder_id"` // When set, the B3 folder ID, no search is performed.
+	B4FolderID string `yaml:"b4_folder_id"` // When set, the B4 folder ID, no search is performed.
+	Create     bool   `yaml:"create"`       // Create missing folders on first run.
+	// SharedDrive is the name or ID of the shared drive holding the vault.
+	// Folder paths are then relative to the root of that shared drive.
+	SharedDrive string `yaml:"shared_drive"`
+}
+
+// AuthConfig configures the OAuth client.
+type AuthConfig struct {
+	ClientID    string `yaml:"client_id"`    // The "Desktop app" OAuth 2.0 client ID.
+	RedirectURL string `yaml:"redirect_url"` // The local URL receiving the OAuth callback.
+	Scope       string `yaml:"scope"`        // The default scope mode requested at login: "full" or "file".
+}
+
+// DriveConfig tunes the access to the Google Drive API.
+type DriveConfig struct {
+	Concurrency int `yaml:"concurrency"` // Maximum number of concurrent list requests when scanning folders.
+	BatchSize   int `yaml:"batch_size"`  // Number of folders listed by a single request.
+}
+
+// EmbeddingsConfig configures the embedder of the semantic search.
+type EmbeddingsConfig struct {
+	Embedder   string `yaml:"embedder"`   // EmbedderGemini or EmbedderHash.
+	Model      string `yaml:"model"`      // The Gemini embedding model.
+	Dimensions int    `yaml:"dimensions"` // The dimension of the hash embedder vectors.
+}
+
+// AnalysisConfig tunes the batch analysis of documents.
+type AnalysisConfig struct {
+	Concurrency int `yaml:"concurrency"` // Maximum number of documents analyzed at the same time.
+	RateLimit   int `yaml:"rate_limit"`  // Maximum number of analysis requests per minute.
+	// InlineMB is the size in MB up to which documents are sent within the request, larger ones are uploaded first.
+	InlineMB  int `yaml:"inline_mb"`
+	MaxFileMB int `yaml:"max_file_mb"` // Maximum size in MB of a document, or of the pages of a PDF, read at once.
+	MaxPages  int `yaml:"max_pages"`   // Maximum number of PDF pages read at once.
+}
+
+// LintConfig tunes the rules of 'b3 lint'.
+type LintConfig struct {
+	B4MaxAge string `yaml:"b4_max_age"` // How long a file can stay in B4, like "30d" or "3m".
+}
+
+// ExpiryConfig tunes the tracking of documents to renew.
+type ExpiryConfig struct {
+	Within string `yaml:"within"` // How far ahead the session greeting and 'b3 expiring' look for documents to renew, like "90d".
+}
+
+// ExpertConfig configures the model behind an expert.
+type ExpertConfig struct {
+	Model           string   `yaml:"model"`
+	Temperature     *float32 `yaml:"temperature"`
+	TopP            *float32 `yaml:"top_p"`
+	TopK            *float32 `yaml:"top_k"`
+	MaxOutputTokens int32    `yaml:"max_output_tokens"`
+}
+
+// SafetyConfig sets the block threshold for a harm category.
+type SafetyConfig struct {
+	Category  string `yaml:"category"`  // e.g. HARM_CATEGORY_DANGEROUS_CONTENT
+	Threshold string `yaml:"threshold"` // e.g. BLOCK_ONLY_HIGH
+}
+
+// toolNames lists all the tools that can be enabled in the 'tools' section.
+var toolNames = []string{
+	"Admin", "B3Files", "B4Files", "ReadFile", "B4Merge", "DownloadToB4",
+	"CreateDoc", "ExtractForm", "FillForm", "B4Delete", "UpdateFile", "SearchFiles",
+	"FindRelevantDocuments", "QueryFiles", "ReadText", "CheckConsistency",
+}
+
+// DefaultConfig returns the configuration used when no config file exists.
+func DefaultConfig() *Config {
+	return &Config{
+		Vault: VaultConfig{
+			B3Folder: "B3",
+			B4Folder: "B4",
+		},
+		Auth: AuthConfig{
+			ClientID:    "999716078375-50cl3182oudsaom3sfhogg0k57m714c5.apps.googleusercontent.com",
+			RedirectURL: "http://localhost:8080",
+			Scope:       string(ScopeFull),
+		},
+		Drive: DriveConfig{
+			Concurrency: 4,
+			BatchSize:   10,
+		},
+		Embeddings: EmbeddingsConfig{
+			Embedder: EmbedderGemini,
+			Model:    "gemini-embedding-001",
+		},
+		Analysis: AnalysisConfig{
+			Concurrency: 4,
+			RateLimit:   30,
+			InlineMB:    15,
+			MaxFileMB:   50,
+			MaxPages:    50,
+		},
+		Lint: LintConfig{
+			B4MaxAge: "30d",
+		},
+		Expiry: ExpiryConfig{
+			Within: "90d",
+		},
+		Experts: map[string]ExpertConfig{
+			ExpertB3:     {Model: "gemini-2.5-pro"},
+			ExpertAdmin:  {Model: "gemini-2.5-pro"}, // A powerful model for reasoning and planning
+			ExpertReader: {Model: "gemini-2.5-pro"},
+		},
+	}
+}
+
+// configDir returns the directory holding all B3 local files.
+func configDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config directory: %w", err)
+	}
+	return filepath.Join(dir, "b3"), nil
+}
+
+// writePrivateFile writes the data to path, atomically and with user only permissions since all the
+// local files hold personal data: through a temporary file of the same directory, renamed to path.
+// Missing directories are created. Every local file is written with it.
+func writePrivateFile(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	// CreateTemp creates the file with mode 0600.
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// ConfigPath returns the default path of the configuration file.
+func ConfigPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.yaml"), nil
+}
+
+// LoadConfig reads the configuration file at path, on top of DefaultConfig.
+//
+// If path is empty, the B3_CONFIG environment variable is used, and then
+// ConfigPath. A missing file at the default location is not an error.
+//
+// The following environment variables override the file values:
+// B3_B3_FOLDER, B3_B4_FOLDER, B3_B3_FOLDER_ID, B3_B4_FOLDER_ID, B3_SHARED_DRIVE, B3_CREATE_FOLDERS,
+// B3_CLIENT_ID, B3_REDIRECT_URL, B3_MODEL (the B3 expert model),
+// B3_ADMIN_MODEL, B3_READER_MODEL and B3_LANGUAGE.
+//
+// The result is validated.
+func LoadConfig(path string) (*Config, error) {
+	cfg := DefaultConfig()
+
+	explicit := path != ""
+	if !explicit {
+		path = os.Getenv("B3_CONFIG")
+		explicit = path != ""
+	}
+	if !explicit {
+		var err error
+		if path, err = ConfigPath(); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+		// No config file, use defaults.
+	case err != nil:
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	default:
+		// Strict mode to report misspelled keys instead of silently ignoring them. It also rejects
+		// the keys already set in a map, so the default experts are merged afterwards.
+		defaults := cfg.Experts
+		cfg.Experts = nil
+		if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		for name, e := range defaults {
+			if _, ok := cfg.Experts[name]; !ok {
+				if cfg.Experts == nil {
+					cfg.Experts = make(map[string]ExpertConfig)
+				}
+				cfg.Experts[name] = e
+			}
+		}
+	}
+
+	cfg.applyEnv()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration (%s): %w", path, err)
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides configuration values with environment variables.
+func (c *Config) applyEnv() {
+	set := func(dst *string, key string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = v
+		}
+	}
+	set(&c.Vault.B3Folder, "B3_B3_FOLDER")
+	set(&c.Vault.B4Folder, "B3_B4_FOLDER")
+	set(&c.Vault.B3FolderID, "B3_B3_FOLDER_ID")
+	set(&c.Vault.B4FolderID, "B3_B4_FOLDER_ID")
+	set(&c.Vault.SharedDrive, "B3_SHARED_DRIVE")
+	if v := os.Getenv("B3_CREATE_FOLDERS"); v != "" {
+		c.Vault.Create = v == "1" || strings.EqualFold(v, "true")
+	}
+	set(&c.Auth.ClientID, "B3_CLIENT_ID")
+	set(&c.Auth.RedirectURL, "B3_REDIRECT_URL")
+	set(&c.Language, "B3_LANGUAGE")
+	for key, env := range map[string]string{ExpertB3: "B3_MODEL", ExpertAdmin: "B3_ADMIN_MODEL", ExpertReader: "B3_READER_MODEL"} {
+		if v := os.Getenv(env); v != "" {
+			c.SetModel(key, v)
+		}
+	}
+}
+
+// SetModel sets the model of the expert called name.
+func (c *Config) SetModel(name, model string) {
+	if c.Experts == nil {
+		c.Experts = make(map[string]ExpertConfig)
+	}
+	e := c.Experts[name]
+	e.Model = model
+	c.Experts[name] = e
+}
+
+// Expert returns the configuration of the expert called name.
+func (c *Config) Expert(name string) ExpertConfig {
+	e := c.Experts[name]
+	if e.Model == "" {
+		e.Model = DefaultConfig().Experts[name].Model
+	}
+	return e
+}
+
+// ToolEnabled reports whether the tool called name is enabled.
+func (c *Config) ToolEnabled(name string) bool {
+	if len(c.Tools) == 0 {
+		return true
+	}
+	for _, t := range c.Tools {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the configuration and returns an error describing the first problem found.
+func (c *Config) Validate() error {
+	for _, f := range []struct{ key, name, id string }{
+		{"vault.b3_folder", c.Vault.B3Folder, c.Vault.B3FolderID},
+		{"vault.b4_folder", c.Vault.B4Folder, c.Vault.B4FolderID},
+	} {
+		if f.id == "" && len(splitFolderPath(f.name)) == 0 {
+			return fmt.Errorf("%s: a folder path or a folder ID is required", f.key)
+		}
+	}
+
+	if c.Auth.ClientID == "" {
+		return fmt.Errorf("auth.client_id: an OAuth client ID is required")
+	}
+	u, err := url.Parse(c.Auth.RedirectURL)
+	if err != nil || u.Scheme != "http" || u.Port() == "" {
+		return fmt.Errorf("auth.redirect_url: %q must be a local http URL with a port, like http://localhost:8080", c.Auth.RedirectURL)
+	}
+	if _, err := ParseScopeMode(c.Auth.Scope); err != nil {
+		return fmt.Errorf("auth.scope: %w", err)
+	}
+
+	if c.Drive.Concurrency < 1 || c.Drive.Concurrency > 32 {
+		return fmt.Errorf("drive.concurrency: %d is out of range [1, 32]", c.Drive.Concurrency)
+	}
+	// Drive rejects queries that are too long, keep batches reasonable.
+	if c.Drive.BatchSize < 1 || c.Drive.BatchSize > 50 {
+		return fmt.Errorf("drive.batch_size: %d is out of range [1, 50]", c.Drive.BatchSize)
+	}
+
+	for name, e := range c.Experts {
+		if name != ExpertB3 && name != ExpertAdmin && name != ExpertReader {
+			return fmt.Errorf("experts.%s: unknown expert, expected one of %s, %s, %s", name, ExpertB3, ExpertAdmin, ExpertReader)
+		}
+		if e.Temperature != nil && (*e.Temperature < 0 || *e.Temperature > 2) {
+			return fmt.Errorf("experts.%s.temperature: %v is out of range [0, 2]", name, *e.Temperature)
+		}
+		if e.TopP != nil && (*e.TopP < 0 || *e.TopP > 1) {
+			return fmt.Errorf("experts.%s.top_p: %v is out of range [0, 1]", name, *e.TopP)
+		}
+		if e.TopK != nil && *e.TopK < 1 {
+			return fmt.Errorf("experts.%s.top_k: %v must be at least 1", name, *e.TopK)
+		}
+		if e.MaxOutputTokens < 0 {
+			return fmt.Errorf("experts.%s.max_output_tokens: %d must be positive", name, e.MaxOutputTokens)
+		}
+	}
+
+	for _, t := range c.Tools {
+		known := false
+		for _, n := range toolNames {
+			known = known || n == t
+		}
+		if !known {
+			return fmt.Errorf("tools: unknown tool %q, expected some of %s", t, strings.Join(toolNames, ", "))
+		}
+	}
+
+	for i, s := range c.Safety {
+		if !strings.HasPrefix(s.Category, "HARM_CATEGORY_") {
+			return fmt.Errorf("safety[%d].category: %q is not a harm category, like HARM_CATEGORY_DANGEROUS_CONTENT", i, s.Category)
+		}
+		switch genai.HarmBlockThreshold(s.Threshold) {
+		case genai.HarmBlockThresholdBlockLowAndAbove, genai.HarmBlockThresholdBlockMediumAndAbove,
+			genai.HarmBlockThresholdBlockOnlyHigh, genai.HarmBlockThresholdBlockNone, genai.HarmBlockThresholdOff:
+		default:
+			return fmt.Errorf("safety[%d].threshold: %q is not one of BLOCK_LOW_AND_ABOVE, BLOCK_MEDIUM_AND_ABOVE, BLOCK_ONLY_HIGH, BLOCK_NONE, OFF", i, s.Threshold)
+		}
+	}
+	if c.Analysis.Concurrency < 1 || c.Analysis.Concurrency > 16 {
+		return fmt.Errorf("analysis.concurrency: %d is out of range [1, 16]", c.Analysis.Concurrency)
+	}
+	if c.Analysis.RateLimit < 1 {
+		return fmt.Errorf("analysis.rate_limit: %d must be at least 1 request per minute", c.Analysis.RateLimit)
+	}
+	// Gemini accepts requests up to 20 MB, and uploaded PDFs up to 50 MB and 1000 pages.
+	if c.Analysis.InlineMB < 1 || c.Analysis.InlineMB > 18 {
+		return fmt.Errorf("analysis.inline_mb: %d is out of range [1, 18]", c.Analysis.InlineMB)
+	}
+	if c.Analysis.MaxFileMB < c.Analysis.InlineMB || c.Analysis.MaxFileMB > 50 {
+		return fmt.Errorf("analysis.max_file_mb: %d is out of range [%d, 50]", c.Analysis.MaxFileMB, c.Analysis.InlineMB)
+	}
+	if c.Analysis.MaxPages < 1 || c.Analysis.MaxPages > 1000 {
+		return fmt.Errorf("analysis.max_pages: %d is out of range [1, 1000]", c.Analysis.MaxPages)
+	}
+	if _, err := ParsePeriod(c.Lint.B4MaxAge); err != nil {
+		return fmt.Errorf("lint.b4_max_age: %w", err)
+	}
+	if _, err := ParsePeriod(c.Expiry.Within); err != nil {
+		return fmt.Errorf("expiry.within: %w", err)
+	}
+
+	switch c.Embeddings.Embedder {
+	case EmbedderGemini:
+		if c.Embeddings.Model == "" {
+			return fmt.Errorf("embeddings.model: a Gemini embedding model is required")
+		}
+	case EmbedderHash:
+		if c.Embeddings.Dimensions < 0 {
+			return fmt.Errorf("embeddings.dimensions: %d must be positive", c.Embeddings.Dimensions)
+		}
+	default:
+		return fmt.Errorf("embeddings.embedder: unknown embedder %q, expected %s or %s", c.Embeddings.Embedder, EmbedderGemini, EmbedderHash)
+	}
+
+	for i, t := range c.Types {
+		if err := t.validate(); err != nil {
+			return fmt.Errorf("types[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// GenerateContentConfig returns a model configuration for the expert called name,
+// with its generation parameters and the safety settings.
+func (c *Config) GenerateContentConfig(name string) *genai.GenerateContentConfig {
+	e := c.Expert(name)
+	gc := &genai.GenerateContentConfig{
+		Temperature:     e.Temperature,
+		TopP:            e.TopP,
+		TopK:            e.TopK,
+		MaxOutputTokens: e.MaxOutputTokens,
+	}
+	for _, s := range c.Safety {
+		gc.SafetySettings = append(gc.SafetySettings, &genai.SafetySetting{
+			Category:  genai.HarmCategory(s.Category),
+			Threshold: genai.HarmBlockThreshold(s.Threshold),
+		})
+	}
+	return gc
+}
+
+// languageInstruction returns a system prompt sentence enforcing the configured language.
+func (c *Config) languageInstruction() string {
+	if c.Language == "" {
+		return ""
+	}
+	return fmt.Sprintf("\nAlways answer, and write file names and descriptions, in %s.\n", c.Language)
+}
@@ -0,0 +1,211 @@
+package b3app
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWritePrivateFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "b3", "analyses")
+	path := filepath.Join(dir, "file.json")
+	for _, data := range []string{"first", "second, longer"} {
+		if err := writePrivateFile(path, []byte(data)); err != nil {
+			t.Fatalf("writePrivateFile() error = %v", err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil || string(got) != data {
+			t.Errorf("after writePrivateFile(%q), the file holds %q, %v", data, got, err)
+		}
+	}
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+	if info, err := os.Stat(dir); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("directory mode = %v, %v, want 0700", info.Mode().Perm(), err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("the directory holds %d files, want no temporary file left", len(entries))
+	}
+
+	// A failure leaves no temporary file.
+	if err := writePrivateFile(dir, []byte("x")); err == nil {
+		t.Error("writePrivateFile() over a directory = nil error, want one")
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(dir)); len(entries) != 1 {
+		t.Errorf("a failed write left %d files, want 1", len(entries))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	float := func(f float32) *float32 { return &f }
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   string // In the error, "" for a valid configuration.
+	}{
+		{"default", func(c *Config) {}, ""},
+		{"folder ID without path", func(c *Config) { c.Vault.B3Folder, c.Vault.B3FolderID = "", "1a2b3c" }, ""},
+		{"no B3 folder", func(c *Config) { c.Vault.B3Folder = "" }, "vault.b3_folder: a folder path or a folder ID is required"},
+		{"blank B4 folder", func(c *Config) { c.Vault.B4Folder = " / " }, "vault.b4_folder: a folder path or a folder ID is required"},
+		{"remote redirect", func(c *Config) { c.Auth.RedirectURL = "https://example.com" }, "auth.redirect_url: \"https://example.com\" must be a local http URL with a port"},
+		{"unknown scope", func(c *Config) { c.Auth.Scope = "read" }, "auth.scope:"},
+		{"batch too large", func(c *Config) { c.Drive.BatchSize = 100 }, "drive.batch_size: 100 is out of range [1, 50]"},
+		{"unknown expert", func(c *Config) { c.SetModel("writer", "gemini-2.5-flash") }, "experts.writer: unknown expert, expected one of b3, admin, reader"},
+		{"temperature", func(c *Config) { c.Experts[ExpertB3] = ExpertConfig{Model: "m", Temperature: float(3)} }, "experts.b3.temperature: 3 is out of range [0, 2]"},
+		{"top_k", func(c *Config) { c.Experts[ExpertReader] = ExpertConfig{Model: "m", TopK: float(0)} }, "experts.reader.top_k: 0 must be at least 1"},
+		{"unknown tool", func(c *Config) { c.Tools = []string{"ReadFile", "Teleport"} }, "tools: unknown tool \"Teleport\""},
+		{"safety threshold", func(c *Config) {
+			c.Safety = []SafetyConfig{{Category: "HARM_CATEGORY_HARASSMENT", Threshold: "SOMETIMES"}}
+		}, "safety[0].threshold: \"SOMETIMES\" is not one of"},
+		{"max file below inline", func(c *Config) { c.Analysis.MaxFileMB = 10 }, "analysis.max_file_mb: 10 is out of range [15, 50]"},
+		{"B4 age", func(c *Config) { c.Lint.B4MaxAge = "30 days" }, "lint.b4_max_age: \"30 days\" is not a period, like 10y, 6m, 2w or 90d"},
+		{"expiry", func(c *Config) { c.Expiry.Within = "soon" }, "expiry.within: \"soon\" is not a period"},
+		{"unknown embedder", func(c *Config) { c.Embeddings.Embedder = "word2vec" }, "embeddings.embedder: unknown embedder \"word2vec\""},
+		{"invalid type", func(c *Config) { c.Types = []DocumentType{{}} }, "types[0]:"},
+	}
+	for _, test := range tests {
+		c := DefaultConfig()
+		test.change(c)
+		err := c.Validate()
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%s: Validate() = %v, want no error", test.name, err)
+		case test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)):
+			t.Errorf("%s: Validate() = %v, want an error with %q", test.name, err, test.want)
+		}
+	}
+}
+
+// clearEnv unsets the environment variables read by LoadConfig, and points the default location to a temporary directory.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	for _, key := range []string{
+		"B3_CONFIG", "B3_B3_FOLDER", "B3_B4_FOLDER", "B3_B3_FOLDER_ID", "B3_B4_FOLDER_ID", "B3_SHARED_DRIVE", "B3_CREATE_FOLDERS",
+		"B3_CLIENT_ID", "B3_REDIRECT_URL", "B3_MODEL", "B3_ADMIN_MODEL", "B3_READER_MODEL", "B3_LANGUAGE",
+	} {
+		t.Setenv(key, "")
+	}
+}
+
+// writeConfig writes a configuration file and returns its path.
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	clearEnv(t)
+
+	// Without a file at the default location, the defaults are used.
+	cfg, err := LoadConfig("")
+	if err != nil {
+		t.Fatalf("LoadConfig() without a file = %v", err)
+	}
+	if !reflect.DeepEqual(cfg, DefaultConfig()) {
+		t.Errorf("LoadConfig() without a file = %+v, want the defaults", cfg)
+	}
+
+	// The file is merged on top of the defaults.
+	path := writeConfig(t, `
+vault:
+  b3_folder: Admin/B3
+drive:
+  batch_size: 20
+experts:
+  reader:
+    model: gemini-2.5-flash
+lint:
+  b4_max_age: 2m
+`)
+	cfg, err = LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig(%s) = %v", path, err)
+	}
+	want := DefaultConfig()
+	want.Vault.B3Folder = "Admin/B3"
+	want.Drive.BatchSize = 20
+	want.SetModel(ExpertReader, "gemini-2.5-flash")
+	want.Lint.B4MaxAge = "2m"
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("LoadConfig(%s) = %+v, want %+v", path, cfg, want)
+	}
+
+	// B3_CONFIG locates the file when no path is given.
+	t.Setenv("B3_CONFIG", path)
+	if cfg, err := LoadConfig(""); err != nil || cfg.Vault.B3Folder != "Admin/B3" {
+		t.Errorf("LoadConfig() with B3_CONFIG = %+v, %v, want the file of B3_CONFIG", cfg, err)
+	}
+	t.Setenv("B3_CONFIG", "")
+
+	for _, test := range []struct {
+		name, path, want string
+	}{
+		{"missing explicit file", filepath.Join(t.TempDir(), "missing.yaml"), "failed to read config file"},
+		{"misspelled key", writeConfig(t, "vault:\n  b3_fodler: B3\n"), "invalid config file"},
+		{"invalid value", writeConfig(t, "drive:\n  concurrency: 0\n"), "invalid configuration"},
+	} {
+		if _, err := LoadConfig(test.path); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: LoadConfig() = %v, want an error with %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, `
+vault:
+  b3_folder: File/B3
+  create: true
+language: French
+experts:
+  b3:
+    model: file-model
+`)
+	t.Setenv("B3_B3_FOLDER", "Env/B3")
+	t.Setenv("B3_CREATE_FOLDERS", "0")
+	t.Setenv("B3_MODEL", "env-model")
+	t.Setenv("B3_READER_MODEL", "env-reader")
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"vault.b3_folder", cfg.Vault.B3Folder, "Env/B3"},
+		{"vault.b4_folder", cfg.Vault.B4Folder, "B4"},
+		{"vault.create", cfg.Vault.Create, false},
+		{"language", cfg.Language, "French"},
+		{"b3 model", cfg.Expert(ExpertB3).Model, "env-model"},
+		{"reader model", cfg.Expert(ExpertReader).Model, "env-reader"},
+		{"admin model", cfg.Expert(ExpertAdmin).Model, DefaultConfig().Experts[ExpertAdmin].Model},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s = %v, want %v", test.name, test.got, test.want)
+		}
+	}
+
+	// Flags are applied last, like the -model and -language flags of the command line.
+	cfg.SetModel(ExpertB3, "flag-model")
+	if got := cfg.Expert(ExpertB3).Model; got != "flag-model" {
+		t.Errorf("model after the flag = %q, want flag-model", got)
+	}
+	if got := cfg.Expert(ExpertReader).Model; got != "env-reader" {
+		t.Errorf("reader model after the flag = %q, want env-reader", got)
+	}
+}
@@ -0,0 +1,514 @@
+package b3app
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Kinds of Conflict.
+const (
+	ConflictNameVariant = "name-variant" // The same person written differently.
+	ConflictBirthDate   = "birth-date"   // Different birth dates for the same person.
+	ConflictIdentifier  = "identifier"   // Different values for an identifier of the same person.
+	ConflictAddress     = "address"      // Different addresses at the same time.
+	ConflictDate        = "date"         // Impossible dates.
+)
+
+// personalIdentifiers are the identifier kinds that a person has only one of, for life.
+// Others, like passport numbers, change when a document is renewed.
+var personalIdentifiers = map[string]bool{
+	"tax_id": true, "tax_number": true, "social_security_number": true, "nir": true,
+	"national_insurance_number": true, "ssn": true, "steuer_id": true, "dni": true, "nie": true,
+}
+
+// addressWindow is the time within which two documents of a person should have the same address.
+const addressWindow = 90 * 24 * time.Hour
+
+// maxAge is the age over which a birth date is suspicious.
+const maxAge = 120
+
+// Fact is a value found in a document.
+type Fact struct {
+	Value  string `json:"value"`
+	FileID string `json:"file_id"`
+	File   string `json:"file"`           // Path and name, like "B3/Identity/Passport.pdf".
+	Date   string `json:"date,omitempty"` // The issue date of the document, if known.
+}
+
+// Conflict is an inconsistency between the facts known about a person.
+type Conflict struct {
+	Entity   string   `json:"entity"` // The person, like "Marie Curie".
+	Kind     string   `json:"kind"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	Facts    []Fact   `json:"facts"` // The conflicting values, and the documents they come from.
+}
+
+// person gathers the facts known about a person, across documents.
+type person struct {
+	names       map[string][]Fact // By name as written.
+	birthDates  []Fact
+	addresses   []Fact
+	identifiers map[string][]Fact // By kind.
+	issued      []Fact            // The documents held, with their issue date as value.
+	problems    []Conflict        // The impossible dates in the documents held.
+}
+
+// mention is what a document tells about a person, besides the name.
+type mention struct {
+	birthDate   string
+	identifiers []Identifier
+}
+
+// confirms reports whether the person has the birth date, or one of the identifiers, of the mention.
+func (p *person) confirms(m mention) bool {
+	for _, f := range p.birthDates {
+		if m.birthDate != "" && f.Value == m.birthDate {
+			return true
+		}
+	}
+	for _, id := range m.identifiers {
+		for _, f := range p.identifiers[id.Kind] {
+			if normalizeIdentifier(f.Value) == normalizeIdentifier(id.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nameKey returns the folded words of a name, sorted, so that "CURIE Marie" is "curie marie".
+func nameKey(name string) []string {
+	var words []string
+	for _, t := range tokenize(name) {
+		words = append(words, t.term)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// sameName reports whether two name keys are the same person: same words, one name with extra words,
+// like a middle name, or a single word misspelled.
+// It also reports whether the names differ by a misspelling.
+func sameName(a, b []string) (same, misspelled bool) {
+	if strings.Join(a, " ") == strings.Join(b, " ") {
+		return true, false
+	}
+	common := 0
+	for _, w := range a {
+		for _, v := range b {
+			if w == v {
+				common++
+				break
+			}
+		}
+	}
+	if common >= 2 && (common == len(a) || common == len(b)) {
+		return true, false
+	}
+	if len(a) != len(b) || common != len(a)-1 {
+		return false, false
+	}
+	// The words in a that are not in b, and the reverse.
+	var wa, wb string
+	for _, w := range a {
+		if !contains(b, w) {
+			wa = w
+		}
+	}
+	for _, v := range b {
+		if !contains(a, v) {
+			wb = v
+		}
+	}
+	limit := 1
+	if min(len([]rune(wa)), len([]rune(wb))) >= 6 {
+		limit = 2
+	}
+	if min(len([]rune(wa)), len([]rune(wb))) < 3 {
+		return false, false
+	}
+	d := editDistance(wa, wb)
+	return d <= limit, d <= limit
+}
+
+func contains(words []string, w string) bool {
+	for _, v := range words {
+		if v == w {
+			return true
+		}
+	}
+	return false
+}
+
+// editDistance returns the number of runes to insert, delete, replace or swap with the next one
+// to turn a into b, since swapped letters are a common typo.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+// normalizeIdentifier returns an identifier without spaces nor punctuation, in upper case.
+func normalizeIdentifier(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
+// foldWords returns the folded words of s, so that punctuation, case and accents do not matter.
+func foldWords(s string) string {
+	var words []string
+	for _, t := range tokenize(s) {
+		words = append(words, t.term)
+	}
+	return strings.Join(words, " ")
+}
+
+// CheckConsistency cross-checks the facts known about people in the metadata of the vault files,
+// and in the cached analyses of their content, and returns the conflicts, the most severe first.
+// Birth dates come from the metadata of the holder, and from the analyses for the other people.
+//
+// It works from local data only: the index and the analyses of 'ReadFile' and 'b3 index'.
+func (a *App) CheckConsistency(now time.Time) []Conflict {
+	var people []*person
+	var keys [][]string // The name keys of each person.
+	var conflicts []Conflict
+
+	// find returns the person called name, created if needed, and records the name as written.
+	// A misspelled name is only the same person when the mention confirms it: "Louis Martin" and
+	// "Louise Martin" are likely siblings, unless they share a birth date or an identifier.
+	find := func(name string, fact Fact, m mention) *person {
+		key := nameKey(name)
+		if len(key) == 0 {
+			return nil
+		}
+		for i, k := range keys {
+			if same, misspelled := sameName(k, key); same && (!misspelled || people[i].confirms(m)) {
+				people[i].names[name] = append(people[i].names[name], fact)
+				return people[i]
+			}
+		}
+		p := &person{names: map[string][]Fact{name: {fact}}, identifiers: make(map[string][]Fact)}
+		people, keys = append(people, p), append(keys, key)
+		return p
+	}
+
+	for _, f := range append(a.indexedFiles("B3"), a.indexedFiles("B4")...) {
+		fact := Fact{FileID: f.ID, File: path.Join(f.Path, f.Name)}
+		m := f.Metadata
+		var extraction *Extraction
+		if f.MD5Checksum != "" {
+			if c := loadAnalysis(f.ID, "", a.analysisKey(f.MD5Checksum, "")); c != nil {
+				extraction = c.Extraction
+			}
+		}
+		if m == nil && extraction != nil {
+			m, _ = extraction.Metadata()
+		}
+		if m == nil {
+			continue
+		}
+		fact.Date = m.IssueDate
+
+		// Impossible dates within a document: reported with its holder, once people are known.
+		var problems []Conflict
+		if m.IssueDate != "" && m.ExpiryDate != "" && m.ExpiryDate < m.IssueDate {
+			problems = append(problems, Conflict{Kind: ConflictDate, Severity: SeverityError, Facts: []Fact{withValue(fact, m.ExpiryDate)},
+				Message: fmt.Sprintf("%s expires on %s, before it is issued on %s", fact.File, m.ExpiryDate, m.IssueDate)})
+		}
+		if m.IssueDate > now.Format(dateLayout) {
+			problems = append(problems, Conflict{Kind: ConflictDate, Severity: SeverityError, Facts: []Fact{withValue(fact, m.IssueDate)},
+				Message: fmt.Sprintf("%s is issued in the future, on %s", fact.File, m.IssueDate)})
+		}
+
+		if p := find(m.Holder, fact, mention{birthDate: m.BirthDate, identifiers: m.Identifiers}); p != nil {
+			p.problems = append(p.problems, problems...)
+			if m.BirthDate != "" {
+				p.birthDates = addFact(p.birthDates, withValue(fact, m.BirthDate))
+			}
+			if m.Address != "" {
+				p.addresses = append(p.addresses, withValue(fact, m.Address))
+			}
+			for _, id := range m.Identifiers {
+				p.identifiers[id.Kind] = append(p.identifiers[id.Kind], withValue(fact, id.Value))
+			}
+			if m.IssueDate != "" {
+				p.issued = append(p.issued, withValue(fact, m.IssueDate))
+			}
+		} else {
+			conflicts = append(conflicts, problems...)
+		}
+		if extraction != nil {
+			for _, pp := range extraction.People {
+				if p := find(pp.Name, fact, mention{birthDate: pp.BirthDate}); p != nil && pp.BirthDate != "" {
+					p.birthDates = addFact(p.birthDates, withValue(fact, pp.BirthDate))
+				}
+			}
+		}
+	}
+
+	for _, p := range people {
+		conflicts = append(conflicts, p.check(now)...)
+	}
+	sort.SliceStable(conflicts, func(i, j int) bool {
+		ci, cj := conflicts[i], conflicts[j]
+		if ci.Severity != cj.Severity {
+			return ci.Severity.rank() < cj.Severity.rank()
+		}
+		if ci.Entity != cj.Entity {
+			return ci.Entity < cj.Entity
+		}
+		return ci.Kind < cj.Kind
+	})
+	return conflicts
+}
+
+func withValue(f Fact, value string) Fact {
+	f.Value = value
+	return f
+}
+
+// addFact appends f to facts, unless the same document already gave the same value.
+func addFact(facts []Fact, f Fact) []Fact {
+	for _, g := range facts {
+		if g.FileID == f.FileID && g.Value == f.Value {
+			return facts
+		}
+	}
+	return append(facts, f)
+}
+
+// name returns the most frequent name of the person, written preferably not in capitals.
+func (p *person) name() string {
+	counts := make(map[string]int) // By folded key, to count "CURIE Marie" as "Marie Curie".
+	for n, facts := range p.names {
+		counts[strings.Join(nameKey(n), " ")] += len(facts)
+	}
+	score := func(n string) int {
+		s := 2 * counts[strings.Join(nameKey(n), " ")]
+		for _, w := range strings.Fields(n) {
+			if w == strings.ToUpper(w) {
+				return s
+			}
+		}
+		return s + 1
+	}
+	best := ""
+	for n := range p.names {
+		if best == "" || score(n) > score(best) || (score(n) == score(best) && n < best) {
+			best = n
+		}
+	}
+	return best
+}
+
+// check returns the conflicts between the facts known about the person.
+func (p *person) check(now time.Time) []Conflict {
+	var conflicts []Conflict
+	name := p.name()
+	add := func(kind string, severity Severity, facts []Fact, format string, args ...any) {
+		conflicts = append(conflicts, Conflict{Entity: name, Kind: kind, Severity: severity, Message: fmt.Sprintf(format, args...), Facts: facts})
+	}
+
+	for _, c := range p.problems {
+		c.Entity = name
+		conflicts = append(conflicts, c)
+	}
+
+	// Names: misspellings, and spellings that only differ by accents.
+	var variants []string
+	for n := range p.names {
+		variants = append(variants, n)
+	}
+	sort.Strings(variants)
+	var keys []string
+	spellings := make(map[string][]string) // Names as written by their folded key.
+	for _, v := range variants {
+		key := strings.Join(nameKey(v), " ")
+		if _, ok := spellings[key]; !ok {
+			keys = append(keys, key)
+		}
+		if !containsSpelling(spellings[key], v) {
+			spellings[key] = append(spellings[key], v)
+		}
+	}
+	for i, k := range keys {
+		for _, l := range keys[i+1:] {
+			if _, misspelled := sameName(strings.Fields(k), strings.Fields(l)); misspelled {
+				v, w := spellings[k][0], spellings[l][0]
+				add(ConflictNameVariant, SeverityWarning, append(p.factsNamed(k), p.factsNamed(l)...),
+					"%q and %q are probably the same person, one of them misspelled", v, w)
+			}
+		}
+	}
+	for _, k := range keys {
+		names := spellings[k]
+		if len(names) < 2 {
+			continue
+		}
+		var facts []Fact
+		quoted := make([]string, len(names))
+		for i, n := range names {
+			facts = append(facts, factsOf(p.names[n], n)...)
+			quoted[i] = strconv.Quote(n)
+		}
+		add(ConflictNameVariant, SeverityInfo, facts, "the name is spelled with different accents: %s", strings.Join(quoted, ", "))
+	}
+
+	// Birth dates.
+	if values := distinct(p.birthDates, func(s string) string { return s }); len(values) > 1 {
+		add(ConflictBirthDate, SeverityError, p.birthDates, "%s has %d different birth dates: %s", name, len(values), strings.Join(values, ", "))
+	}
+	if len(p.birthDates) > 0 {
+		birth := p.birthDates[0].Value
+		if birth > now.Format(dateLayout) {
+			add(ConflictDate, SeverityError, p.birthDates[:1], "%s is born in the future, on %s", name, birth)
+		} else if t, err := time.Parse(dateLayout, birth); err == nil && t.AddDate(maxAge, 0, 0).Before(now) {
+			add(ConflictDate, SeverityWarning, p.birthDates[:1], "%s would be more than %d years old, born on %s", name, maxAge, birth)
+		}
+		for _, f := range p.issued {
+			if f.Value < birth {
+				add(ConflictDate, SeverityError, []Fact{p.birthDates[0], f}, "%s is issued on %s, before %s is born on %s", f.File, f.Value, name, birth)
+			}
+		}
+	}
+
+	// Identifiers: one value per person for life, otherwise close values are probably typos.
+	kinds := make([]string, 0, len(p.identifiers))
+	for k := range p.identifiers {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		facts := p.identifiers[kind]
+		values := distinct(facts, normalizeIdentifier)
+		if len(values) < 2 {
+			continue
+		}
+		if personalIdentifiers[kind] {
+			add(ConflictIdentifier, SeverityError, facts, "%s has %d different %s: %s", name, len(values), kind, strings.Join(values, ", "))
+			continue
+		}
+		for i, v := range values {
+			for _, w := range values[i+1:] {
+				if len(v) == len(w) && editDistance(v, w) <= 2 {
+					add(ConflictIdentifier, SeverityWarning, withValues(facts, normalizeIdentifier, v, w),
+						"the %s %s and %s of %s are almost the same, one is probably mistyped", kind, v, w, name)
+				}
+			}
+		}
+	}
+
+	// Addresses: documents issued at about the same time should agree.
+	if values := distinct(p.addresses, foldWords); len(values) > 1 {
+		reported := false
+		for i, f := range p.addresses {
+			for _, g := range p.addresses[i+1:] {
+				if foldWords(f.Value) == foldWords(g.Value) || f.Date == "" || g.Date == "" {
+					continue
+				}
+				tf, err1 := time.Parse(dateLayout, f.Date)
+				tg, err2 := time.Parse(dateLayout, g.Date)
+				if err1 == nil && err2 == nil && (tf.Sub(tg).Abs() <= addressWindow) {
+					add(ConflictAddress, SeverityWarning, []Fact{f, g}, "%s has different addresses on documents issued at the same time", name)
+					reported = true
+				}
+			}
+		}
+		if !reported {
+			add(ConflictAddress, SeverityInfo, p.addresses, "%s has %d addresses across documents, check that the latest is used everywhere", name, len(values))
+		}
+	}
+	return conflicts
+}
+
+// factsNamed returns the facts of the names of the person with the given folded key, with the name as value.
+func (p *person) factsNamed(key string) []Fact {
+	var facts []Fact
+	for n, fs := range p.names {
+		if strings.Join(nameKey(n), " ") == key {
+			facts = append(facts, factsOf(fs, n)...)
+		}
+	}
+	sort.Slice(facts, func(i, j int) bool { return facts[i].File < facts[j].File })
+	return facts
+}
+
+// factsOf returns the facts with the value set.
+func factsOf(facts []Fact, value string) []Fact {
+	out := make([]Fact, len(facts))
+	for i, f := range facts {
+		out[i] = withValue(f, value)
+	}
+	return out
+}
+
+// withValues returns the facts whose normalized value is one of values.
+func withValues(facts []Fact, normalize func(string) string, values ...string) []Fact {
+	var out []Fact
+	for _, f := range facts {
+		if contains(values, normalize(f.Value)) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// distinct returns the distinct normalized values of facts, sorted.
+func distinct(facts []Fact, normalize func(string) string) []string {
+	seen := make(map[string]bool)
+	var values []string
+	for _, f := range facts {
+		v := normalize(f.Value)
+		if v != "" && !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+// containsSpelling reports whether names has a name spelled like name, ignoring case, punctuation and word order.
+func containsSpelling(names []string, name string) bool {
+	spelling := func(s string) string {
+		f := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return !unicode.IsLetter(r) })
+		sort.Strings(f)
+		return strings.Join(f, " ")
+	}
+	for _, n := range names {
+		if spelling(n) == spelling(name) {
+			return true
+		}
+	}
+	return false
+}
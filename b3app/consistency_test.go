@@ -0,0 +1,142 @@
+package b3app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"martin", "martin", 0},
+		{"louis", "louise", 1},   // Insertion.
+		{"martin", "martn", 1},   // Deletion.
+		{"curie", "curia", 1},    // Substitution.
+		{"marie", "maire", 1},    // Swapped letters.
+		{"kitten", "sitting", 3}, // Two substitutions and an insertion.
+		{"élise", "elise", 1},    // Runes, not bytes.
+		{"abcd", "badc", 2},
+	}
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+		if got := editDistance(test.b, test.a); got != test.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", test.b, test.a, got, test.want)
+		}
+	}
+}
+
+func TestSameName(t *testing.T) {
+	tests := []struct {
+		a, b             string
+		same, misspelled bool
+	}{
+		{"Marie Curie", "Marie Curie", true, false},
+		{"CURIE Marie", "Marie Curie", true, false},
+		{"Marie Curie", "Marie Salomea Curie", true, false}, // Middle name.
+		{"Marie Curie", "Marie Cruie", true, true},          // Swapped letters.
+		{"Louis Martin", "Louise Martin", true, true},       // Only told apart by the birth date, see CheckConsistency.
+		{"Christophe Martin", "Christopher Martin", true, true},
+		{"Marie Curie", "Pierre Curie", false, false},
+		{"Marie Curie", "Curie", false, false},    // A single common word is not enough.
+		{"Jo Martin", "Jon Martin", false, false}, // Too short to tell a typo.
+		{"Marie Curie", "Mario Cure", false, false},
+	}
+	for _, test := range tests {
+		same, misspelled := sameName(nameKey(test.a), nameKey(test.b))
+		if same != test.same || misspelled != test.misspelled {
+			t.Errorf("sameName(%q, %q) = %v, %v, want %v, %v", test.a, test.b, same, misspelled, test.same, test.misspelled)
+		}
+	}
+}
+
+func TestCheckConsistencyRelatives(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	doc := func(id, holder, born string, ids ...Identifier) IndexFile {
+		return testFile("b3", id, id+".pdf", &Metadata{DocumentType: "passport", Holder: holder, BirthDate: born, Identifiers: ids})
+	}
+	count := func(conflicts []Conflict, kind string) int {
+		n := 0
+		for _, c := range conflicts {
+			if c.Kind == kind {
+				n++
+			}
+		}
+		return n
+	}
+
+	tests := []struct {
+		name               string
+		files              []IndexFile
+		variants, birthday int
+	}{
+		{
+			name:  "siblings",
+			files: []IndexFile{doc("a", "Louis Martin", "2010-03-04"), doc("b", "Louise Martin", "2012-05-06")},
+		},
+		{
+			name:  "siblings without birth dates",
+			files: []IndexFile{doc("a", "Louis Martin", ""), doc("b", "Louise Martin", "")},
+		},
+		{
+			name:     "typo confirmed by the birth date",
+			files:    []IndexFile{doc("a", "Louis Martin", "2010-03-04"), doc("b", "Luois Martin", "2010-03-04")},
+			variants: 1,
+		},
+		{
+			name:     "typo confirmed by an identifier",
+			files:    []IndexFile{doc("a", "Marie Curie", "", Identifier{"nir", "2 67 11 75 123 456"}), doc("b", "Marie Cruie", "", Identifier{"nir", "267117512345 6"})},
+			variants: 1,
+		},
+		{
+			name:     "different birth dates",
+			files:    []IndexFile{doc("a", "Marie Curie", "1967-11-07"), doc("b", "Marie Curie", "1967-07-11")},
+			birthday: 1,
+		},
+		{
+			name:  "same birth date twice",
+			files: []IndexFile{doc("a", "Marie Curie", "1967-11-07"), doc("b", "CURIE Marie", "1967-11-07")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conflicts := newTestApp(t, test.files...).CheckConsistency(now)
+			if got := count(conflicts, ConflictNameVariant); got != test.variants {
+				t.Errorf("%d name variants, want %d: %+v", got, test.variants, conflicts)
+			}
+			if got := count(conflicts, ConflictBirthDate); got != test.birthday {
+				t.Errorf("%d birth date conflicts, want %d: %+v", got, test.birthday, conflicts)
+			}
+		})
+	}
+}
+
+func TestMetadataBirthDate(t *testing.T) {
+	e := Extraction{People: []ExtractedPerson{
+		{Name: "Marie Martin", Role: "mother", BirthDate: "1980-01-01"},
+		{Name: "Louis Martin", Role: "holder", BirthDate: "2010-03-04"},
+	}}
+	m, _ := e.Metadata()
+	if m.Holder != "Louis Martin" || m.BirthDate != "2010-03-04" {
+		t.Errorf("Metadata() holder = %q born %q, want Louis Martin born 2010-03-04", m.Holder, m.BirthDate)
+	}
+	props, err := m.AppProperties()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := props[propBirthDate]; got != "2010-03-04" {
+		t.Errorf("appProperty %s = %q, want 2010-03-04", propBirthDate, got)
+	}
+	if got := MetadataFromAppProperties(props).BirthDate; got != "2010-03-04" {
+		t.Errorf("BirthDate read back = %q, want 2010-03-04", got)
+	}
+	if err := (&Metadata{BirthDate: "04/03/2010"}).Validate(); err == nil {
+		t.Errorf("Validate() accepted the birth date 04/03/2010")
+	}
+}
@@ -0,0 +1,356 @@
+package b3app
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DocumentType describes a kind of document, like a passport or a payslip.
+//
+// Fields are named after the Metadata JSON fields: "holder", "issuer", "issue_date",
+// "expiry_date", "address", "language", "identifier.<kind>" and "amount.<label>".
+type DocumentType struct {
+	Name     string   `yaml:"name"`     // The Metadata document type, in snake_case, like "passport".
+	Label    string   `yaml:"label"`    // A human readable name, like "Passport".
+	Required []string `yaml:"required"` // Fields every document of this type has.
+	Optional []string `yaml:"optional"` // Fields worth extracting when present.
+	// MaxValidity is the longest period between the issue and the expiry dates, like "10y".
+	MaxValidity string `yaml:"max_validity"`
+	// NamePattern is the file name of such documents, where "{field}" is replaced by
+	// the field value and "{label}" by the Label, like "Passport - {holder} - {expiry_date}".
+	NamePattern string `yaml:"name_pattern"`
+	// Folder is the B3 sub-folder where such documents are filed, like "Identity".
+	Folder string `yaml:"folder"`
+	// RenewalLead is how long before the expiry date the renewal should start, like "3m" for a passport.
+	RenewalLead string `yaml:"renewal_lead"`
+	// NoticePeriod is how long before the expiry date a contract must be terminated, like "2m" for an insurance policy.
+	NoticePeriod string `yaml:"notice_period"`
+}
+
+// builtinTypes is the taxonomy of documents known out of the box.
+// It can be extended, or overridden by name, in the 'types' section of the configuration.
+var builtinTypes = []DocumentType{
+	{
+		Name: "passport", Label: "Passport",
+		Required:    []string{"holder", "issuer", "issue_date", "expiry_date", "identifier.passport_number"},
+		Optional:    []string{"address"},
+		MaxValidity: "10y",
+		NamePattern: "{label} - {holder} - {expiry_date}",
+		Folder:      "Identity",
+		RenewalLead: "4m",
+	},
+	{
+		Name: "national_id", Label: "National ID",
+		Required:    []string{"holder", "issuer", "issue_date", "expiry_date", "identifier.id_number"},
+		Optional:    []string{"address"},
+		MaxValidity: "15y",
+		NamePattern: "{label} - {holder} - {expiry_date}",
+		Folder:      "Identity",
+		RenewalLead: "3m",
+	},
+	{
+		Name: "driving_licence", Label: "Driving licence",
+		Required:    []string{"holder", "issuer", "issue_date", "identifier.licence_number"},
+		Optional:    []string{"expiry_date", "address"},
+		MaxValidity: "15y",
+		NamePattern: "{label} - {holder}",
+		Folder:      "Identity",
+		RenewalLead: "3m",
+	},
+	{
+		Name: "birth_certificate", Label: "Birth certificate",
+		Required:    []string{"holder", "issuer", "issue_date"},
+		Optional:    []string{"identifier.certificate_number"},
+		NamePattern: "{label} - {holder} - {issue_date}",
+		Folder:      "Civil status",
+	},
+	{
+		Name: "diploma", Label: "Diploma",
+		Required:    []string{"holder", "issuer", "issue_date"},
+		NamePattern: "{label} - {holder} - {issuer}",
+		Folder:      "Education",
+	},
+	{
+		Name: "payslip", Label: "Payslip",
+		Required:    []string{"holder", "issuer", "issue_date", "amount.net_salary"},
+		Optional:    []string{"amount.gross_salary", "identifier.social_security_number", "identifier.employee_number"},
+		NamePattern: "{label} - {issuer} - {issue_date}",
+		Folder:      "Income",
+	},
+	{
+		Name: "tax_notice", Label: "Tax notice",
+		Required:    []string{"holder", "issuer", "issue_date"},
+		Optional:    []string{"identifier.tax_id", "amount.total", "address"},
+		NamePattern: "{label} - {holder} - {issue_date}",
+		Folder:      "Taxes",
+	},
+	{
+		Name: "utility_bill", Label: "Utility bill",
+		Required:    []string{"holder", "issuer", "issue_date", "address", "amount.total"},
+		Optional:    []string{"identifier.customer_number", "identifier.contract_number"},
+		NamePattern: "{label} - {issuer} - {issue_date}",
+		Folder:      "Housing",
+	},
+	{
+		Name: "lease", Label: "Lease",
+		Required:     []string{"holder", "issuer", "issue_date", "address"},
+		Optional:     []string{"expiry_date", "amount.monthly_rent", "amount.deposit"},
+		NamePattern:  "{label} - {address}",
+		Folder:       "Housing",
+		RenewalLead:  "3m",
+		NoticePeriod: "3m",
+	},
+	{
+		Name: "insurance_policy", Label: "Insurance policy",
+		Required:     []string{"holder", "issuer", "issue_date", "identifier.policy_number"},
+		Optional:     []string{"expiry_date", "amount.premium"},
+		NamePattern:  "{label} - {issuer} - {identifier.policy_number}",
+		Folder:       "Insurance",
+		RenewalLead:  "1m",
+		NoticePeriod: "2m",
+	},
+	{
+		Name: "vehicle_registration", Label: "Vehicle registration",
+		Required:    []string{"holder", "issuer", "issue_date", "identifier.registration_number"},
+		Optional:    []string{"identifier.vin", "address"},
+		NamePattern: "{label} - {identifier.registration_number}",
+		Folder:      "Vehicles",
+	},
+	{
+		Name: "bank_statement", Label: "Bank statement",
+		Required:    []string{"holder", "issuer", "issue_date", "identifier.iban"},
+		Optional:    []string{"amount.balance"},
+		NamePattern: "{label} - {issuer} - {issue_date}",
+		Folder:      "Banking",
+	},
+}
+
+// placeholder matches the fields of a NamePattern.
+var placeholder = regexp.MustCompile(`\{([a-z0-9_.]+)\}`)
+
+// validate checks the declaration of the document type.
+func (t DocumentType) validate() error {
+	if t.Name == "" || propertyKey(t.Name) != t.Name {
+		return fmt.Errorf("name: %q must be in snake_case, like utility_bill", t.Name)
+	}
+	for _, f := range append(append([]string{}, t.Required...), t.Optional...) {
+		if !isMetadataField(f) {
+			return fmt.Errorf("%s: unknown field %q, expected holder, issuer, issue_date, expiry_date, address, language, identifier.<kind> or amount.<label>", t.Name, f)
+		}
+	}
+	if t.MaxValidity != "" {
+		if _, err := ParsePeriod(t.MaxValidity); err != nil {
+			return fmt.Errorf("%s.max_validity: %w", t.Name, err)
+		}
+	}
+	if t.RenewalLead != "" {
+		if _, err := ParsePeriod(t.RenewalLead); err != nil {
+			return fmt.Errorf("%s.renewal_lead: %w", t.Name, err)
+		}
+	}
+	if t.NoticePeriod != "" {
+		if _, err := ParsePeriod(t.NoticePeriod); err != nil {
+			return fmt.Errorf("%s.notice_period: %w", t.Name, err)
+		}
+	}
+	for _, m := range placeholder.FindAllStringSubmatch(t.NamePattern, -1) {
+		if m[1] != "label" && !isMetadataField(m[1]) {
+			return fmt.Errorf("%s.name_pattern: unknown field {%s}", t.Name, m[1])
+		}
+	}
+	return nil
+}
+
+// isMetadataField reports whether f names a Metadata field.
+func isMetadataField(f string) bool {
+	switch f {
+	case "holder", "issuer", "issue_date", "expiry_date", "address", "language":
+		return true
+	}
+	for _, prefix := range []string{"identifier.", "amount."} {
+		if name, ok := strings.CutPrefix(f, prefix); ok {
+			return name != "" && propertyKey(name) == name
+		}
+	}
+	return false
+}
+
+// field returns the value of the Metadata field f, or "".
+func (m *Metadata) field(f string) string {
+	switch f {
+	case "holder":
+		return m.Holder
+	case "issuer":
+		return m.Issuer
+	case "issue_date":
+		return m.IssueDate
+	case "expiry_date":
+		return m.ExpiryDate
+	case "address":
+		return m.Address
+	case "language":
+		return m.Language
+	}
+	if kind, ok := strings.CutPrefix(f, "identifier."); ok {
+		for _, id := range m.Identifiers {
+			if propertyKey(id.Kind) == kind {
+				return id.Value
+			}
+		}
+	}
+	if label, ok := strings.CutPrefix(f, "amount."); ok {
+		for _, a := range m.Amounts {
+			if propertyKey(a.Label) == label {
+				return strings.TrimSpace(a.Value + " " + a.Currency)
+			}
+		}
+	}
+	return ""
+}
+
+// Check returns the problems of m as a document of this type:
+// missing required fields and broken validity rules.
+func (t DocumentType) Check(m *Metadata, now time.Time) []string {
+	var problems []string
+	for _, f := range t.Required {
+		if m.field(f) == "" {
+			problems = append(problems, fmt.Sprintf("%s is required for a %s", f, t.Label))
+		}
+	}
+	issued, errI := time.Parse(dateLayout, m.IssueDate)
+	expires, errE := time.Parse(dateLayout, m.ExpiryDate)
+	if errI == nil && issued.After(now) {
+		problems = append(problems, fmt.Sprintf("issue_date %s is in the future", m.IssueDate))
+	}
+	if errI == nil && errE == nil {
+		if expires.Before(issued) {
+			problems = append(problems, fmt.Sprintf("expiry_date %s is before issue_date %s", m.ExpiryDate, m.IssueDate))
+		}
+		// A few extra days of tolerance, since some authorities round the validity to the end of the month.
+		if p, err := ParsePeriod(t.MaxValidity); err == nil && expires.After(p.AddTo(issued).AddDate(0, 0, 31)) {
+			problems = append(problems, fmt.Sprintf("a %s is valid at most %s, but it is issued on %s and expires on %s", t.Label, t.MaxValidity, m.IssueDate, m.ExpiryDate))
+		}
+	}
+	return problems
+}
+
+// FileName returns the name of a document of this type, following the NamePattern,
+// or "" if the pattern is empty or a field is missing.
+func (t DocumentType) FileName(m *Metadata) string {
+	if t.NamePattern == "" {
+		return ""
+	}
+	complete := true
+	name := placeholder.ReplaceAllStringFunc(t.NamePattern, func(p string) string {
+		f := strings.Trim(p, "{}")
+		if f == "label" {
+			return t.Label
+		}
+		v := m.field(f)
+		complete = complete && v != ""
+		// Slashes are legal in Drive names, but confusing in vault paths.
+		return strings.ReplaceAll(v, "/", "-")
+	})
+	if !complete {
+		return ""
+	}
+	return name
+}
+
+// Taxonomy returns the document types: the built-in types, overridden and
+// extended by the 'types' section of the configuration.
+func (c *Config) Taxonomy() []DocumentType {
+	types := append([]DocumentType{}, builtinTypes...)
+	for _, u := range c.Types {
+		replaced := false
+		for i, t := range types {
+			if t.Name == u.Name {
+				types[i], replaced = u, true
+			}
+		}
+		if !replaced {
+			types = append(types, u)
+		}
+	}
+	return types
+}
+
+// DocumentType returns the document type called name.
+func (c *Config) DocumentType(name string) (DocumentType, bool) {
+	for _, t := range c.Taxonomy() {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return DocumentType{}, false
+}
+
+// checkMetadata returns the problems of m: identifiers failing their check digits,
+// and the rules of its document type. Unknown document types have no rules.
+func (c *Config) checkMetadata(m *Metadata) []string {
+	problems := m.invalidIdentifiers()
+	if t, ok := c.DocumentType(m.DocumentType); ok {
+		problems = append(problems, t.Check(m, time.Now())...)
+	}
+	return problems
+}
+
+// taxonomyInstruction returns a system prompt section describing the known document types.
+func (c *Config) taxonomyInstruction() string {
+	var b strings.Builder
+	b.WriteString("Known document types (use these names for 'document_type' when they match, or a new snake_case name otherwise):\n")
+	for _, t := range c.Taxonomy() {
+		fmt.Fprintf(&b, "  * %s (%s): requires %s", t.Name, t.Label, strings.Join(t.Required, ", "))
+		if len(t.Optional) > 0 {
+			fmt.Fprintf(&b, "; optionally %s", strings.Join(t.Optional, ", "))
+		}
+		if t.NamePattern != "" {
+			fmt.Fprintf(&b, "; named %q", t.NamePattern)
+		}
+		if t.Folder != "" {
+			fmt.Fprintf(&b, "; filed in B3/%s", t.Folder)
+		}
+		b.WriteString(".\n")
+	}
+	return b.String()
+}
+
+// Period is a calendar duration, like "10y", "6m", "2w" or "90d".
+type Period struct {
+	Years, Months, Days int
+}
+
+// ParsePeriod parses a period made of a number and a unit: y (years), m (months), w (weeks) or d (days).
+func ParsePeriod(s string) (Period, error) {
+	if len(s) < 2 {
+		return Period{}, fmt.Errorf("%q is not a period, like 10y, 6m, 2w or 90d", s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil || n < 0 {
+		return Period{}, fmt.Errorf("%q is not a period, like 10y, 6m, 2w or 90d", s)
+	}
+	switch s[len(s)-1] {
+	case 'y':
+		return Period{Years: n}, nil
+	case 'm':
+		return Period{Months: n}, nil
+	case 'w':
+		return Period{Days: 7 * n}, nil
+	case 'd':
+		return Period{Days: n}, nil
+	}
+	return Period{}, fmt.Errorf("%q is not a period, like 10y, 6m, 2w or 90d", s)
+}
+
+// AddTo returns t plus the period.
+func (p Period) AddTo(t time.Time) time.Time {
+	return t.AddDate(p.Years, p.Months, p.Days)
+}
+
+// SubtractFrom returns t minus the period.
+func (p Period) SubtractFrom(t time.Time) time.Time {
+	return t.AddDate(-p.Years, -p.Months, -p.Days)
+}
@@ -0,0 +1,66 @@
+package b3app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Period
+		wantErr bool
+	}{
+		{"10y", Period{Years: 10}, false},
+		{"6m", Period{Months: 6}, false},
+		{"2w", Period{Days: 14}, false},
+		{"90d", Period{Days: 90}, false},
+		{"0d", Period{}, false},
+		{"120m", Period{Months: 120}, false},
+		{"", Period{}, true},
+		{"d", Period{}, true},
+		{"10", Period{}, true},
+		{"-1y", Period{}, true},
+		{"1.5y", Period{}, true},
+		{"3 m", Period{}, true},
+		{"6M", Period{}, true},
+		{"1h", Period{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePeriod(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParsePeriod(%q) = %+v, %v, want %+v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPeriodAddTo(t *testing.T) {
+	day := func(s string) time.Time {
+		d, err := time.Parse(dateLayout, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	tests := []struct {
+		period, from, added, subtracted string
+	}{
+		{"10y", "2021-03-12", "2031-03-12", "2011-03-12"},
+		{"4m", "2031-03-12", "2031-07-12", "2030-11-12"},
+		{"2w", "2026-12-25", "2027-01-08", "2026-12-11"},
+		{"1m", "2026-03-31", "2026-05-01", "2026-03-03"}, // Like time.AddDate, overflowing days roll over.
+		{"1y", "2024-02-29", "2025-03-01", "2023-03-01"},
+	}
+	for _, tt := range tests {
+		p, err := ParsePeriod(tt.period)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.AddTo(day(tt.from)).Format(dateLayout); got != tt.added {
+			t.Errorf("%s.AddTo(%s) = %s, want %s", tt.period, tt.from, got, tt.added)
+		}
+		if got := p.SubtractFrom(day(tt.from)).Format(dateLayout); got != tt.subtracted {
+			t.Errorf("%s.SubtractFrom(%s) = %s, want %s", tt.period, tt.from, got, tt.subtracted)
+		}
+	}
+}
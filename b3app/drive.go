@@ -2,10 +2,18 @@ package b3app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
 	"os"
+	"path"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/api/drive/v3"
@@ -16,109 +24,410 @@ import (
 type File struct {
 	ID          string    `json:"id"`                    // The unique identifier for the file.
 	Name        string    `json:"name"`                  // The name of the file.
+	Path        string    `json:"path,omitempty"`        // The folder holding the file, like "B3/Car".
+	MimeType    string    `json:"mime_type,omitempty"`   // The MIME type, like "application/pdf".
+	Size        int64     `json:"size,omitempty"`        // The size in bytes, 0 for Google Workspace files.
+	MD5Checksum string    `json:"md5,omitempty"`         // The MD5 of the content, empty for Google Workspace files.
+	Created     time.Time `json:"created"`               // The time the file was created in Drive.
 	Modified    time.Time `json:"modified"`              // The last time the file was modified.
+	Parents     []string  `json:"parents,omitempty"`     // The IDs of the parent folders.
+	Owners      []string  `json:"owners,omitempty"`      // The owners, like "Jane Doe <jane@example.com>". Empty in shared drives.
 	Description string    `json:"description,omitempty"` // The user-provided description of the file.
+	Metadata    *Metadata `json:"metadata,omitempty"`    // The structured knowledge about the document, if any.
 }
 
-// findB3FolderID searches for the "B3" folder in the root of the user's Drive.
-func (a *App) findB3FolderID(ctx context.Context) (string, error) {
-	query := "name = 'B3' and mimeType = 'application/vnd.google-apps.folder' and 'root' in parents and trashed = false"
-	fileList, err := a.DriveService.Files.List().Context(ctx).Q(query).PageSize(1).Fields("files(id)").Do()
-	if err != nil {
-		return "", fmt.Errorf("failed to search for 'B3' folder: %w", err)
+// filesList returns a Files.List call that covers the drive holding the vault.
+func (a *App) filesList(ctx context.Context) *drive.FilesListCall {
+	call := a.DriveService.Files.List().Context(ctx).SupportsAllDrives(true)
+	if a.DriveID != "" {
+		call = call.Corpora("drive").DriveId(a.DriveID).IncludeItemsFromAllDrives(true)
 	}
+	return call
+}
+
+// filesGet returns a Files.Get call that supports shared drives.
+func (a *App) filesGet(ctx context.Context, fileID string) *drive.FilesGetCall {
+	return a.DriveService.Files.Get(fileID).Context(ctx).SupportsAllDrives(true)
+}
+
+// filesUpdate returns a Files.Update call that supports shared drives.
+func (a *App) filesUpdate(ctx context.Context, fileID string, file *drive.File) *drive.FilesUpdateCall {
+	return a.DriveService.Files.Update(fileID, file).Context(ctx).SupportsAllDrives(true)
+}
+
+// filesCreate returns a Files.Create call that supports shared drives.
+func (a *App) filesCreate(ctx context.Context, file *drive.File) *drive.FilesCreateCall {
+	return a.DriveService.Files.Create(file).Context(ctx).SupportsAllDrives(true)
+}
 
-	if len(fileList.Files) == 0 {
-		return "", fmt.Errorf("'B3' folder not found in the root of your Google Drive. Please create it and try again")
+// filesCopy returns a Files.Copy call that supports shared drives.
+func (a *App) filesCopy(ctx context.Context, fileID string, file *drive.File) *drive.FilesCopyCall {
+	return a.DriveService.Files.Copy(fileID, file).Context(ctx).SupportsAllDrives(true)
+}
+
+// filesDelete returns a Files.Delete call that supports shared drives.
+func (a *App) filesDelete(ctx context.Context, fileID string) *drive.FilesDeleteCall {
+	return a.DriveService.Files.Delete(fileID).Context(ctx).SupportsAllDrives(true)
+}
+
+// scopeError decorates err with an explanation when it is likely caused by
+// the restricted ScopeFile rather than by a genuinely missing file.
+func (a *App) scopeError(err error) error {
+	if err == nil || a.Scope != ScopeFile {
+		return err
+	}
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) && (gerr.Code == http.StatusNotFound || gerr.Code == http.StatusForbidden) {
+		return fmt.Errorf("%w (B3 runs with the restricted %q scope and can only access files it created or that were opened with it; run 'b3 -login -scope=%s' to grant full access)", err, ScopeFile, ScopeFull)
 	}
+	return err
+}
 
-	return fileList.Files[0].Id, nil
+// B3Files synchronizes the local index and returns all files within the "B3" folder and its subfolders.
+func (a *App) B3Files(ctx context.Context) ([]File, error) {
+	if _, err := a.Sync(ctx); err != nil {
+		return nil, err
+	}
+	return a.indexedFiles("B3"), nil
 }
 
-// findB4FolderID searches for the "B3" folder in the root of the user's Drive.
-func (a *App) findB4FolderID(ctx context.Context) (string, error) {
-	query := "name = 'B4' and mimeType = 'application/vnd.google-apps.folder' and 'root' in parents and trashed = false"
-	fileList, err := a.DriveService.Files.List().Context(ctx).Q(query).PageSize(1).Fields("files(id)").Do()
-	if err != nil {
-		return "", fmt.Errorf("failed to search for 'B4' folder: %w", err)
+// B4Files synchronizes the local index and returns all files within the "B4" folder and its subfolders.
+func (a *App) B4Files(ctx context.Context) ([]File, error) {
+	if _, err := a.Sync(ctx); err != nil {
+		return nil, err
 	}
+	return a.indexedFiles("B4"), nil
+}
 
-	if len(fileList.Files) == 0 {
-		return "", fmt.Errorf("'B4' folder not found in the root of your Google Drive. Please create it and try again")
+// indexedFiles returns the files of the vault folder role ("B3" or "B4"), from the local index.
+func (a *App) indexedFiles(role string) []File {
+	a.indexMu.Lock()
+	defer a.indexMu.Unlock()
+	if role == "B3" {
+		return a.index.files(a.index.B3FolderID)
 	}
+	return a.index.files(a.index.B4FolderID)
+}
 
-	return fileList.Files[0].Id, nil
+// indexedFile returns the file of the local index with that ID, if the index knows it.
+func (a *App) indexedFile(fileID string) (File, bool) {
+	a.indexMu.Lock()
+	defer a.indexMu.Unlock()
+	if a.index == nil {
+		return File{}, false
+	}
+	f, ok := a.index.Files[fileID]
+	if !ok {
+		return File{}, false
+	}
+	return a.index.file(f), true
 }
 
-// B3Files finds the "B3" folder and recursively lists all files within it and its subfolders.
-func (a *App) B3Files(ctx context.Context) ([]File, error) {
-	b3FolderID, err := a.findB3FolderID(ctx)
+// enteredVault returns when the file entered its vault folder, B3 or B4: when the index saw it enter,
+// or its creation if it was already there when the index was seeded.
+func (a *App) enteredVault(f File) time.Time {
+	a.indexMu.Lock()
+	defer a.indexMu.Unlock()
+	if a.index != nil {
+		if entered := a.index.Files[f.ID].Entered; !entered.IsZero() {
+			return entered
+		}
+	}
+	return f.Created
+}
+
+// ListFiles recursively lists all files within a folder and its subfolders.
+// File paths are relative to the folder, empty for the files directly in it.
+func (a *App) ListFiles(ctx context.Context, folderID string) ([]File, error) {
+	if err := a.checkOnline(); err != nil {
+		return nil, err
+	}
+	var files []File
+	paths := map[string]string{folderID: ""}
+	err := a.walkFolder(ctx, folderID, func(f *drive.File) error {
+		parentPath := ""
+		if len(f.Parents) > 0 {
+			parentPath = paths[f.Parents[0]] // Parents are always visited first.
+		}
+		if f.MimeType == folderMimeType {
+			paths[f.Id] = path.Join(parentPath, f.Name)
+			return nil
+		}
+		file, err := newFile(f)
+		if err != nil {
+			return err
+		}
+		file.Path = parentPath
+		files = append(files, file)
+		return nil
+	})
 	if err != nil {
-		return nil, err // Propagate the clear error message from findB3FolderID
+		return nil, err
 	}
-	return a.ListFiles(ctx, b3FolderID)
+	return files, nil
 }
 
-// B4Files finds the "B4" folder and recursively lists all files within it and its subfolders.
-func (a *App) B4Files(ctx context.Context) ([]File, error) {
-	b4FolderID, err := a.findB4FolderID(ctx)
+// listFields are the Drive fields needed to build a File.
+const listFields = "id, name, mimeType, size, md5Checksum, createdTime, modifiedTime, parents, owners(displayName, emailAddress), description, appProperties, trashed"
+
+// newFile converts a Drive file into a File. The Path is left empty.
+func newFile(f *drive.File) (File, error) {
+	modifiedTime, err := time.Parse(time.RFC3339, f.ModifiedTime)
 	if err != nil {
-		return nil, err // Propagate the clear error message from findB3FolderID
+		return File{}, fmt.Errorf("could not parse modified time for file %s: %w", f.Name, err)
 	}
-	return a.ListFiles(ctx, b4FolderID)
+	var createdTime time.Time
+	if f.CreatedTime != "" {
+		if createdTime, err = time.Parse(time.RFC3339, f.CreatedTime); err != nil {
+			return File{}, fmt.Errorf("could not parse created time for file %s: %w", f.Name, err)
+		}
+	}
+	var owners []string
+	for _, o := range f.Owners {
+		switch {
+		case o.EmailAddress == "":
+			owners = append(owners, o.DisplayName)
+		case o.DisplayName == "":
+			owners = append(owners, o.EmailAddress)
+		default:
+			owners = append(owners, fmt.Sprintf("%s <%s>", o.DisplayName, o.EmailAddress))
+		}
+	}
+	return File{
+		ID:          f.Id,
+		Name:        f.Name,
+		MimeType:    f.MimeType,
+		Size:        f.Size,
+		MD5Checksum: f.Md5Checksum,
+		Created:     createdTime,
+		Modified:    modifiedTime,
+		Parents:     f.Parents,
+		Owners:      owners,
+		Description: f.Description,
+		Metadata:    MetadataFromAppProperties(f.AppProperties),
+	}, nil
 }
 
-func (a *App) ListFiles(ctx context.Context, folderID string) ([]File, error) {
-	var files []File
-	foldersToScan := []string{folderID}
-
-	for len(foldersToScan) > 0 {
-		currentFolderID := foldersToScan[0]
-		foldersToScan = foldersToScan[1:] // Dequeue
-
-		query := fmt.Sprintf("'%s' in parents and trashed = false", currentFolderID)
-
-		err := a.DriveService.Files.List().
-			Q(query).
-			Fields("nextPageToken, files(id, name, mimeType, modifiedTime, description)").
-			Pages(ctx, func(page *drive.FileList) error {
-				for _, f := range page.Files {
-					isFolder := f.MimeType == "application/vnd.google-apps.folder"
-					if isFolder {
-						foldersToScan = append(foldersToScan, f.Id) // Enqueue subfolder for scanning
-						continue
-					}
+// walkFolder visits, breadth-first, all the files and folders within a folder and its subfolders.
+// Visited files carry the listFields.
+//
+// Each level of the tree is listed concurrently by a bounded pool of workers,
+// each querying a batch of folders at once ('a' in parents or 'b' in parents).
+// Files are visited sequentially, level by level, sorted by name and ID, so the
+// visit order does not depend on the scheduling of the workers. The first batch to fail cancels the others.
+func (a *App) walkFolder(ctx context.Context, folderID string, visit func(*drive.File) error) error {
+	concurrency, batchSize := a.Config.Drive.Concurrency, a.Config.Drive.BatchSize
+	level := []string{folderID}
+
+	for len(level) > 0 {
+		// Split the level into batches of folders to query at once.
+		var batches [][]string
+		for len(level) > 0 {
+			n := min(batchSize, len(level))
+			batches = append(batches, level[:n])
+			level = level[n:]
+		}
 
-					modifiedTime, err := time.Parse(time.RFC3339, f.ModifiedTime)
-					if err != nil {
-						return fmt.Errorf("could not parse modified time for file %s: %w", f.Name, err)
+		// The first error cancels the batches still running: the walk fails anyway.
+		batchCtx, cancel := context.WithCancel(ctx)
+		results := make([][]*drive.File, len(batches))
+		var (
+			errMu    sync.Mutex
+			firstErr error
+		)
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for i, batch := range batches {
+			sem <- struct{}{}
+			if batchCtx.Err() != nil {
+				<-sem
+				break
+			}
+			wg.Add(1)
+			go func() {
+				defer func() { <-sem; wg.Done() }()
+				files, err := a.listChildren(batchCtx, batch)
+				if err != nil {
+					errMu.Lock()
+					if firstErr == nil {
+						firstErr = err
+						cancel()
 					}
-					files = append(files, File{
-						ID:          f.Id,
-						Name:        f.Name,
-						Modified:    modifiedTime,
-						Description: f.Description,
-					})
+					errMu.Unlock()
+					return
 				}
-				return nil
-			})
+				results[i] = files
+			}()
+		}
+		wg.Wait()
+		cancel()
+		if firstErr != nil {
+			return firstErr
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var files []*drive.File
+		for _, r := range results {
+			files = append(files, r...)
+		}
+		sort.Slice(files, func(i, j int) bool {
+			if files[i].Name != files[j].Name {
+				return files[i].Name < files[j].Name
+			}
+			return files[i].Id < files[j].Id
+		})
+		for _, f := range files {
+			if f.MimeType == folderMimeType {
+				level = append(level, f.Id) // Scan subfolders in the next level.
+			}
+			if err := visit(f); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// fileLister lists the files matching a Drive query, one page at a time.
+// It is the seam between the walk of the vault and Drive, faked in tests.
+type fileLister interface {
+	// listFiles returns the page of files after pageToken, "" for the first page, with their listFields.
+	listFiles(ctx context.Context, query, pageToken string) (*drive.FileList, error)
+}
+
+// driveLister lists files with the Drive API.
+type driveLister struct{ app *App }
+
+func (l driveLister) listFiles(ctx context.Context, query, pageToken string) (*drive.FileList, error) {
+	return l.app.filesList(ctx).
+		Q(query).
+		PageSize(1000).
+		PageToken(pageToken).
+		Fields(googleapi.Field("nextPageToken, files(" + listFields + ")")).
+		Do()
+}
+
+// lister returns the fileLister of the App: Drive, unless replaced by a fake.
+func (a *App) lister() fileLister {
+	if a.files != nil {
+		return a.files
+	}
+	return driveLister{a}
+}
+
+// listChildren lists, with all their pages, the files and folders directly within any of the folders.
+func (a *App) listChildren(ctx context.Context, folderIDs []string) ([]*drive.File, error) {
+	var clauses []string
+	for _, id := range folderIDs {
+		clauses = append(clauses, fmt.Sprintf("'%s' in parents", escapeQuery(id)))
+	}
+	query := fmt.Sprintf("(%s) and trashed = false", strings.Join(clauses, " or "))
+
+	var files []*drive.File
+	pageToken := ""
+	for {
+		var page *drive.FileList
+		err := retryRateLimited(ctx, func() (err error) {
+			page, err = a.lister().listFiles(ctx, query, pageToken)
+			return err
+		})
 		if err != nil {
-			return nil, fmt.Errorf("failed to list files in folder %s: %w", currentFolderID, err)
+			return nil, fmt.Errorf("failed to list files in folders %s: %w", strings.Join(folderIDs, ", "), err)
+		}
+		files = append(files, page.Files...)
+		if page.NextPageToken == "" {
+			return files, nil
 		}
+		pageToken = page.NextPageToken
 	}
+}
 
-	return files, nil
+// retryDelay is the delay before the first retry of a throttled request.
+var retryDelay = 500 * time.Millisecond
+
+// retryRateLimited calls fn, and calls it again with an exponential backoff
+// while Drive reports that a rate limit is exceeded or that it is unavailable.
+func retryRateLimited(ctx context.Context, fn func() error) error {
+	const attempts = 6
+	delay := retryDelay
+	for i := 1; ; i++ {
+		err := fn()
+		if err == nil || i == attempts || !isRetryable(err) {
+			return err
+		}
+		log.Printf("Drive is throttling requests (%v), retrying in %v", err, delay)
+		// Add some jitter so that concurrent workers do not retry in lockstep.
+		jitter := time.Duration(rand.Int64N(int64(delay) / 2))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay + jitter):
+		}
+		delay *= 2
+	}
+}
+
+// isRetryable reports whether err is a transient Drive error: a rate limit, or a server error.
+func isRetryable(err error) bool {
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) {
+		return false
+	}
+	switch {
+	case gerr.Code == http.StatusTooManyRequests, gerr.Code >= 500:
+		return true
+	case gerr.Code == http.StatusForbidden:
+		for _, e := range gerr.Errors {
+			if e.Reason == "rateLimitExceeded" || e.Reason == "userRateLimitExceeded" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// googleAppsPrefix starts the MIME types of Google Workspace files, which have no content to download.
+const googleAppsPrefix = "application/vnd.google-apps."
+
+// exportFormats are the formats Google Workspace files are exported to when their content is read,
+// by Google Workspace MIME type: formats that the models and pdfcpu read.
+var exportFormats = map[string]string{
+	"application/vnd.google-apps.document":     "application/pdf",
+	"application/vnd.google-apps.presentation": "application/pdf",
+	"application/vnd.google-apps.spreadsheet":  "text/csv", // The first sheet only.
+	"application/vnd.google-apps.drawing":      "image/png",
 }
 
-// GetFileContent downloads and returns the content of a specific file.
+// GetFileContent downloads and returns the content of a specific file, and its MIME type.
+// Google Workspace files, like Google Docs, are exported to the format of exportFormats,
+// and the MIME type returned is the exported one.
+// Offline, it returns the content of the local copy, if any.
 func (a *App) GetFileContent(ctx context.Context, fileID string) ([]byte, string, error) {
+	if a.Offline {
+		return readPinnedContent(fileID)
+	}
 	// First, get file metadata to retrieve the MIME type.
-	file, err := a.DriveService.Files.Get(fileID).Fields("mimeType").Do()
+	file, err := a.filesGet(ctx, fileID).Fields("mimeType").Do()
 	if err != nil {
-		return nil, "", fmt.Errorf("unable to get file metadata for %s: %w", fileID, err)
+		return nil, "", fmt.Errorf("unable to get file metadata for %s: %w", fileID, a.scopeError(err))
 	}
 
-	resp, err := a.DriveService.Files.Get(fileID).Download()
+	if strings.HasPrefix(file.MimeType, googleAppsPrefix) {
+		format, ok := exportFormats[file.MimeType]
+		if !ok {
+			return nil, "", fmt.Errorf("file %s is a %s, which has no content that can be read", fileID, strings.TrimPrefix(file.MimeType, googleAppsPrefix))
+		}
+		content, err := a.ExportFile(ctx, fileID, format)
+		if err != nil {
+			return nil, "", err
+		}
+		return content, format, nil
+	}
+
+	resp, err := a.filesGet(ctx, fileID).Download()
 	if err != nil {
 		return nil, "", fmt.Errorf("unable to download file %s: %w", fileID, err)
 	}
@@ -131,9 +440,12 @@ func (a *App) GetFileContent(ctx context.Context, fileID string) ([]byte, string
 	return content, file.MimeType, nil
 }
 
-// UpdateFile updates the metadata (name and/or description) of a specific file.
-// Pass an empty string for a field if you don't want to update it.
-func (a *App) UpdateFile(ctx context.Context, fileID, newName, newDescription string, archive bool) error {
+// UpdateFile updates the metadata (name, description and/or structured Metadata) of a specific file.
+// Pass an empty string, or nil, for a field if you don't want to update it.
+func (a *App) UpdateFile(ctx context.Context, fileID, newName, newDescription string, metadata *Metadata, archive bool) error {
+	if err := a.checkOnline(); err != nil {
+		return err
+	}
 	fileToUpdate := &drive.File{}
 	var fieldsToUpdate []googleapi.Field
 
@@ -141,28 +453,59 @@ func (a *App) UpdateFile(ctx context.Context, fileID, newName, newDescription st
 		fileToUpdate.Name = newName
 		fieldsToUpdate = append(fieldsToUpdate, "name")
 	}
-	if newDescription != "" {
-		fileToUpdate.Description = newDescription
-		fieldsToUpdate = append(fieldsToUpdate, "description")
+	if newDescription != "" && metadata == nil {
+		// Keep the mirror of the current metadata, if any, at the end of the new description.
+		current, err := a.filesGet(ctx, fileID).Fields("appProperties").Do()
+		if err != nil {
+			return fmt.Errorf("unable to get metadata for file %s: %w", fileID, a.scopeError(err))
+		}
+		if metadata = MetadataFromAppProperties(current.AppProperties); metadata == nil {
+			fileToUpdate.Description = newDescription
+			fieldsToUpdate = append(fieldsToUpdate, "description")
+		}
 	}
 
-	if len(fieldsToUpdate) == 0 {
-		return nil // Nothing to update
+	if metadata != nil {
+		// The description is updated along with its mirror of the metadata.
+		if err := a.SetMetadata(ctx, fileID, metadata, newDescription); err != nil {
+			return err
+		}
 	}
 
-	if _, err := a.DriveService.Files.Update(fileID, fileToUpdate).Fields(fieldsToUpdate...).Do(); err != nil {
-		return fmt.Errorf("failed to update metadata for file %s: %w", fileID, err)
+	if len(fieldsToUpdate) > 0 {
+		if _, err := a.filesUpdate(ctx, fileID, fileToUpdate).Fields(fieldsToUpdate...).Do(); err != nil {
+			return fmt.Errorf("failed to update metadata for file %s: %w", fileID, a.scopeError(err))
+		}
 	}
 
 	if archive {
-		return a.MoveToB3(ctx, fileID)
+		// The file is filed in the folder of its document type.
+		if metadata == nil {
+			current, err := a.filesGet(ctx, fileID).Fields("appProperties").Do()
+			if err != nil {
+				return fmt.Errorf("unable to get metadata for file %s: %w", fileID, a.scopeError(err))
+			}
+			metadata = MetadataFromAppProperties(current.AppProperties)
+		}
+		folder := ""
+		if metadata != nil {
+			if t, ok := a.Config.DocumentType(metadata.DocumentType); ok {
+				folder = t.Folder
+			}
+		}
+		return a.MoveToB3(ctx, fileID, folder)
 	}
 
 	return nil
 }
 
-// MoveToB3 moves a file to the B3 folder, if it's not already there.
-func (a *App) MoveToB3(ctx context.Context, fileID string) error {
+// MoveToB3 moves a file to the B3 folder, in its subfolder at path if set, like "Housing".
+// The subfolder is created if the configuration allows it (vault.create), otherwise the file goes to the B3 folder itself.
+// A file already in B3 is only moved to the subfolder at path: without one, it stays where it is.
+func (a *App) MoveToB3(ctx context.Context, fileID, path string) error {
+	if err := a.checkOnline(); err != nil {
+		return err
+	}
 	b3FolderID, err := a.findB3FolderID(ctx)
 	if err != nil {
 		return err
@@ -171,35 +514,52 @@ func (a *App) MoveToB3(ctx context.Context, fileID string) error {
 	// Check if the file is already in the B3 folder hierarchy.
 	inB3, err := a.isFileInFolder(ctx, fileID, b3FolderID)
 	if err != nil {
-		return fmt.Errorf("could not verify if file %s is in B3 folder: %w", fileID, err)
+		return fmt.Errorf("could not verify if file %s is in B3 folder: %w", fileID, a.scopeError(err))
+	}
+	if inB3 && path == "" {
+		return nil // Already in B3, and no subfolder to file it in.
 	}
-	if inB3 {
-		return nil // Already in B3, do nothing.
+	targetID := b3FolderID
+	if path != "" {
+		if targetID, err = a.findSubfolder(ctx, b3FolderID, "B3", path); err != nil {
+			if inB3 {
+				log.Printf("warning: could not file %s in B3/%s, leaving it where it is: %v", fileID, path, err)
+				return nil
+			}
+			log.Printf("warning: could not file %s in B3/%s, moving it to B3: %v", fileID, path, err)
+			targetID = b3FolderID
+		}
 	}
 
 	// Get the file's current parents to remove them.
-	file, err := a.DriveService.Files.Get(fileID).Fields("parents").Do()
+	file, err := a.filesGet(ctx, fileID).Fields("parents").Do()
 	if err != nil {
-		return fmt.Errorf("unable to get parents for file %s: %w", fileID, err)
+		return fmt.Errorf("unable to get parents for file %s: %w", fileID, a.scopeError(err))
+	}
+	if slices.Contains(file.Parents, targetID) {
+		return nil // Already filed.
 	}
 
 	if len(file.Parents) == 0 {
 		// File is in root, just add it to B3.
-		_, err = a.DriveService.Files.Update(fileID, &drive.File{}).AddParents(b3FolderID).Context(ctx).Do()
+		_, err = a.filesUpdate(ctx, fileID, &drive.File{}).AddParents(targetID).Do()
 		return err
 	}
 
 	// Move the file by adding it to B3 and removing it from its old parents.
-	_, err = a.DriveService.Files.Update(fileID, &drive.File{}).
-		AddParents(b3FolderID).
+	_, err = a.filesUpdate(ctx, fileID, &drive.File{}).
+		AddParents(targetID).
 		RemoveParents(strings.Join(file.Parents, ",")).
-		Context(ctx).Do()
+		Do()
 
 	return err
 }
 
 // CreateFile uploads a new file to Google Drive.
 func (a *App) CreateFile(ctx context.Context, name, description, mimeType, parentID string, content io.Reader) (*File, error) {
+	if err := a.checkOnline(); err != nil {
+		return nil, err
+	}
 	driveFile := &drive.File{
 		Name:        name,
 		Description: description,
@@ -207,7 +567,7 @@ func (a *App) CreateFile(ctx context.Context, name, description, mimeType, paren
 		Parents:     []string{parentID},
 	}
 
-	createdFile, err := a.DriveService.Files.Create(driveFile).Context(ctx).Media(content).Do()
+	createdFile, err := a.filesCreate(ctx, driveFile).Media(content).Do()
 	if err != nil {
 		return nil, fmt.Errorf("could not create file '%s': %w", name, err)
 	}
@@ -232,9 +592,12 @@ func (a *App) uploadLocalFile(ctx context.Context, localPath, name, description,
 
 // ExportFile downloads a Google Workspace document (like a Google Doc) by exporting it to a specified MIME type.
 func (a *App) ExportFile(ctx context.Context, fileID, mimeType string) ([]byte, error) {
-	resp, err := a.DriveService.Files.Export(fileID, mimeType).Download()
+	if err := a.checkOnline(); err != nil {
+		return nil, err
+	}
+	resp, err := a.DriveService.Files.Export(fileID, mimeType).Context(ctx).Download()
 	if err != nil {
-		return nil, fmt.Errorf("unable to export file %s to %s: %w", fileID, mimeType, err)
+		return nil, fmt.Errorf("unable to export file %s to %s: %w", fileID, mimeType, a.scopeError(err))
 	}
 	defer resp.Body.Close()
 
@@ -248,7 +611,7 @@ func (a *App) ExportFile(ctx context.Context, fileID, mimeType string) ([]byte,
 
 // isFileInFolder checks if a file is a descendant of a specific folder.
 func (a *App) isFileInFolder(ctx context.Context, fileID, folderID string) (bool, error) {
-	file, err := a.DriveService.Files.Get(fileID).Fields("parents").Do()
+	file, err := a.filesGet(ctx, fileID).Fields("parents").Do()
 	if err != nil {
 		return false, fmt.Errorf("unable to get file metadata for %s: %w", fileID, err)
 	}
@@ -269,6 +632,9 @@ func (a *App) isFileInFolder(ctx context.Context, fileID, folderID string) (bool
 
 // DeleteFile permanently deletes a file from Google Drive, but only if it's in the B4 folder.
 func (a *App) DeleteFile(ctx context.Context, fileID string) error {
+	if err := a.checkOnline(); err != nil {
+		return err
+	}
 	b4FolderID, err := a.findB4FolderID(ctx)
 	if err != nil {
 		return err
@@ -276,25 +642,50 @@ func (a *App) DeleteFile(ctx context.Context, fileID string) error {
 
 	isSafeToDelete, err := a.isFileInFolder(ctx, fileID, b4FolderID)
 	if err != nil {
-		return fmt.Errorf("could not verify file location for deletion: %w", err)
+		return fmt.Errorf("could not verify file location for deletion: %w", a.scopeError(err))
 	}
 
 	if !isSafeToDelete {
 		return fmt.Errorf("safety check failed: file %s is not in the B4 folder and will not be deleted", fileID)
 	}
 
-	err = a.DriveService.Files.Delete(fileID).Do()
+	return a.removeFile(ctx, fileID)
+}
+
+// removeFile deletes a file, following the semantics of the drive it lives in.
+//
+// In a shared drive, permanently deleting a file requires the organizer role,
+// so the file is moved to the shared drive trash instead, where it is purged
+// after 30 days.
+func (a *App) removeFile(ctx context.Context, fileID string) error {
+	if a.DriveID == "" {
+		if err := a.filesDelete(ctx, fileID).Do(); err != nil {
+			return fmt.Errorf("failed to delete file with ID %s: %w", fileID, a.scopeError(err))
+		}
+		return nil
+	}
+
+	file, err := a.filesGet(ctx, fileID).Fields("capabilities(canTrash)").Do()
 	if err != nil {
-		return fmt.Errorf("failed to delete file with ID %s: %w", fileID, err)
+		return fmt.Errorf("unable to get capabilities for file %s: %w", fileID, a.scopeError(err))
+	}
+	if file.Capabilities == nil || !file.Capabilities.CanTrash {
+		return fmt.Errorf("your role on the shared drive does not allow moving file %s to the trash", fileID)
+	}
+	if _, err := a.filesUpdate(ctx, fileID, &drive.File{Trashed: true}).Do(); err != nil {
+		return fmt.Errorf("failed to move file with ID %s to the shared drive trash: %w", fileID, err)
 	}
 	return nil
 }
 
 // UpdateFileContent updates the content of a specific file.
 func (a *App) UpdateFileContent(ctx context.Context, fileID, mimeType string, content io.Reader) (*File, error) {
-	updatedFile, err := a.DriveService.Files.Update(fileID, &drive.File{MimeType: mimeType}).Context(ctx).Media(content).Fields("id", "name").Do()
+	if err := a.checkOnline(); err != nil {
+		return nil, err
+	}
+	updatedFile, err := a.filesUpdate(ctx, fileID, &drive.File{MimeType: mimeType}).Media(content).Fields("id", "name").Do()
 	if err != nil {
-		return nil, fmt.Errorf("could not update file '%s': %w", fileID, err)
+		return nil, fmt.Errorf("could not update file '%s': %w", fileID, a.scopeError(err))
 	}
 
 	return &File{ID: updatedFile.Id, Name: updatedFile.Name}, nil
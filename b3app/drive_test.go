@@ -0,0 +1,196 @@
+package b3app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// fakeDrive is a tree of files answering the queries of listChildren.
+type fakeDrive struct {
+	children map[string][]*drive.File // By parent ID, in no particular order.
+	pageSize int
+	latency  time.Duration // Of every request, like a network round trip.
+
+	mu        sync.Mutex
+	calls     int
+	throttled int              // Number of requests to answer with a rate limit error.
+	fail      map[string]error // Errors returned when listing a folder.
+	block     map[string]bool  // Folders whose listing waits until canceled.
+}
+
+var parentClause = regexp.MustCompile(`'([^']*)' in parents`)
+
+func (d *fakeDrive) listFiles(ctx context.Context, query, pageToken string) (*drive.FileList, error) {
+	d.mu.Lock()
+	d.calls++
+	throttled := d.throttled > 0
+	if throttled {
+		d.throttled--
+	}
+	d.mu.Unlock()
+	if throttled {
+		return nil, &googleapi.Error{Code: http.StatusTooManyRequests, Message: "rate limit exceeded"}
+	}
+	if d.latency > 0 {
+		time.Sleep(d.latency)
+	}
+
+	var files []*drive.File
+	for _, m := range parentClause.FindAllStringSubmatch(query, -1) {
+		parent := m[1]
+		if err := d.fail[parent]; err != nil {
+			return nil, err
+		}
+		if d.block[parent] {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		files = append(files, d.children[parent]...)
+	}
+	start, _ := strconv.Atoi(pageToken)
+	end := min(start+d.pageSize, len(files))
+	page := &drive.FileList{Files: files[start:end]}
+	if end < len(files) {
+		page.NextPageToken = strconv.Itoa(end)
+	}
+	return page, nil
+}
+
+// newFakeDrive returns a tree of the given depth under "root", each folder holding width subfolders and width files.
+func newFakeDrive(depth, width int) *fakeDrive {
+	d := &fakeDrive{children: make(map[string][]*drive.File), pageSize: 3}
+	var fill func(parent string, depth int)
+	fill = func(parent string, depth int) {
+		// Listed in reverse, so that the order of the walk comes from its sort.
+		for i := width - 1; i >= 0; i-- {
+			d.children[parent] = append(d.children[parent], &drive.File{Id: fmt.Sprintf("%s/f%d", parent, i), Name: fmt.Sprintf("file %d", i)})
+			if depth > 0 {
+				id := fmt.Sprintf("%s/d%d", parent, i)
+				d.children[parent] = append(d.children[parent], &drive.File{Id: id, Name: fmt.Sprintf("folder %d", i), MimeType: folderMimeType})
+				fill(id, depth-1)
+			}
+		}
+	}
+	fill("root", depth)
+	return d
+}
+
+func newWalkApp(d *fakeDrive, concurrency, batchSize int) *App {
+	return &App{Config: &Config{Drive: DriveConfig{Concurrency: concurrency, BatchSize: batchSize}}, files: d}
+}
+
+func walkIDs(t testing.TB, a *App) []string {
+	t.Helper()
+	var ids []string
+	if err := a.walkFolder(context.Background(), "root", func(f *drive.File) error {
+		ids = append(ids, f.Id)
+		return nil
+	}); err != nil {
+		t.Fatalf("walkFolder() error = %v", err)
+	}
+	return ids
+}
+
+func TestWalkFolderOrder(t *testing.T) {
+	want := walkIDs(t, newWalkApp(newFakeDrive(3, 3), 1, 1))
+	if len(want) != 6+9*2+27*2+27*3 {
+		t.Fatalf("walkFolder() visited %d files, want %d", len(want), 6+9*2+27*2+27*3)
+	}
+	// Level by level, sorted by name then ID.
+	if want[0] != "root/f0" || want[3] != "root/d0" || want[6] != "root/d0/f0" {
+		t.Errorf("walkFolder() starts with %v", want[:6])
+	}
+	for _, tt := range []struct{ concurrency, batchSize int }{{4, 1}, {4, 2}, {8, 10}, {2, 100}} {
+		for run := 0; run < 5; run++ {
+			d := newFakeDrive(3, 3)
+			d.latency = time.Duration(run) * 100 * time.Microsecond
+			got := walkIDs(t, newWalkApp(d, tt.concurrency, tt.batchSize))
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("concurrency %d, batch size %d: walkFolder() order = %v, want %v", tt.concurrency, tt.batchSize, got, want)
+			}
+		}
+	}
+}
+
+func TestWalkFolderRetriesRateLimits(t *testing.T) {
+	defer func(d time.Duration) { retryDelay = d }(retryDelay)
+	retryDelay = time.Millisecond
+
+	d := newFakeDrive(1, 2)
+	d.throttled = 3
+	got := walkIDs(t, newWalkApp(d, 2, 1))
+	if len(got) != 8 {
+		t.Errorf("walkFolder() visited %v, want 8 files", got)
+	}
+	if d.calls < 3+3 {
+		t.Errorf("walkFolder() made %d requests, want the 3 throttled ones retried", d.calls)
+	}
+}
+
+func TestWalkFolderErrorCancelsOtherBatches(t *testing.T) {
+	d := newFakeDrive(1, 3)
+	failure := &googleapi.Error{Code: http.StatusNotFound, Message: "not found"}
+	d.fail = map[string]error{"root/d0": failure}
+	d.block = map[string]bool{"root/d1": true, "root/d2": true}
+
+	done := make(chan error)
+	go func() {
+		done <- newWalkApp(d, 3, 1).walkFolder(context.Background(), "root", func(*drive.File) error { return nil })
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, failure) {
+			t.Errorf("walkFolder() error = %v, want %v", err, failure)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("walkFolder() waits for the other batches after an error")
+	}
+}
+
+func TestWalkFolderVisitError(t *testing.T) {
+	stop := errors.New("stop")
+	var visited atomic.Int32
+	err := newWalkApp(newFakeDrive(2, 2), 2, 1).walkFolder(context.Background(), "root", func(*drive.File) error {
+		if visited.Add(1) == 3 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || visited.Load() != 3 {
+		t.Errorf("walkFolder() = %v after %d visits, want %v after 3", err, visited.Load(), stop)
+	}
+}
+
+// BenchmarkWalkFolder compares the walk one folder at a time, as a plain breadth-first search,
+// with concurrent batches, on a Drive answering in 2ms.
+func BenchmarkWalkFolder(b *testing.B) {
+	for _, bb := range []struct {
+		name                   string
+		concurrency, batchSize int
+	}{
+		{"sequential", 1, 1},
+		{"batched", 1, 10},
+		{"concurrent", 4, 1},
+		{"default", 4, 10},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			d := newFakeDrive(3, 4)
+			d.pageSize, d.latency = 1000, 2*time.Millisecond
+			a := newWalkApp(d, bb.concurrency, bb.batchSize)
+			for b.Loop() {
+				walkIDs(b, a)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package b3app
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Statuses of an Expiration.
+const (
+	StatusExpired  = "expired"  // The expiry date is past.
+	StatusRenewNow = "renew"    // The renewal should have started: the expiry date is closer than the lead time.
+	StatusUpcoming = "upcoming" // The renewal starts within the period asked for.
+	StatusNotice   = "notice"   // The last day to terminate the contract, before it renews, is within the period asked for.
+)
+
+// obsoleteAfter is how long after its expiry a document is considered obsolete, rather than to be renewed.
+const obsoleteAfter = 365 * 24 * time.Hour
+
+// Expiration is a document to renew.
+type Expiration struct {
+	File       File   `json:"file"`
+	Label      string `json:"label"` // The document type, like "Passport", or the file name.
+	Holder     string `json:"holder,omitempty"`
+	ExpiryDate string `json:"expiry_date"`
+	RenewBy    string `json:"renew_by"` // The expiry date minus the renewal lead time of the document type.
+	// NoticeBy is the last day to terminate a contract before it renews, if its document type has a notice period.
+	NoticeBy string `json:"notice_by,omitempty"`
+	DaysLeft int    `json:"days_left"` // Until the expiry date, negative once expired.
+	Status   string `json:"status"`
+	// FromDescription is set when the expiry date was read in the description, for lack of metadata.
+	FromDescription bool `json:"from_description,omitempty"`
+}
+
+// expiryKeyword matches the words introducing an expiry date in a description, in the languages of the vault.
+var expiryKeyword = regexp.MustCompile(`(?i)expir|valid (until|till|through)|valable jusqu|fin de validit|g(ü|u)ltig bis|caducidad|v(á|a)lido hasta|scadenza`)
+
+// isoDate and europeanDate match the dates of a description: YYYY-MM-DD, or DD/MM/YYYY and DD.MM.YYYY.
+var (
+	isoDate      = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`)
+	europeanDate = regexp.MustCompile(`\b(\d{1,2})[./](\d{1,2})[./](\d{4})\b`)
+)
+
+// descriptionExpiry returns the expiry date written in a description, as YYYY-MM-DD, or "".
+// It is the first date on a line mentioning an expiry, like "Valid until 12/03/2031".
+func descriptionExpiry(description string) string {
+	for _, line := range strings.Split(description, "\n") {
+		loc := expiryKeyword.FindStringIndex(line)
+		if loc == nil {
+			continue
+		}
+		rest := line[loc[0]:]
+		if m := isoDate.FindStringSubmatch(rest); m != nil && isDate(m[0]) {
+			return m[0]
+		}
+		if m := europeanDate.FindStringSubmatch(rest); m != nil {
+			day, _ := strconv.Atoi(m[1])
+			month, _ := strconv.Atoi(m[2])
+			d := fmt.Sprintf("%s-%02d-%02d", m[3], month, day)
+			if isDate(d) {
+				return d
+			}
+		}
+	}
+	return ""
+}
+
+// Expiring returns the documents of the vault to renew within the period: those whose renewal,
+// started the lead time of their document type before the expiry date, is due by then,
+// and the contracts whose last day to give notice is within the period, with StatusNotice.
+// The most urgent come first.
+func (a *App) Expiring(now time.Time, within Period) []Expiration {
+	today, horizon := now.Format(dateLayout), within.AddTo(now).Format(dateLayout)
+	var expiring []Expiration
+	for _, e := range a.expirations(now) {
+		// A notice period may be longer than the renewal lead time: the notice comes first then.
+		notice := e.Status != StatusExpired && e.NoticeBy != "" && e.NoticeBy >= today && e.NoticeBy <= horizon
+		if notice {
+			e.Status = StatusNotice
+		}
+		if notice || e.RenewBy <= horizon {
+			expiring = append(expiring, e)
+		}
+	}
+	sort.SliceStable(expiring, func(i, j int) bool {
+		if expiring[i].Deadline() != expiring[j].Deadline() {
+			return expiring[i].Deadline() < expiring[j].Deadline()
+		}
+		return expiring[i].ExpiryDate < expiring[j].ExpiryDate
+	})
+	return expiring
+}
+
+// Deadline returns the date to act by: the last day to give notice for StatusNotice, the renewal date otherwise.
+func (e Expiration) Deadline() string {
+	if e.Status == StatusNotice {
+		return e.NoticeBy
+	}
+	return e.RenewBy
+}
+
+// expirations returns the expiration of every document of the vault with an expiry date,
+// unless replaced by a newer one of the same type and holder, or expired for more than a year.
+func (a *App) expirations(now time.Time) []Expiration {
+	today := now.Format(dateLayout)
+	midnight, _ := time.Parse(dateLayout, today)
+
+	var all []Expiration
+	for _, f := range append(a.indexedFiles("B3"), a.indexedFiles("B4")...) {
+		e := Expiration{File: f, Label: strings.TrimSuffix(f.Name, path.Ext(f.Name))}
+		var lead, notice Period
+		if m := f.Metadata; m != nil {
+			e.ExpiryDate, e.Holder = m.ExpiryDate, m.Holder
+			if t, ok := a.Config.DocumentType(m.DocumentType); ok {
+				e.Label = t.Label
+				lead, _ = ParsePeriod(t.RenewalLead)
+				notice, _ = ParsePeriod(t.NoticePeriod)
+			}
+		}
+		if e.ExpiryDate == "" {
+			e.ExpiryDate, e.FromDescription = descriptionExpiry(f.Description), true
+		}
+		expiry, err := time.Parse(dateLayout, e.ExpiryDate)
+		if err != nil {
+			continue
+		}
+		e.RenewBy = lead.SubtractFrom(expiry).Format(dateLayout)
+		if notice != (Period{}) {
+			e.NoticeBy = notice.SubtractFrom(expiry).Format(dateLayout)
+		}
+		e.DaysLeft = int(expiry.Sub(midnight).Hours() / 24)
+		switch {
+		case e.ExpiryDate < today:
+			e.Status = StatusExpired
+		case e.RenewBy <= today:
+			e.Status = StatusRenewNow
+		default:
+			e.Status = StatusUpcoming
+		}
+		all = append(all, e)
+	}
+
+	// Only the latest document of a type and holder is to be renewed: the others were renewed already.
+	latest := make(map[string]string)
+	key := func(e Expiration) string {
+		if e.File.Metadata == nil || e.File.Metadata.DocumentType == "" || e.Holder == "" {
+			return e.File.ID
+		}
+		return e.File.Metadata.DocumentType + "/" + strings.Join(nameKey(e.Holder), " ")
+	}
+	for _, e := range all {
+		if k := key(e); e.ExpiryDate > latest[k] {
+			latest[k] = e.ExpiryDate
+		}
+	}
+
+	var current []Expiration
+	for _, e := range all {
+		if e.ExpiryDate != latest[key(e)] {
+			continue
+		}
+		if expiry, _ := time.Parse(dateLayout, e.ExpiryDate); now.Sub(expiry) > obsoleteAfter {
+			continue
+		}
+		current = append(current, e)
+	}
+	return current
+}
+
+// expirationsPrompt returns the part of the B3 system prompt listing the documents to renew soon, or "".
+func expirationsPrompt(app *App) string {
+	within, err := ParsePeriod(app.Config.Expiry.Within)
+	if err != nil {
+		return ""
+	}
+	expiring := app.Expiring(time.Now(), within)
+	if len(expiring) == 0 {
+		return ""
+	}
+	p := fmt.Sprintf(`
+DOCUMENTS TO RENEW:
+These documents expire, or must be renewed, within %s. Mention them briefly when greeting the user,
+with the time left, and offer to prepare the renewal.
+`, app.Config.Expiry.Within)
+	for _, e := range expiring {
+		p += fmt.Sprintf("  * %s: %s/%s (ID %s), %s\n", e.Status, e.File.Path, e.File.Name, e.File.ID, e.Summary())
+	}
+	return p
+}
+
+// Summary describes the expiration in a few words, like "Passport of Marie Curie, expires on 2031-03-12 (in 42 days), renew by 2030-12-12".
+func (e Expiration) Summary() string {
+	s := e.Label
+	if e.Holder != "" {
+		s += " of " + e.Holder
+	}
+	if e.DaysLeft < 0 {
+		s += fmt.Sprintf(", expired on %s (%d days ago)", e.ExpiryDate, -e.DaysLeft)
+	} else {
+		s += fmt.Sprintf(", expires on %s (in %d days)", e.ExpiryDate, e.DaysLeft)
+	}
+	if e.RenewBy != e.ExpiryDate && e.DaysLeft >= 0 {
+		s += ", renew by " + e.RenewBy
+	}
+	if e.Status == StatusNotice {
+		s += ", give notice by " + e.NoticeBy + " to terminate it"
+	}
+	return s
+}
@@ -0,0 +1,86 @@
+package b3app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiringNotice(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	a := newTestApp(t,
+		// Renew by 2026-02-26, but give notice by 2026-01-26.
+		testFile("b3", "ins", "home insurance.pdf", &Metadata{DocumentType: "insurance_policy", Holder: "Marie Curie", ExpiryDate: "2026-03-26"}),
+		// Renew by 2026-01-20, the notice is past: it renews anyway.
+		testFile("b3", "old", "car insurance.pdf", &Metadata{DocumentType: "insurance_policy", Holder: "Pierre Curie", ExpiryDate: "2026-02-20"}),
+		// Renew by 2026-06-01, far away.
+		testFile("b3", "pass", "passport.pdf", &Metadata{DocumentType: "passport", Holder: "Marie Curie", ExpiryDate: "2026-10-01"}),
+		testFile("b3", "gone", "id.pdf", &Metadata{DocumentType: "national_id", Holder: "Marie Curie", ExpiryDate: "2026-01-01"}),
+	)
+	got := a.Expiring(now, Period{Days: 30})
+	want := []struct{ id, status, deadline string }{
+		{"gone", StatusExpired, "2025-10-01"},
+		{"old", StatusUpcoming, "2026-01-20"},
+		{"ins", StatusNotice, "2026-01-26"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expiring() = %+v, want %d documents", got, len(want))
+	}
+	for i, w := range want {
+		if got[i].File.ID != w.id || got[i].Status != w.status || got[i].Deadline() != w.deadline {
+			t.Errorf("Expiring()[%d] = %s %s %s, want %s %s %s", i, got[i].File.ID, got[i].Status, got[i].Deadline(), w.id, w.status, w.deadline)
+		}
+	}
+}
+
+func TestDescriptionExpiry(t *testing.T) {
+	tests := []struct {
+		description, want string
+	}{
+		{"", ""},
+		{"Passport of Marie Curie.", ""},
+		{"Passport of Marie Curie.\nExpiry date: 2031-03-11", "2031-03-11"},
+		{"Expires on 2031-03-11.", "2031-03-11"},
+		{"EXPIRED 2020-01-31", "2020-01-31"},
+		{"Valid until 12/03/2031", "2031-03-12"},
+		{"Valid through 1.2.2031", "2031-02-01"},
+		{"Carte valable jusqu'au 05.07.2030", "2030-07-05"},
+		{"Date de fin de validité : 2029-12-31", "2029-12-31"},
+		{"Gültig bis 31.12.2028", "2028-12-31"},
+		{"Fecha de caducidad: 15/06/2027", "2027-06-15"},
+		{"Válido hasta 15/06/2027", "2027-06-15"},
+		{"Data di scadenza 30/09/2026", "2026-09-30"},
+		// The date follows the keyword on its line.
+		{"Issued 2021-03-12, expires 2031-03-11", "2031-03-11"},
+		{"Issued 2021-03-12.\nValid for ten years.", ""},
+		{"Expiry: see page 2.\nIssued 2021-03-12.", ""},
+		// Impossible dates are skipped.
+		{"Expires 2031-02-30", ""},
+		{"Expires 31/02/2031", ""},
+		{"Expires 2031-13-01, or 01/02/2031", "2031-02-01"},
+		// The first line mentioning an expiry wins.
+		{"Expires 2031-03-11\nExpired 2021-03-11", "2031-03-11"},
+		{"Expiry unknown.\nValid until 12/03/2031", "2031-03-12"},
+		// Not a date.
+		{"Expiry reference 12345-67-89", ""},
+	}
+	for _, test := range tests {
+		if got := descriptionExpiry(test.description); got != test.want {
+			t.Errorf("descriptionExpiry(%q) = %q, want %q", test.description, got, test.want)
+		}
+	}
+}
+
+func TestExpiringFromDescription(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	card := testFile("b3", "card", "library card.pdf", nil)
+	card.Description = "Library card.\nValid until 20/01/2026"
+	a := newTestApp(t, card)
+	got := a.Expiring(now, Period{Days: 30})
+	if len(got) != 1 || got[0].ExpiryDate != "2026-01-20" || !got[0].FromDescription || got[0].Label != "library card" {
+		t.Fatalf("Expiring() = %+v, want the library card expiring on 2026-01-20, read in its description", got)
+	}
+	// Without a document type, there is no lead time: it is renewed by its expiry date.
+	if got[0].Status != StatusUpcoming || got[0].RenewBy != "2026-01-20" || got[0].DaysLeft != 10 {
+		t.Errorf("Expiring() status %s, renew by %s, %d days left, want %s, by 2026-01-20, 10 days left", got[0].Status, got[0].RenewBy, got[0].DaysLeft, StatusUpcoming)
+	}
+}
@@ -0,0 +1,608 @@
+package b3app
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/etnz/b3/validate"
+	"google.golang.org/genai"
+)
+
+// Extraction is the structured analysis of a document by the reader model.
+//
+// Every extracted fact comes with the model confidence and the pages where it was found.
+type Extraction struct {
+	SuggestedName string            `json:"suggested_name"` // A good file name, reflecting the administrative nature of the document.
+	DocumentType  ExtractedField    `json:"document_type"`  // The kind of document, in snake_case, like "passport".
+	Summary       string            `json:"summary"`        // The administrative nature and purpose of the document.
+	Issuer        *ExtractedField   `json:"issuer,omitempty"`
+	People        []ExtractedPerson `json:"people,omitempty"`
+	Dates         []ExtractedField  `json:"dates,omitempty"`       // Kind is like "issue", "expiry", "birth", "due", "start", "end".
+	Identifiers   []ExtractedField  `json:"identifiers,omitempty"` // Kind is like "passport_number", "iban".
+	Addresses     []ExtractedField  `json:"addresses,omitempty"`   // Kind is whose address it is, like "holder", "issuer".
+	Amounts       []ExtractedAmount `json:"amounts,omitempty"`
+	Language      string            `json:"language,omitempty"` // ISO 639-1 code.
+}
+
+// ExtractedField is a single fact found in a document.
+type ExtractedField struct {
+	Kind       string  `json:"kind,omitempty"`
+	Value      string  `json:"value"`
+	Confidence float64 `json:"confidence"`      // From 0 (guess) to 1 (certain).
+	Pages      []int   `json:"pages,omitempty"` // 1-based page numbers.
+}
+
+// ExtractedPerson is a person, or an organisation, mentioned in a document.
+type ExtractedPerson struct {
+	Name       string  `json:"name"`
+	Role       string  `json:"role"`                 // Like "holder", "spouse", "employer", "landlord".
+	BirthDate  string  `json:"birth_date,omitempty"` // YYYY-MM-DD.
+	Confidence float64 `json:"confidence"`
+	Pages      []int   `json:"pages,omitempty"`
+}
+
+// ExtractedAmount is a money amount found in a document.
+type ExtractedAmount struct {
+	Label      string  `json:"label"`
+	Value      string  `json:"value"` // Decimal number with a dot.
+	Currency   string  `json:"currency,omitempty"`
+	Confidence float64 `json:"confidence"`
+	Pages      []int   `json:"pages,omitempty"`
+}
+
+// extractionPromptVersion identifies the extraction prompt and schema.
+// Change it whenever they change, so that previous analyses are not reused.
+const extractionPromptVersion = "3"
+
+// extractionPrompt is the system instruction of the reader model.
+const extractionPrompt = `Read the file provided to you, and extract its content as JSON, following the response schema.
+A good suggested_name reflects the administrative nature of the document, and who or what it is about.
+The summary describes:
+  - the administrative nature of the document.
+  - the administrative purpose of such a document.
+Extract every personal data: names, dates (birth, issue, expiry, due dates...), identifiers (ID numbers, account numbers, references),
+addresses and amounts, exactly as written, with dates formatted as YYYY-MM-DD.
+For each fact, give your confidence from 0 to 1, and the 1-based pages where it appears.
+Never invent a value: leave out what is not in the document.
+`
+
+// extractionSchema describes Extraction to the model.
+func extractionSchema() *genai.Schema {
+	str := func(description string) *genai.Schema {
+		return &genai.Schema{Type: genai.TypeString, Description: description}
+	}
+	confidence := &genai.Schema{Type: genai.TypeNumber, Description: "Confidence from 0 (guess) to 1 (certain)."}
+	pages := &genai.Schema{Type: genai.TypeArray, Description: "1-based page numbers where it appears.", Items: &genai.Schema{Type: genai.TypeInteger}}
+	value := func(description string) *genai.Schema {
+		return &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"value":      str(description),
+				"confidence": confidence,
+				"pages":      pages,
+			},
+			Required: []string{"value", "confidence"},
+		}
+	}
+	field := func(kind string) *genai.Schema {
+		s := value("The value, exactly as written. Dates formatted as YYYY-MM-DD.")
+		s.Properties["kind"] = str(kind)
+		return s
+	}
+	list := func(kind string) *genai.Schema {
+		return &genai.Schema{Type: genai.TypeArray, Items: field(kind)}
+	}
+	return &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"suggested_name": str("A good file name reflecting the administrative nature of the document."),
+			"document_type":  value("The kind of document, in snake_case, like passport, payslip, tax_notice."),
+			"summary":        str("The administrative nature and purpose of the document."),
+			"issuer":         value("The organisation or person who issued the document."),
+			"people": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"name":       str("Full name, exactly as written."),
+						"role":       str("Role in the document, like holder, spouse, child, employer, landlord, tenant."),
+						"birth_date": str("Birth date, formatted as YYYY-MM-DD, if written."),
+						"confidence": confidence,
+						"pages":      pages,
+					},
+					Required: []string{"name", "role", "confidence"},
+				},
+			},
+			"dates":       list("What the date is, like issue, expiry, birth, due, start, end."),
+			"identifiers": list("What the identifier is, in snake_case, like passport_number, iban, tax_id, nir (French social security number), dni (Spanish ID number), or mrz (the machine-readable zone of a passport or ID card, with its lines separated by new lines)."),
+			"addresses":   list("Whose address it is, like holder, issuer, property."),
+			"amounts": {
+				Type: genai.TypeArray,
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"label":      str("What the amount is, in snake_case, like total, net_salary."),
+						"value":      str("Decimal number with a dot, like 1234.56."),
+						"currency":   str("ISO 4217 currency code, like EUR."),
+						"confidence": confidence,
+						"pages":      pages,
+					},
+					Required: []string{"label", "value", "confidence"},
+				},
+			},
+			"language": str("ISO 639-1 code of the document language, like fr."),
+		},
+		Required: []string{"suggested_name", "document_type", "summary"},
+	}
+}
+
+// parseExtraction decodes and validates the model output.
+// Invalid facts are dropped, and reported as warnings.
+func parseExtraction(text string) (*Extraction, []string, error) {
+	e := &Extraction{}
+	if err := json.Unmarshal([]byte(text), e); err != nil {
+		return nil, nil, fmt.Errorf("analysis is not valid JSON: %w", err)
+	}
+	if strings.TrimSpace(e.SuggestedName) == "" || strings.TrimSpace(e.DocumentType.Value) == "" {
+		return nil, nil, fmt.Errorf("analysis misses the suggested name or the document type")
+	}
+	warnings := e.validate()
+	return e, warnings, nil
+}
+
+// validate drops the invalid facts and returns a warning for each.
+func (e *Extraction) validate() []string {
+	var warnings []string
+	check := func(what string, f ExtractedField, date bool) bool {
+		var problem string
+		switch {
+		case strings.TrimSpace(f.Value) == "":
+			problem = "empty value"
+		case f.Confidence < 0 || f.Confidence > 1:
+			problem = fmt.Sprintf("confidence %v out of [0, 1]", f.Confidence)
+		case date && !isDate(f.Value):
+			problem = fmt.Sprintf("%q is not a YYYY-MM-DD date", f.Value)
+		}
+		for _, p := range f.Pages {
+			if p < 1 && problem == "" {
+				problem = fmt.Sprintf("invalid page %d", p)
+			}
+		}
+		if problem != "" {
+			warnings = append(warnings, fmt.Sprintf("dropped %s %s: %s", what, f.Kind, problem))
+			return false
+		}
+		return true
+	}
+	filter := func(what string, fields []ExtractedField, date bool) []ExtractedField {
+		var kept []ExtractedField
+		for _, f := range fields {
+			if check(what, f, date) {
+				kept = append(kept, f)
+			}
+		}
+		return kept
+	}
+
+	e.Dates = filter("date", e.Dates, true)
+	e.Identifiers = filter("identifier", e.Identifiers, false)
+	// A value failing its check digits is kept, since it may be what is printed, but flagged.
+	for _, id := range e.Identifiers {
+		if err := validate.Check(id.Kind, id.Value); err != nil && !errors.Is(err, validate.ErrUnsupported) {
+			warnings = append(warnings, fmt.Sprintf("identifier %s %q is invalid (%v): check it in the document", id.Kind, id.Value, err))
+		}
+	}
+	e.Addresses = filter("address", e.Addresses, false)
+	if e.Issuer != nil && !check("issuer", *e.Issuer, false) {
+		e.Issuer = nil
+	}
+
+	var people []ExtractedPerson
+	for _, p := range e.People {
+		if check("person", ExtractedField{Kind: p.Role, Value: p.Name, Confidence: p.Confidence, Pages: p.Pages}, false) {
+			if p.BirthDate != "" && !isDate(p.BirthDate) {
+				warnings = append(warnings, fmt.Sprintf("dropped birth date of %s: %q is not a YYYY-MM-DD date", p.Name, p.BirthDate))
+				p.BirthDate = ""
+			}
+			people = append(people, p)
+		}
+	}
+	e.People = people
+
+	var amounts []ExtractedAmount
+	for _, a := range e.Amounts {
+		if check("amount", ExtractedField{Kind: a.Label, Value: a.Value, Confidence: a.Confidence, Pages: a.Pages}, false) {
+			amounts = append(amounts, a)
+		}
+	}
+	e.Amounts = amounts
+
+	if e.Language != "" && len(e.Language) != 2 {
+		warnings = append(warnings, fmt.Sprintf("dropped language %q: not an ISO 639-1 code", e.Language))
+		e.Language = ""
+	}
+	return append(warnings, e.checkMRZ()...)
+}
+
+// documentNumbers are the identifier kinds of the number of a travel document, written in its machine-readable zone.
+var documentNumbers = map[string]bool{
+	"passport_number": true, "id_card_number": true, "identity_card_number": true,
+	"document_number": true, "residence_permit_number": true, "visa_number": true,
+}
+
+// checkMRZ compares the facts read in the document with its machine-readable zone, if valid:
+// its check digits make it more reliable than the visual zone.
+func (e *Extraction) checkMRZ() []string {
+	var warnings []string
+	for _, id := range e.Identifiers {
+		if id.Kind != "mrz" {
+			continue
+		}
+		mrz, err := validate.ParseMRZ(id.Value)
+		if err != nil {
+			continue
+		}
+		for _, other := range e.Identifiers {
+			if documentNumbers[other.Kind] && normalizeIdentifier(other.Value) != mrz.DocumentNumber {
+				warnings = append(warnings, fmt.Sprintf("the machine-readable zone says the document number is %s, not %s", mrz.DocumentNumber, other.Value))
+			}
+		}
+		if expiry := e.date("expiry"); expiry != "" && expiry != mrz.ExpiryDate {
+			warnings = append(warnings, fmt.Sprintf("the machine-readable zone says the expiry date is %s, not %s", mrz.ExpiryDate, expiry))
+		}
+		for _, p := range e.People {
+			if p.Role == "holder" && p.BirthDate != "" && p.BirthDate != mrz.BirthDate {
+				warnings = append(warnings, fmt.Sprintf("the machine-readable zone says %s is born on %s, not %s", p.Name, mrz.BirthDate, p.BirthDate))
+			}
+		}
+	}
+	return warnings
+}
+
+// isDate reports whether s is a YYYY-MM-DD date.
+func isDate(s string) bool {
+	_, err := time.Parse(dateLayout, s)
+	return err == nil
+}
+
+// date returns the first date of the given kind, or "".
+func (e *Extraction) date(kind string) string {
+	for _, d := range e.Dates {
+		if d.Kind == kind {
+			return d.Value
+		}
+	}
+	return ""
+}
+
+// Metadata converts the extraction into the Metadata stored with the file.
+//
+// Facts that Drive appProperties cannot hold are left out, with a warning: identifiers without a kind,
+// amounts without a label, more than maxRepeated of a kind, dates that are not YYYY-MM-DD,
+// and values too long for a property. They remain in the description.
+func (e *Extraction) Metadata() (*Metadata, []string) {
+	var warnings []string
+	leaveOut := func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...)+", it is left out of the metadata")
+	}
+	// text returns value with its spaces normalized, or "" if it does not fit in the property key.
+	text := func(key, name, value string) string {
+		value = strings.Join(strings.Fields(value), " ")
+		if len(key)+len(value) > maxPropertyBytes {
+			leaveOut("the %s %q is too long", name, value)
+			return ""
+		}
+		return value
+	}
+	date := func(name, value string) string {
+		if value == "" {
+			return ""
+		}
+		if _, err := time.Parse(dateLayout, value); err != nil {
+			leaveOut("the %s date %q is not a YYYY-MM-DD date", name, value)
+			return ""
+		}
+		return value
+	}
+
+	m := &Metadata{
+		DocumentType: propertyKey(e.DocumentType.Value),
+		IssueDate:    date("issue", e.date("issue")),
+		ExpiryDate:   date("expiry", e.date("expiry")),
+	}
+	if len(e.Language) == 2 {
+		m.Language = e.Language
+	} else if e.Language != "" {
+		leaveOut("the language %q is not a two letter ISO 639-1 code", e.Language)
+	}
+	if e.Issuer != nil {
+		m.Issuer = text(propIssuer, "issuer", e.Issuer.Value)
+	}
+	var holder *ExtractedPerson
+	for i, p := range e.People {
+		if p.Role == "holder" {
+			holder = &e.People[i]
+			break
+		}
+	}
+	if holder == nil && len(e.People) > 0 {
+		holder = &e.People[0]
+	}
+	if holder != nil {
+		m.Holder = text(propHolder, "holder", holder.Name)
+		m.BirthDate = date("birth", holder.BirthDate)
+	}
+	address := ""
+	for _, a := range e.Addresses {
+		if address == "" || a.Kind == "holder" {
+			address = a.Value
+		}
+	}
+	m.Address = text(propAddress, "address", address)
+
+	// Identifiers and amounts share the properties left by the other fields,
+	// and by the version, the source checksum and the time of the description.
+	available := maxProperties - 3
+	for _, v := range []string{m.DocumentType, m.Holder, m.BirthDate, m.Issuer, m.IssueDate, m.ExpiryDate, m.Address, m.Language} {
+		if v != "" {
+			available--
+		}
+	}
+	counts := make(map[string]int)
+	// fits reports whether the n-th value of a repeated field can be stored with the key.
+	fits := func(key, name, value string) bool {
+		switch {
+		case counts[key] == maxRepeated:
+			leaveOut("the %s %q is one too many, at most %d are stored", name, value, maxRepeated)
+		case len(numberedKey(key, counts[key]+1))+len(value) > maxPropertyBytes:
+			leaveOut("the %s %q is too long", name, value)
+		case available == 0:
+			leaveOut("the %s %q does not fit in the %d properties of a file", name, value, maxProperties)
+		default:
+			counts[key]++
+			available--
+			return true
+		}
+		return false
+	}
+	for _, id := range e.Identifiers {
+		kind := propertyKey(id.Kind)
+		switch {
+		case id.Value == "":
+		case kind == "":
+			leaveOut("the identifier %q has no kind", id.Value)
+		case fits(propID+kind, kind, id.Value):
+			m.Identifiers = append(m.Identifiers, Identifier{Kind: id.Kind, Value: id.Value})
+		}
+	}
+	for _, a := range e.Amounts {
+		label := propertyKey(a.Label)
+		value := strings.TrimSpace(a.Value + " " + a.Currency)
+		switch {
+		case a.Value == "":
+		case label == "":
+			leaveOut("the amount %q has no label", value)
+		case fits(propAmount+label, label, value):
+			m.Amounts = append(m.Amounts, Amount{Label: a.Label, Value: a.Value, Currency: a.Currency})
+		}
+	}
+	return m, warnings
+}
+
+// Description generates a human readable description of the document from the extraction.
+func (e *Extraction) Description() string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(e.Summary))
+	b.WriteString("\n")
+	section := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n%s:\n", title)
+		for _, l := range lines {
+			fmt.Fprintf(&b, "- %s\n", l)
+		}
+	}
+	var lines []string
+	for _, p := range e.People {
+		l := fmt.Sprintf("%s (%s)", p.Name, p.Role)
+		if p.BirthDate != "" {
+			l += ", born " + p.BirthDate
+		}
+		lines = append(lines, l)
+	}
+	section("People", lines)
+	section("Dates", fieldLines(e.Dates))
+	section("Identifiers", fieldLines(e.Identifiers))
+	section("Addresses", fieldLines(e.Addresses))
+	lines = nil
+	for _, a := range e.Amounts {
+		lines = append(lines, fmt.Sprintf("%s: %s", a.Label, strings.TrimSpace(a.Value+" "+a.Currency)))
+	}
+	section("Amounts", lines)
+	return strings.TrimSpace(b.String())
+}
+
+// fieldLines formats fields as "kind: value" lines.
+func fieldLines(fields []ExtractedField) []string {
+	var lines []string
+	for _, f := range fields {
+		lines = append(lines, fmt.Sprintf("%s: %s", f.Kind, f.Value))
+	}
+	return lines
+}
+
+// Analysis is the result of reading a document.
+type Analysis struct {
+	Extraction    *Extraction `json:"extraction"`
+	SuggestedName string      `json:"suggested_name,omitempty"` // Following the naming pattern of the document type, if known. Empty for an excerpt.
+	Description   string      `json:"description"`              // Generated from the extraction.
+	Metadata      *Metadata   `json:"metadata,omitempty"`       // Ready to be stored with UpdateFile. Nil for an excerpt.
+	Folder        string      `json:"folder,omitempty"`         // The B3 sub-folder of the document type, if known.
+	Warnings      []string    `json:"warnings,omitempty"`
+	Pages         string      `json:"pages,omitempty"` // The pages read, when not the whole document.
+	// TextLayer is set when the PDF was analyzed from its text layer only, without its images.
+	TextLayer bool `json:"text_layer,omitempty"`
+	// Cached is the time of the analysis when it comes from the cache, because the content did not change since.
+	Cached *time.Time `json:"cached,omitempty"`
+}
+
+// AnalyzeFile reads a file with the reader model and returns its structured analysis.
+//
+// If pages is set, like "3-5" or "1,4-6", only those pages of a PDF are read, so that long documents
+// can be analyzed section by section. Documents over the limits of the 'analysis' section are rejected.
+//
+// Analyses are cached by content checksum and pages: an unchanged file is neither downloaded nor read again,
+// unless refresh is set.
+func (a *App) AnalyzeFile(ctx context.Context, client *genai.Client, fileID, pages string, refresh bool) (*Analysis, error) {
+	pages, err := cleanPages(pages)
+	if err != nil {
+		return nil, err
+	}
+	// The version of Google Workspace files, which have no checksum in Drive.
+	var modified time.Time
+	if a.Offline {
+		if f, ok := a.indexedFile(fileID); ok {
+			modified = f.Modified
+		}
+	} else {
+		// Drive knows the checksum of binary files: no need to download them to look up the cache.
+		f, err := a.filesGet(ctx, fileID).Fields("md5Checksum", "modifiedTime").Do()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get file %s: %w", fileID, a.scopeError(err))
+		}
+		modified, _ = time.Parse(time.RFC3339, f.ModifiedTime)
+		if !refresh && f.Md5Checksum != "" {
+			if c := loadAnalysis(fileID, pages, a.analysisKey(f.Md5Checksum, pages)); c != nil {
+				return a.newAnalysis(c.Extraction, c.Warnings, c.MD5, pages, &c.Analyzed), nil
+			}
+		}
+	}
+
+	content, mimeType, err := a.GetFileContent(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	// The checksum is the one Drive computes for the same content.
+	sum := md5.Sum(content)
+	checksum := hex.EncodeToString(sum[:])
+	key := a.analysisKey(checksum, pages)
+	if !refresh {
+		// Offline, or a Google Workspace file with no checksum in Drive.
+		if c := loadAnalysis(fileID, pages, key); c != nil {
+			if pages == "" && !modified.IsZero() {
+				// The exported content did not change: its text is still the current one.
+				if err := touchText(fileID, checksum, modified); err != nil {
+					log.Printf("warning: could not update the searchable text of %s: %v", fileID, err)
+				}
+			}
+			return a.newAnalysis(c.Extraction, c.Warnings, c.MD5, pages, &c.Analyzed), nil
+		}
+	}
+
+	ex, err := a.selectExcerpt(content, mimeType, pages)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read file %s: %w", fileID, err)
+	}
+	if ex.MimeType == pdfMimeType {
+		// Digitally born PDFs, like payslips, are read from their text layer: it is cheaper, and precise.
+		if ex.Text, err = ExtractPDFText(ex.Content); err != nil {
+			log.Printf("warning: could not read the text layer of %s, reading the document instead: %v", fileID, err)
+		}
+	}
+	parts, release, err := ex.parts(ctx, client, a.Config.Analysis.InlineMB<<20)
+	if err != nil {
+		return nil, err
+	}
+	extraction, warnings, err := a.extract(ctx, client, parts)
+	release()
+	if err != nil {
+		return nil, err
+	}
+	extraction.renumber(ex.Pages)
+
+	analysis := a.newAnalysis(extraction, warnings, checksum, pages, nil)
+	analysis.TextLayer = ex.textOnly()
+	if err := storeAnalysis(fileID, pages, &cachedAnalysis{Key: key, MD5: checksum, Analyzed: time.Now(), Extraction: extraction, Warnings: warnings}); err != nil {
+		analysis.Warnings = append(analysis.Warnings, fmt.Sprintf("the analysis could not be cached: %v", err))
+	}
+	// Make the content searchable, when it is the whole of it.
+	if pages == "" {
+		searchable := analysis.SuggestedName + "\n" + analysis.Description
+		if ex.Text != nil {
+			searchable += "\n" + ex.Text.Plain()
+		}
+		if err := storeText(fileID, extractedText{MD5: checksum, Modified: modified, Text: searchable}); err != nil {
+			analysis.Warnings = append(analysis.Warnings, fmt.Sprintf("the content could not be made searchable: %v", err))
+		}
+	}
+	return analysis, nil
+}
+
+// extractionInstruction returns the system instruction of the reader model.
+func (a *App) extractionInstruction() string {
+	return extractionPrompt + a.Config.taxonomyInstruction() + a.Config.languageInstruction()
+}
+
+// extract sends the document parts to the reader model and decodes its structured answer.
+func (a *App) extract(ctx context.Context, client *genai.Client, parts []*genai.Part) (*Extraction, []string, error) {
+	genContent := []*genai.Content{{Role: genai.RoleUser, Parts: parts}}
+
+	config := a.Config.GenerateContentConfig(ExpertReader)
+	config.SystemInstruction = &genai.Content{Parts: []*genai.Part{
+		{Text: a.extractionInstruction()},
+	}}
+	config.ResponseMIMEType = "application/json"
+	config.ResponseSchema = extractionSchema()
+
+	gen, err := client.Models.GenerateContent(ctx, a.Config.Expert(ExpertReader).Model, genContent, config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("analyzing content: %w", err)
+	}
+	if len(gen.Candidates) == 0 || gen.Candidates[0].Content == nil {
+		return nil, nil, fmt.Errorf("received 0 Candidates from analysis")
+	}
+	text := gen.Text()
+	if text == "" {
+		return nil, nil, fmt.Errorf("received empty response from analysis")
+	}
+	return parseExtraction(text)
+}
+
+// newAnalysis completes an extraction of the pages of the content with checksum md5 into an Analysis,
+// applying the rules of its document type.
+//
+// An excerpt has no name nor metadata: they would describe the whole file with a part of it.
+func (a *App) newAnalysis(extraction *Extraction, warnings []string, md5, pages string, cached *time.Time) *Analysis {
+	analysis := &Analysis{
+		Extraction:  extraction,
+		Description: extraction.Description(),
+		Warnings:    append([]string{}, warnings...),
+		Pages:       pages,
+		Cached:      cached,
+	}
+	if pages != "" {
+		return analysis
+	}
+	analysis.SuggestedName = extraction.SuggestedName
+	metadata, dropped := extraction.Metadata()
+	analysis.Metadata = metadata
+	analysis.Warnings = append(analysis.Warnings, dropped...)
+	analysis.Metadata.SourceMD5 = md5
+	// The naming pattern of the document type prevails over the model suggestion.
+	if t, ok := a.Config.DocumentType(analysis.Metadata.DocumentType); ok {
+		if name := t.FileName(analysis.Metadata); name != "" {
+			analysis.SuggestedName = name
+		}
+		analysis.Folder = t.Folder
+		analysis.Warnings = append(analysis.Warnings, t.Check(analysis.Metadata, time.Now())...)
+	}
+	return analysis
+}
@@ -0,0 +1,138 @@
+package b3app
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractionSchema(t *testing.T) {
+	s := extractionSchema()
+	for _, name := range []string{"document_type", "issuer"} {
+		if _, ok := s.Properties[name].Properties["kind"]; ok {
+			t.Errorf("%s has a kind", name)
+		}
+	}
+	if _, ok := s.Properties["identifiers"].Items.Properties["kind"]; !ok {
+		t.Errorf("identifiers have no kind")
+	}
+}
+
+func TestExtractionMetadata(t *testing.T) {
+	ibans := func(n int) []ExtractedField {
+		var ids []ExtractedField
+		for i := range n {
+			ids = append(ids, ExtractedField{Kind: "iban", Value: fmt.Sprintf("FR76300060000112345678901%02d", i)})
+		}
+		return ids
+	}
+	longAddress := strings.Repeat("12 rue de la République, ", 6)
+
+	tests := []struct {
+		name     string
+		e        Extraction
+		want     *Metadata
+		warnings int
+	}{
+		{
+			name: "complete",
+			e: Extraction{
+				DocumentType: ExtractedField{Value: "Passport"},
+				Issuer:       &ExtractedField{Value: "Préfecture  de\nParis"},
+				People:       []ExtractedPerson{{Name: "Marie Martin", Role: "mother"}, {Name: "Louis Martin", Role: "holder"}},
+				Dates:        []ExtractedField{{Kind: "issue", Value: "2020-01-02"}, {Kind: "expiry", Value: "2030-01-01"}},
+				Identifiers:  []ExtractedField{{Kind: "Passport Number", Value: "12AB34567"}},
+				Addresses:    []ExtractedField{{Kind: "issuer", Value: "1 place"}, {Kind: "holder", Value: "2 rue"}},
+				Amounts:      []ExtractedAmount{{Label: "fee", Value: "86", Currency: "EUR"}},
+				Language:     "fr",
+			},
+			want: &Metadata{
+				DocumentType: "passport", Holder: "Louis Martin", Issuer: "Préfecture de Paris",
+				IssueDate: "2020-01-02", ExpiryDate: "2030-01-01", Address: "2 rue", Language: "fr",
+				Identifiers: []Identifier{{Kind: "Passport Number", Value: "12AB34567"}},
+				Amounts:     []Amount{{Label: "fee", Value: "86", Currency: "EUR"}},
+			},
+		},
+		{
+			name: "first person without holder",
+			e:    Extraction{DocumentType: ExtractedField{Value: "letter"}, People: []ExtractedPerson{{Name: "Marie", Role: "tenant"}}},
+			want: &Metadata{DocumentType: "letter", Holder: "Marie"},
+		},
+		{
+			name: "no kind or label",
+			e: Extraction{
+				Identifiers: []ExtractedField{{Kind: "", Value: "123"}, {Kind: "№", Value: "456"}, {Kind: "ref", Value: ""}},
+				Amounts:     []ExtractedAmount{{Label: "总额", Value: "10"}, {Label: "total", Value: ""}},
+			},
+			want:     &Metadata{},
+			warnings: 3,
+		},
+		{
+			name:     "repeated",
+			e:        Extraction{Identifiers: ibans(maxRepeated + 2)},
+			want:     &Metadata{Identifiers: identifiers(ibans(maxRepeated))},
+			warnings: 2,
+		},
+		{
+			name:     "too long",
+			e:        Extraction{Addresses: []ExtractedField{{Value: longAddress}}, Identifiers: []ExtractedField{{Kind: "ref", Value: strings.Repeat("X", maxPropertyBytes)}}},
+			want:     &Metadata{},
+			warnings: 2,
+		},
+		{
+			name:     "invalid dates and language",
+			e:        Extraction{Dates: []ExtractedField{{Kind: "issue", Value: "02/01/2020"}}, Language: "French"},
+			want:     &Metadata{},
+			warnings: 2,
+		},
+	}
+	for _, test := range tests {
+		got, warnings := test.e.Metadata()
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: Metadata() = %+v, want %+v", test.name, got, test.want)
+		}
+		if len(warnings) != test.warnings {
+			t.Errorf("%s: Metadata() warnings = %q, want %d", test.name, warnings, test.warnings)
+		}
+		if _, err := got.AppProperties(); err != nil {
+			t.Errorf("%s: AppProperties() failed: %v", test.name, err)
+		}
+	}
+}
+
+// identifiers returns the identifiers of the extracted fields.
+func identifiers(fields []ExtractedField) []Identifier {
+	var ids []Identifier
+	for _, f := range fields {
+		ids = append(ids, Identifier{Kind: f.Kind, Value: f.Value})
+	}
+	return ids
+}
+
+func TestExtractionMetadataFitsDrive(t *testing.T) {
+	// Many kinds of identifiers and amounts: more than the properties of a file.
+	e := Extraction{
+		DocumentType: ExtractedField{Value: "bank_statement"},
+		People:       []ExtractedPerson{{Name: "Marie Martin", Role: "holder"}},
+		Dates:        []ExtractedField{{Kind: "issue", Value: "2024-01-31"}},
+		Addresses:    []ExtractedField{{Kind: "holder", Value: "2 rue de la Paix, 75002 Paris"}},
+		Language:     "fr",
+	}
+	for i := range 20 {
+		e.Identifiers = append(e.Identifiers, ExtractedField{Kind: fmt.Sprintf("account_%d", i), Value: fmt.Sprint(i)})
+		e.Amounts = append(e.Amounts, ExtractedAmount{Label: fmt.Sprintf("balance_%d", i), Value: "1.00", Currency: "EUR"})
+	}
+	m, warnings := e.Metadata()
+	if len(warnings) == 0 {
+		t.Errorf("Metadata() left nothing out of %d identifiers and %d amounts", len(e.Identifiers), len(e.Amounts))
+	}
+	m.SourceMD5, m.Described = "0123456789abcdef0123456789abcdef", "2024-01-31T00:00:00Z"
+	props, err := m.AppProperties()
+	if err != nil {
+		t.Fatalf("AppProperties() failed: %v", err)
+	}
+	if len(props) != maxProperties {
+		t.Errorf("AppProperties() has %d properties, want all %d used", len(props), maxProperties)
+	}
+}
@@ -0,0 +1,488 @@
+package b3app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Index is the persistent local index of the B3 and B4 folders.
+//
+// It is seeded once by walking both folder trees, and then kept current with
+// the Drive Changes API: only the changes since PageToken are fetched.
+type Index struct {
+	Version    int                    `json:"version"`            // Format of the index, see indexVersion.
+	DriveID    string                 `json:"drive_id,omitempty"` // Shared drive holding the vault, if any.
+	B3FolderID string                 `json:"b3_folder_id"`
+	B4FolderID string                 `json:"b4_folder_id"`
+	PageToken  string                 `json:"page_token"` // Changes API token to resume from.
+	Synced     time.Time              `json:"synced"`     // Last successful synchronization.
+	Folders    map[string]IndexFolder `json:"folders"`    // All subfolders of B3 and B4, by ID.
+	Files      map[string]IndexFile   `json:"files"`      // All files in B3 and B4, by ID.
+}
+
+// indexVersion is the current format of the Index.
+// Indexes in other formats are seeded again, to fetch the fields they miss.
+const indexVersion = 3
+
+// IndexFolder is a subfolder of B3 or B4.
+type IndexFolder struct {
+	Name   string `json:"name"`
+	Parent string `json:"parent"`
+}
+
+// IndexFile is a file in B3 or B4.
+type IndexFile struct {
+	File
+	Parent string `json:"parent"`
+	// Entered is when the index saw the file enter its vault folder, B3 or B4,
+	// zero if it was already there when the index was seeded.
+	Entered time.Time `json:"entered,omitzero"`
+}
+
+// IndexChanges lists the files that changed between two synchronizations of the Index.
+type IndexChanges struct {
+	Added    []File `json:"added,omitempty"`
+	Modified []File `json:"modified,omitempty"`
+	Moved    []File `json:"moved,omitempty"` // Moved within the vault, including between B3 and B4.
+	Removed  []File `json:"removed,omitempty"`
+}
+
+// Empty reports whether there is no change at all.
+func (c *IndexChanges) Empty() bool {
+	return c == nil || len(c.Added)+len(c.Modified)+len(c.Moved)+len(c.Removed) == 0
+}
+
+// String returns a short summary of the changes, like "2 added, 1 removed".
+func (c *IndexChanges) String() string {
+	if c.Empty() {
+		return "no changes"
+	}
+	var parts []string
+	for _, p := range []struct {
+		n    int
+		verb string
+	}{{len(c.Added), "added"}, {len(c.Modified), "modified"}, {len(c.Moved), "moved"}, {len(c.Removed), "removed"}} {
+		if p.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", p.n, p.verb))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// indexPath returns the path to the local index file.
+func indexPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "index.json"), nil
+}
+
+// loadIndex reads the local index. A missing index is not an error, it returns nil.
+func loadIndex() (*Index, error) {
+	path, err := indexPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+	idx := &Index{}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, fmt.Errorf("failed to decode index %s: %w", path, err)
+	}
+	return idx, nil
+}
+
+// save writes the index.
+func (idx *Index) save() error {
+	path, err := indexPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+	if err := writePrivateFile(path, data); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return nil
+}
+
+// rootOf returns the vault folder ID (B3 or B4) that contains the folder
+// folderID, or "" if it is not part of the vault.
+func (idx *Index) rootOf(folderID string) string {
+	for seen := 0; seen <= len(idx.Folders); seen++ {
+		if folderID == idx.B3FolderID || folderID == idx.B4FolderID {
+			return folderID
+		}
+		f, ok := idx.Folders[folderID]
+		if !ok {
+			return ""
+		}
+		folderID = f.Parent
+	}
+	return "" // A cycle, should not happen.
+}
+
+// pathOf returns the path of a folder in the vault, like "B3/Car", or "" if it is not part of the vault.
+func (idx *Index) pathOf(folderID string) string {
+	var names []string
+	for seen := 0; seen <= len(idx.Folders); seen++ {
+		root := ""
+		switch folderID {
+		case idx.B3FolderID:
+			root = "B3"
+		case idx.B4FolderID:
+			root = "B4"
+		}
+		if root != "" {
+			names = append(names, root)
+			slices.Reverse(names)
+			return strings.Join(names, "/")
+		}
+		f, ok := idx.Folders[folderID]
+		if !ok {
+			return ""
+		}
+		names = append(names, f.Name)
+		folderID = f.Parent
+	}
+	return "" // A cycle, should not happen.
+}
+
+// file returns the indexed file with its path.
+func (idx *Index) file(f IndexFile) File {
+	file := f.File
+	file.Path = idx.pathOf(f.Parent)
+	return file
+}
+
+// files returns the files contained in the vault folder rootID, sorted by name.
+func (idx *Index) files(rootID string) []File {
+	files := []File{}
+	for _, f := range idx.Files {
+		if idx.rootOf(f.Parent) == rootID {
+			files = append(files, idx.file(f))
+		}
+	}
+	sortFiles(files)
+	return files
+}
+
+// add records a file or folder seen in Drive.
+func (idx *Index) add(f *drive.File) error {
+	parent := ""
+	if len(f.Parents) > 0 {
+		parent = f.Parents[0]
+	}
+	if f.MimeType == folderMimeType {
+		idx.Folders[f.Id] = IndexFolder{Name: f.Name, Parent: parent}
+		return nil
+	}
+	file, err := newFile(f)
+	if err != nil {
+		return err
+	}
+	idx.Files[f.Id] = IndexFile{File: file, Parent: parent}
+	return nil
+}
+
+// prune removes the files and folders that are no longer part of the vault.
+func (idx *Index) prune() {
+	for id, f := range idx.Folders {
+		if idx.rootOf(f.Parent) == "" {
+			delete(idx.Folders, id)
+		}
+	}
+	for id, f := range idx.Files {
+		if idx.rootOf(f.Parent) == "" {
+			delete(idx.Files, id)
+		}
+	}
+}
+
+// diff returns the changes from the index before to the current one.
+func (idx *Index) diff(before *Index) *IndexChanges {
+	changes := &IndexChanges{}
+	for id, f := range idx.Files {
+		old, ok := before.Files[id]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, idx.file(f))
+		case old.Parent != f.Parent:
+			changes.Moved = append(changes.Moved, idx.file(f))
+		case old.Name != f.Name || old.Description != f.Description || old.MD5Checksum != f.MD5Checksum || !old.Modified.Equal(f.Modified) || !reflect.DeepEqual(old.Metadata, f.Metadata):
+			changes.Modified = append(changes.Modified, idx.file(f))
+		}
+	}
+	for id, f := range before.Files {
+		if _, ok := idx.Files[id]; !ok {
+			// Removed files have the path they had before.
+			changes.Removed = append(changes.Removed, before.file(f))
+		}
+	}
+	sortFiles(changes.Added)
+	sortFiles(changes.Modified)
+	sortFiles(changes.Moved)
+	sortFiles(changes.Removed)
+	return changes
+}
+
+// sortFiles sorts files by name, and then by ID for a deterministic order.
+func sortFiles(files []File) {
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Name != files[j].Name {
+			return files[i].Name < files[j].Name
+		}
+		return files[i].ID < files[j].ID
+	})
+}
+
+// Sync brings the local index up to date and returns the changes since the previous synchronization.
+//
+// The first call of a session also records its result in SessionChanges:
+// the changes since the last session.
+//
+// Offline, there is nothing to synchronize and no change is reported.
+func (a *App) Sync(ctx context.Context) (*IndexChanges, error) {
+	changes, err := a.syncIndex(ctx)
+	if err != nil || changes.Empty() {
+		return changes, err
+	}
+	// Pinned files are downloaded without holding the index, so that listing and search are not blocked meanwhile.
+	a.refreshPins(ctx, changes)
+	for _, f := range changes.Removed {
+		if err := forgetAnalysis(f.ID); err != nil {
+			log.Printf("warning: could not forget the analysis of %s: %v", f.ID, err)
+		}
+	}
+	return changes, nil
+}
+
+// syncIndex brings the local index up to date, under indexMu, and returns the changes.
+func (a *App) syncIndex(ctx context.Context) (*IndexChanges, error) {
+	a.indexMu.Lock()
+	defer a.indexMu.Unlock()
+
+	if a.Offline {
+		if a.SessionChanges == nil {
+			a.SessionChanges = &IndexChanges{}
+		}
+		return &IndexChanges{}, nil
+	}
+
+	b3FolderID, err := a.findB3FolderID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b4FolderID, err := a.findB4FolderID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.index == nil {
+		if a.index, err = loadIndex(); err != nil {
+			return nil, err
+		}
+	}
+	idx := a.index
+	if idx == nil || idx.Version != indexVersion || idx.PageToken == "" || idx.DriveID != a.DriveID || idx.B3FolderID != b3FolderID || idx.B4FolderID != b4FolderID {
+		// No usable index: the vault has moved, the format changed, or it is the first run.
+		idx = &Index{Version: indexVersion, DriveID: a.DriveID, B3FolderID: b3FolderID, B4FolderID: b4FolderID}
+	}
+
+	before := *idx // applyChanges replaces the maps, it does not modify them.
+	if idx.PageToken == "" {
+		err = a.seedIndex(ctx, idx)
+		before = *idx // Nothing to compare a brand new index with.
+	} else {
+		err = a.applyChanges(ctx, idx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	idx.prune()
+	idx.Synced = time.Now()
+	if err := idx.save(); err != nil {
+		return nil, err
+	}
+	a.index = idx
+
+	changes := idx.diff(&before)
+	if a.SessionChanges == nil {
+		a.SessionChanges = changes
+	}
+	return changes, nil
+}
+
+// seedIndex fills the index by walking the B3 and B4 folder trees.
+func (a *App) seedIndex(ctx context.Context, idx *Index) error {
+	// Get the token first, so that no change happening during the walk is lost.
+	token, err := a.changeLister().startPageToken(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get changes start page token: %w", err)
+	}
+
+	idx.Folders = make(map[string]IndexFolder)
+	idx.Files = make(map[string]IndexFile)
+	for _, root := range []string{idx.B3FolderID, idx.B4FolderID} {
+		if err := a.walkFolder(ctx, root, idx.add); err != nil {
+			return err
+		}
+	}
+	idx.PageToken = token
+	return nil
+}
+
+// applyChanges updates the index with the changes reported by Drive since idx.PageToken.
+func (a *App) applyChanges(ctx context.Context, idx *Index) error {
+	// Work on copies so that a failure leaves the index untouched.
+	folders := make(map[string]IndexFolder, len(idx.Folders))
+	for k, v := range idx.Folders {
+		folders[k] = v
+	}
+	files := make(map[string]IndexFile, len(idx.Files))
+	for k, v := range idx.Files {
+		files[k] = v
+	}
+	next := &Index{DriveID: idx.DriveID, B3FolderID: idx.B3FolderID, B4FolderID: idx.B4FolderID, Folders: folders, Files: files}
+
+	// enter adds a file seen in a change at time at: a file new to its vault folder entered it then.
+	enter := func(f *drive.File, at time.Time) error {
+		if err := next.add(f); err != nil {
+			return err
+		}
+		file, ok := next.Files[f.Id]
+		if !ok {
+			return nil // A folder.
+		}
+		if old, ok := idx.Files[f.Id]; ok && idx.rootOf(old.Parent) == next.rootOf(file.Parent) {
+			file.Entered = old.Entered
+		} else {
+			file.Entered = at
+		}
+		next.Files[f.Id] = file
+		return nil
+	}
+
+	token := idx.PageToken
+	for token != "" {
+		var list *drive.ChangeList
+		err := retryRateLimited(ctx, func() (err error) {
+			list, err = a.changeLister().listChanges(ctx, token)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list changes: %w", err)
+		}
+
+		for _, c := range list.Changes {
+			if c.ChangeType == "drive" {
+				continue
+			}
+			f := c.File
+			if c.Removed || f == nil || f.Trashed {
+				delete(next.Folders, c.FileId)
+				delete(next.Files, c.FileId)
+				continue
+			}
+			parent := ""
+			if len(f.Parents) > 0 {
+				parent = f.Parents[0]
+			}
+			if next.rootOf(parent) == "" {
+				// Not in the vault (anymore), or its parent is not known yet, in which
+				// case it will be found when the parent folder is walked.
+				delete(next.Folders, f.Id)
+				delete(next.Files, f.Id)
+				continue
+			}
+			at, err := time.Parse(time.RFC3339, c.Time)
+			if err != nil {
+				at = time.Now()
+			}
+			_, known := next.Folders[f.Id]
+			if err := enter(f, at); err != nil {
+				return err
+			}
+			if f.MimeType == folderMimeType && !known {
+				// A folder entered the vault, with its whole content.
+				if err := a.walkFolder(ctx, f.Id, func(f *drive.File) error { return enter(f, at) }); err != nil {
+					return err
+				}
+			}
+		}
+
+		token = list.NextPageToken
+		if list.NewStartPageToken != "" {
+			next.PageToken = list.NewStartPageToken
+		}
+	}
+
+	idx.Folders, idx.Files, idx.PageToken = next.Folders, next.Files, next.PageToken
+	return nil
+}
+
+// changeLister lists the changes of the Drive holding the vault.
+// It is the seam between the synchronization of the index and Drive, faked in tests.
+type changeLister interface {
+	// startPageToken returns the token of the changes to come.
+	startPageToken(ctx context.Context) (string, error)
+	// listChanges returns the page of changes from pageToken, with the listFields of the files.
+	listChanges(ctx context.Context, pageToken string) (*drive.ChangeList, error)
+}
+
+// driveChanges lists changes with the Drive API.
+type driveChanges struct{ app *App }
+
+func (c driveChanges) startPageToken(ctx context.Context) (string, error) {
+	call := c.app.DriveService.Changes.GetStartPageToken().Context(ctx).SupportsAllDrives(true)
+	if c.app.DriveID != "" {
+		call = call.DriveId(c.app.DriveID)
+	}
+	token, err := call.Do()
+	if err != nil {
+		return "", err
+	}
+	return token.StartPageToken, nil
+}
+
+func (c driveChanges) listChanges(ctx context.Context, pageToken string) (*drive.ChangeList, error) {
+	call := c.app.DriveService.Changes.List(pageToken).Context(ctx).
+		SupportsAllDrives(true).
+		IncludeItemsFromAllDrives(true).
+		IncludeRemoved(true).
+		PageSize(1000).
+		Fields(googleapi.Field("nextPageToken, newStartPageToken, changes(changeType, fileId, removed, time, file(" + listFields + "))"))
+	if c.app.DriveID != "" {
+		call = call.DriveId(c.app.DriveID)
+	}
+	return call.Do()
+}
+
+// changeLister returns the changeLister of the App: Drive, unless replaced by a fake.
+func (a *App) changeLister() changeLister {
+	if a.changes != nil {
+		return a.changes
+	}
+	return driveChanges{a}
+}
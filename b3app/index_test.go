@@ -0,0 +1,175 @@
+package b3app
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// fakeChanges is a feed of Drive changes, by page token.
+type fakeChanges struct {
+	start string
+	pages map[string]*drive.ChangeList
+}
+
+func (c *fakeChanges) startPageToken(ctx context.Context) (string, error) {
+	return c.start, nil
+}
+
+func (c *fakeChanges) listChanges(ctx context.Context, pageToken string) (*drive.ChangeList, error) {
+	page, ok := c.pages[pageToken]
+	if !ok {
+		return nil, fmt.Errorf("unknown page token %q", pageToken)
+	}
+	return page, nil
+}
+
+// driveFile returns a Drive file in the folder parent, with the fields of listFields.
+func driveFile(parent, id, name string) *drive.File {
+	return &drive.File{Id: id, Name: name, Parents: []string{parent}, MimeType: "application/pdf", Md5Checksum: "md5-" + id, ModifiedTime: "2024-01-01T00:00:00Z"}
+}
+
+// driveFolder returns a Drive folder in the folder parent.
+func driveFolder(parent, id, name string) *drive.File {
+	return &drive.File{Id: id, Name: name, Parents: []string{parent}, MimeType: folderMimeType, ModifiedTime: "2024-01-01T00:00:00Z"}
+}
+
+// newSyncApp returns an online App synchronizing its index from the fakes, with B3 and B4 of IDs "b3" and "b4".
+func newSyncApp(t *testing.T, d *fakeDrive, c *fakeChanges) *App {
+	t.Helper()
+	a := newTestApp(t)
+	a.Offline, a.index = false, nil
+	a.folderIDs = map[string]string{"B3": "b3", "B4": "b4"}
+	a.files, a.changes = d, c
+	return a
+}
+
+// paths returns the path and name of the files.
+func paths(files []File) []string {
+	var p []string
+	for _, f := range files {
+		p = append(p, f.Path+"/"+f.Name)
+	}
+	return p
+}
+
+func TestSyncSeed(t *testing.T) {
+	d := &fakeDrive{pageSize: 2, children: map[string][]*drive.File{
+		"b3":  {driveFile("b3", "passport", "Passport.pdf"), driveFolder("b3", "car", "Car")},
+		"car": {driveFile("car", "insurance", "Insurance.pdf")},
+		"b4":  {driveFile("b4", "scan", "Scan.pdf")},
+	}}
+	a := newSyncApp(t, d, &fakeChanges{start: "1"})
+
+	changes, err := a.Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing to compare a new index with.
+	if !changes.Empty() {
+		t.Errorf("Sync() of a new index = %s, want no changes", changes)
+	}
+	if got, want := paths(a.index.files("b3")), []string{"B3/Car/Insurance.pdf", "B3/Passport.pdf"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("B3 files = %q, want %q", got, want)
+	}
+	if got, want := paths(a.index.files("b4")), []string{"B4/Scan.pdf"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("B4 files = %q, want %q", got, want)
+	}
+	if a.index.PageToken != "1" {
+		t.Errorf("PageToken = %q, want the start page token 1", a.index.PageToken)
+	}
+	saved, err := loadIndex()
+	if err != nil || saved == nil || len(saved.Files) != 3 {
+		t.Errorf("saved index = %+v, %v, want the 3 files", saved, err)
+	}
+}
+
+func TestSyncChanges(t *testing.T) {
+	d := &fakeDrive{pageSize: 10, children: map[string][]*drive.File{
+		"b3":   {driveFile("b3", "passport", "Passport.pdf"), driveFile("b3", "other", "Other.pdf"), driveFolder("b3", "car", "Car"), driveFolder("b3", "home", "Home")},
+		"car":  {driveFile("car", "insurance", "Insurance.pdf")},
+		"home": {driveFile("home", "lease", "Lease.pdf"), driveFolder("home", "old", "Old")},
+		"old":  {driveFile("old", "deed", "Deed.pdf")},
+		"b4":   {driveFile("b4", "scan", "Scan.pdf")},
+	}}
+	c := &fakeChanges{start: "1", pages: map[string]*drive.ChangeList{}}
+	a := newSyncApp(t, d, c)
+	ctx := context.Background()
+	if _, err := a.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	renamed := driveFile("b3", "passport", "Passport Marie.pdf")
+	moved := driveFile("b3", "scan", "Scan.pdf")
+	away := driveFile("elsewhere", "other", "Other.pdf")
+	home := driveFolder("b3", "home", "Home")
+	home.Trashed = true
+	// A new folder is walked, with its content.
+	d.children["tax"] = []*drive.File{driveFile("tax", "notice", "Tax notice.pdf")}
+	c.pages["1"] = &drive.ChangeList{NextPageToken: "1b", Changes: []*drive.Change{
+		{ChangeType: "file", FileId: "bill", File: driveFile("car", "bill", "Bill.pdf")},
+		{ChangeType: "file", FileId: "passport", File: renamed, Time: "2025-06-01T10:00:00Z"},
+		{ChangeType: "drive"},
+		{ChangeType: "file", FileId: "scan", File: moved, Time: "2025-06-02T10:00:00Z"},
+	}}
+	c.pages["1b"] = &drive.ChangeList{NewStartPageToken: "2", Changes: []*drive.Change{
+		{ChangeType: "file", FileId: "insurance", Removed: true},
+		{ChangeType: "file", FileId: "other", File: away},
+		{ChangeType: "file", FileId: "home", File: home},
+		{ChangeType: "file", FileId: "tax", File: driveFolder("b3", "tax", "Tax"), Time: "2025-06-03T10:00:00Z"},
+	}}
+
+	changes, err := a.Sync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		kind      string
+		got, want []string
+	}{
+		{"added", paths(changes.Added), []string{"B3/Car/Bill.pdf", "B3/Tax/Tax notice.pdf"}},
+		{"modified", paths(changes.Modified), []string{"B3/Passport Marie.pdf"}},
+		{"moved", paths(changes.Moved), []string{"B3/Scan.pdf"}},
+		// Removed files have the path they had before, the removed folders are pruned.
+		{"removed", paths(changes.Removed), []string{"B3/Home/Old/Deed.pdf", "B3/Car/Insurance.pdf", "B3/Home/Lease.pdf", "B3/Other.pdf"}},
+	} {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %q, want %q", tt.kind, tt.got, tt.want)
+		}
+	}
+	for _, id := range []string{"home", "old"} {
+		if _, ok := a.index.Folders[id]; ok {
+			t.Errorf("folder %s is still in the index", id)
+		}
+	}
+	if a.index.PageToken != "2" {
+		t.Errorf("PageToken = %q, want the new start page token 2", a.index.PageToken)
+	}
+	// Files entering B3 or B4 record the time of the change, the others keep theirs.
+	for _, tt := range []struct{ id, want string }{{"passport", ""}, {"scan", "2025-06-02"}, {"notice", "2025-06-03"}} {
+		got := ""
+		if entered := a.index.Files[tt.id].Entered; !entered.IsZero() {
+			got = entered.Format(dateLayout)
+		}
+		if got != tt.want {
+			t.Errorf("%s entered its vault folder on %q, want %q", tt.id, got, tt.want)
+		}
+	}
+
+	// A failure leaves the index untouched.
+	before := fmt.Sprint(a.index.Files)
+	if _, err := a.Sync(ctx); err == nil {
+		t.Errorf("Sync() with an unknown page token succeeded")
+	}
+	if after := fmt.Sprint(a.index.Files); after != before || a.index.PageToken != "2" {
+		t.Errorf("a failed Sync() changed the index")
+	}
+
+	c.pages["2"] = &drive.ChangeList{NewStartPageToken: "2"}
+	if changes, err := a.Sync(ctx); err != nil || !changes.Empty() {
+		t.Errorf("Sync() without changes = %s, %v, want no changes", changes, err)
+	}
+}
@@ -0,0 +1,163 @@
+package b3app
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Severity tells how much a lint Finding matters.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"   // The file cannot be found nor used without reading it.
+	SeverityWarning Severity = "warning" // The file is poorly described or filed.
+	SeverityInfo    Severity = "info"    // The file could be described better.
+)
+
+// rank orders the severities, the most severe first.
+func (s Severity) rank() int {
+	switch s {
+	case SeverityError:
+		return 0
+	case SeverityWarning:
+		return 1
+	}
+	return 2
+}
+
+// Lint rules.
+const (
+	RuleMissingDescription = "missing-description"     // No description nor metadata.
+	RuleBoilerplate        = "boilerplate-description" // A description too short or too generic to be useful.
+	RuleStale              = "stale-description"       // The file was modified since it was described.
+	RuleGenericName        = "generic-name"            // A name like "Scan_0001.pdf".
+	RuleNamingPattern      = "naming-pattern"          // A name not following the pattern of its document type.
+	RuleNoMetadata         = "no-metadata"             // No structured metadata.
+	RuleMissingFields      = "missing-fields"          // Metadata missing or inconsistent for the document type.
+	RuleInvalidIdentifier  = "invalid-identifier"      // An identifier failing its check digits, probably misread.
+	RuleDuplicateName      = "duplicate-name"          // Several files with the same name in a folder.
+	RuleB4Age              = "b4-age"                  // A file left in B4 for too long.
+)
+
+// Finding is a problem found in the vault by Lint.
+type Finding struct {
+	File     File     `json:"file"`
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	// Fixable is set when analyzing the file again, and updating it, fixes the problem.
+	Fixable bool `json:"fixable"`
+}
+
+// Lint audits the files of B3 and B4 from the local index, and returns the findings,
+// the most severe first.
+func (a *App) Lint(now time.Time) []Finding {
+	var findings []Finding
+	add := func(f File, rule string, severity Severity, fixable bool, format string, args ...any) {
+		findings = append(findings, Finding{File: f, Rule: rule, Severity: severity, Message: fmt.Sprintf(format, args...), Fixable: fixable})
+	}
+
+	b3, b4 := a.indexedFiles("B3"), a.indexedFiles("B4")
+	for _, f := range append(b3, b4...) {
+		// The calendar of 'b3 calendar -upload' lives in B4 on purpose, and is described by its generator.
+		if isCalendar(f) {
+			continue
+		}
+		prose := stripMetadata(f.Description)
+		switch {
+		case prose == "" && f.Metadata == nil:
+			add(f, RuleMissingDescription, SeverityError, true, "no description")
+		case prose != "" && (utf8.RuneCountInString(prose) < minDescriptionRunes || isGenericName(prose)):
+			add(f, RuleBoilerplate, SeverityWarning, true, "the description %q says little about the document", prose)
+		}
+		if modifiedSinceDescribed(f) {
+			add(f, RuleStale, SeverityWarning, true, "the file was modified since it was described")
+		}
+
+		if isGenericName(f.Name) {
+			add(f, RuleGenericName, SeverityWarning, true, "the name says nothing about the document")
+		}
+		if f.Metadata == nil {
+			if prose != "" {
+				add(f, RuleNoMetadata, SeverityInfo, true, "no structured metadata")
+			}
+			continue
+		}
+		for _, problem := range f.Metadata.invalidIdentifiers() {
+			add(f, RuleInvalidIdentifier, SeverityWarning, true, "%s", problem)
+		}
+		t, ok := a.Config.DocumentType(f.Metadata.DocumentType)
+		if !ok {
+			continue
+		}
+		if want := t.FileName(f.Metadata); want != "" && !strings.EqualFold(strings.TrimSuffix(f.Name, path.Ext(f.Name)), want) {
+			add(f, RuleNamingPattern, SeverityInfo, true, "the name does not follow the pattern of a %s, it should be %q", t.Label, want)
+		}
+		for _, problem := range t.Check(f.Metadata, now) {
+			add(f, RuleMissingFields, SeverityWarning, true, "%s", problem)
+		}
+	}
+
+	// Names only need to be unique in a folder.
+	byName := make(map[string][]File)
+	for _, f := range append(b3, b4...) {
+		key := f.Path + "/" + strings.ToLower(f.Name)
+		byName[key] = append(byName[key], f)
+	}
+	for _, files := range byName {
+		for _, f := range files {
+			if len(files) > 1 {
+				add(f, RuleDuplicateName, SeverityWarning, false, "%d files are named %q in %s", len(files), f.Name, f.Path)
+			}
+		}
+	}
+
+	// B4 is a working area: documents are filed in B3, or deleted, once the procedure is over.
+	if maxAge, err := ParsePeriod(a.Config.Lint.B4MaxAge); err == nil {
+		for _, f := range b4 {
+			if isCalendar(f) {
+				continue
+			}
+			if since := a.enteredVault(f); !since.IsZero() && maxAge.AddTo(since).Before(now) {
+				add(f, RuleB4Age, SeverityWarning, false, "in B4 since %s, more than %s ago: file it in B3, or delete it", since.Format(dateLayout), a.Config.Lint.B4MaxAge)
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		fi, fj := findings[i], findings[j]
+		if fi.Severity != fj.Severity {
+			return fi.Severity.rank() < fj.Severity.rank()
+		}
+		if fi.File.Path+"/"+fi.File.Name != fj.File.Path+"/"+fj.File.Name {
+			return fi.File.Path+"/"+fi.File.Name < fj.File.Path+"/"+fj.File.Name
+		}
+		return fi.Rule < fj.Rule
+	})
+	return findings
+}
+
+// NewFixRun starts a batch analysis of the files with fixable findings, to be reviewed like the one of NewIndexRun.
+// Files whose proposal was rejected, or too long to be read at once, are skipped until they change.
+func NewFixRun(findings []Finding) *IndexRun {
+	r := &IndexRun{Started: time.Now()}
+	rejected := loadRejections()
+	proposals := make(map[string]*IndexProposal)
+	for _, f := range findings {
+		if !f.Fixable || rejected[f.File.ID] == fileVersion(f.File) {
+			continue
+		}
+		p, ok := proposals[f.File.ID]
+		if !ok {
+			p = &IndexProposal{File: f.File, Status: ProposalPending}
+			proposals[f.File.ID] = p
+			r.Proposals = append(r.Proposals, p)
+		}
+		p.Reasons = append(p.Reasons, f.Rule)
+	}
+	return r
+}
@@ -0,0 +1,112 @@
+package b3app
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNewFixRun(t *testing.T) {
+	newTestApp(t) // For a clean local state.
+	scan := testFile("b3", "scan", "Scan_0001.pdf", nil).File
+	bill := testFile("b3", "bill", "Bill.pdf", nil).File
+	twin := testFile("b3", "twin", "Bill.pdf", nil).File
+	rejected := testFile("b3", "rejected", "IMG_0002.jpg", nil).File
+	changed := testFile("b3", "changed", "IMG_0003.jpg", nil).File
+	for _, f := range []File{rejected, changed} {
+		if err := recordRejection(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changed.MD5Checksum = "md5-changed-2" // A new version since it was rejected.
+
+	findings := []Finding{
+		{File: scan, Rule: RuleGenericName, Fixable: true},
+		{File: bill, Rule: RuleBoilerplate, Fixable: true},
+		{File: scan, Rule: RuleNoMetadata, Fixable: true},
+		{File: bill, Rule: RuleDuplicateName},
+		{File: twin, Rule: RuleDuplicateName},
+		{File: rejected, Rule: RuleGenericName, Fixable: true},
+		{File: changed, Rule: RuleGenericName, Fixable: true},
+	}
+	r := NewFixRun(findings)
+
+	type proposal struct {
+		id      string
+		reasons []string
+	}
+	var got []proposal
+	for _, p := range r.Proposals {
+		if p.Status != ProposalPending {
+			t.Errorf("proposal of %s is %s, want %s", p.File.ID, p.Status, ProposalPending)
+		}
+		got = append(got, proposal{p.File.ID, p.Reasons})
+	}
+	want := []proposal{
+		{"scan", []string{RuleGenericName, RuleNoMetadata}},
+		{"bill", []string{RuleBoilerplate}},
+		{"changed", []string{RuleGenericName}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewFixRun() proposals = %+v, want %+v", got, want)
+	}
+
+	if r := NewFixRun(nil); len(r.Proposals) != 0 {
+		t.Errorf("NewFixRun(nil) = %d proposals, want none", len(r.Proposals))
+	}
+}
+
+func TestLintFixRun(t *testing.T) {
+	now := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+	good := testFile("b3", "good", "Passport Marie Curie.pdf", nil)
+	good.Description = "Passport of Marie Curie, issued in Paris, valid for ten years."
+	scan := testFile("b3", "scan", "Scan_0001.pdf", nil)
+	scan.Description = ""
+	calendar := testFile("b4", "calendar", CalendarName, nil)
+	calendar.Description = ""
+	a := newTestApp(t, good, scan, calendar)
+	a.index.Folders["b4"] = IndexFolder{Name: "B4"}
+
+	findings := a.Lint(now)
+	for _, f := range findings {
+		if f.File.ID == "calendar" {
+			t.Errorf("Lint() reports the uploaded calendar: %+v", f)
+		}
+	}
+	r := NewFixRun(findings)
+	var ids []string
+	for _, p := range r.Proposals {
+		ids = append(ids, p.File.ID)
+	}
+	// The good file has no metadata: a fixable info.
+	if want := []string{"scan", "good"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("NewFixRun(Lint()) proposes %q, want %q", ids, want)
+	}
+}
+
+func TestLintB4Age(t *testing.T) {
+	now := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+	old := testFile("b4", "old", "Old.pdf", nil)          // Created in 2024, in B4 since the index was seeded.
+	recent := testFile("b4", "recent", "Recent.pdf", nil) // Created in 2024, moved to B4 recently.
+	recent.Entered = now.AddDate(0, 0, -3)
+	filed := testFile("b4", "filed", "Filed.pdf", nil)
+	filed.Entered = now.AddDate(0, -2, 0)
+	a := newTestApp(t, old, recent, filed)
+	a.index.Folders["b4"] = IndexFolder{Name: "B4"}
+
+	var got []string
+	for _, f := range a.Lint(now) {
+		if f.Rule == RuleB4Age {
+			got = append(got, f.File.ID+": "+f.Message)
+		}
+	}
+	want := []string{
+		"filed: in B4 since 2025-11-10, more than 30d ago: file it in B3, or delete it",
+		"old: in B4 since 2024-01-01, more than 30d ago: file it in B3, or delete it",
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lint() B4 findings = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,411 @@
+package b3app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/etnz/b3/validate"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/genai"
+)
+
+// Metadata is the structured knowledge about a document.
+//
+// It is stored in the Drive appProperties of the file, where it can be queried,
+// and mirrored in a human-readable block at the end of the file description.
+type Metadata struct {
+	DocumentType string       `json:"document_type,omitempty"` // The kind of document, like "passport" or "utility_bill".
+	Holder       string       `json:"holder,omitempty"`        // The person or entity the document is about.
+	BirthDate    string       `json:"birth_date,omitempty"`    // The birth date of the holder, YYYY-MM-DD.
+	Issuer       string       `json:"issuer,omitempty"`        // The authority or company that issued the document.
+	IssueDate    string       `json:"issue_date,omitempty"`    // YYYY-MM-DD.
+	ExpiryDate   string       `json:"expiry_date,omitempty"`   // YYYY-MM-DD.
+	Identifiers  []Identifier `json:"identifiers,omitempty"`   // Document numbers, account numbers, etc.
+	Address      string       `json:"address,omitempty"`       // The postal address on the document.
+	Amounts      []Amount     `json:"amounts,omitempty"`       // Money amounts, like a total or a salary.
+	Language     string       `json:"language,omitempty"`      // ISO 639-1 code of the document language, like "fr".
+	// SourceMD5 is the checksum of the file content the metadata was written for.
+	// It is set when the metadata is stored, and tells when the file has changed since.
+	SourceMD5 string `json:"source_md5,omitempty"`
+	// Described is the RFC 3339 time the description and metadata were written, set when the metadata is stored.
+	// Google Workspace files have no checksum: a later modified time tells when they have changed since.
+	Described string `json:"described,omitempty"`
+}
+
+// Identifier is a number or code identifying something, like a passport number or an IBAN.
+type Identifier struct {
+	Kind  string `json:"kind"` // Like "passport_number", "iban", "tax_id".
+	Value string `json:"value"`
+}
+
+// invalidIdentifiers returns a problem for each identifier failing the validator of its kind, like the checksum of an IBAN.
+func (m *Metadata) invalidIdentifiers() []string {
+	var problems []string
+	for _, id := range m.Identifiers {
+		if err := validate.Check(id.Kind, id.Value); err != nil && !errors.Is(err, validate.ErrUnsupported) {
+			problems = append(problems, fmt.Sprintf("%s %q is invalid: %v", id.Kind, id.Value, err))
+		}
+	}
+	return problems
+}
+
+// Amount is a money amount found in a document.
+type Amount struct {
+	Label    string `json:"label"`              // Like "total", "net_salary".
+	Value    string `json:"value"`              // Decimal number with a dot, like "1234.56".
+	Currency string `json:"currency,omitempty"` // ISO 4217 code, like "EUR".
+}
+
+// Keys of the Metadata in the appProperties.
+const (
+	propPrefix     = "b3."
+	propVersion    = propPrefix + "v"
+	propType       = propPrefix + "type"
+	propHolder     = propPrefix + "holder"
+	propBirthDate  = propPrefix + "born"
+	propIssuer     = propPrefix + "issuer"
+	propIssueDate  = propPrefix + "issued"
+	propExpiryDate = propPrefix + "expires"
+	propID         = propPrefix + "id." // Followed by the identifier kind.
+	propAddress    = propPrefix + "address"
+	propAmount     = propPrefix + "amount." // Followed by the amount label.
+	propLanguage   = propPrefix + "lang"
+	propSource     = propPrefix + "src"
+	propDescribed  = propPrefix + "at"
+)
+
+// maxRepeated is the maximum number of identifiers of a kind, or amounts of a label, in a Metadata.
+// After the first, they are stored with a numbered key, like "b3.id.iban#2".
+const maxRepeated = 5
+
+// numberedKey returns the appProperty key of the n-th value of a repeated field, starting at 1.
+func numberedKey(key string, n int) string {
+	if n == 1 {
+		return key
+	}
+	return fmt.Sprintf("%s#%d", key, n)
+}
+
+// splitNumberedKey returns the key of a repeated field and its number, like "b3.id.iban" and 2 for "b3.id.iban#2".
+// Kinds and labels never contain a '#', see propertyKey, so that a label like "2024" is not taken for a number.
+func splitNumberedKey(key string) (string, int) {
+	if i := strings.LastIndexByte(key, '#'); i >= 0 {
+		if n, err := strconv.Atoi(key[i+1:]); err == nil && n > 1 {
+			return key[:i], n
+		}
+	}
+	return key, 1
+}
+
+// Drive limits on appProperties.
+const (
+	maxPropertyBytes = 124 // Key and value, in UTF-8 bytes.
+	maxProperties    = 30  // Per application and per file.
+)
+
+// metadataVersion is the version of the appProperties layout.
+const metadataVersion = "1"
+
+// dateLayout is the layout of all dates in Metadata.
+const dateLayout = "2006-01-02"
+
+// Validate checks the field formats.
+func (m *Metadata) Validate() error {
+	for _, d := range []struct{ name, value string }{{"birth_date", m.BirthDate}, {"issue_date", m.IssueDate}, {"expiry_date", m.ExpiryDate}} {
+		if d.value == "" {
+			continue
+		}
+		if _, err := time.Parse(dateLayout, d.value); err != nil {
+			return fmt.Errorf("%s: %q is not a YYYY-MM-DD date", d.name, d.value)
+		}
+	}
+	kinds := make(map[string]int)
+	for i, id := range m.Identifiers {
+		if propertyKey(id.Kind) == "" || id.Value == "" {
+			return fmt.Errorf("identifiers[%d]: both kind and value are required", i)
+		}
+		if kinds[propertyKey(id.Kind)]++; kinds[propertyKey(id.Kind)] > maxRepeated {
+			return fmt.Errorf("identifiers[%d]: at most %d identifiers of kind %q", i, maxRepeated, id.Kind)
+		}
+	}
+	labels := make(map[string]int)
+	for i, a := range m.Amounts {
+		if propertyKey(a.Label) == "" || a.Value == "" {
+			return fmt.Errorf("amounts[%d]: both label and value are required", i)
+		}
+		if labels[propertyKey(a.Label)]++; labels[propertyKey(a.Label)] > maxRepeated {
+			return fmt.Errorf("amounts[%d]: at most %d amounts labeled %q", i, maxRepeated, a.Label)
+		}
+	}
+	if m.Language != "" && len(m.Language) != 2 {
+		return fmt.Errorf("language: %q is not a two letter ISO 639-1 code", m.Language)
+	}
+	return nil
+}
+
+// propertyKey normalizes a name to be used in an appProperty key, like "Passport Number" to "passport_number".
+func propertyKey(name string) string {
+	return strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '_'
+		}
+	}, name), "_")
+}
+
+// AppProperties returns the Metadata as Drive appProperties.
+// It fails if Drive limits are exceeded, so that nothing is silently truncated.
+func (m *Metadata) AppProperties() (map[string]string, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	props := map[string]string{propVersion: metadataVersion}
+	set := func(key, value string) {
+		if value != "" {
+			props[key] = value
+		}
+	}
+	set(propType, m.DocumentType)
+	set(propHolder, m.Holder)
+	set(propBirthDate, m.BirthDate)
+	set(propIssuer, m.Issuer)
+	set(propIssueDate, m.IssueDate)
+	set(propExpiryDate, m.ExpiryDate)
+	// Identifiers of the same kind, like two IBANs, and amounts with the same label are numbered.
+	count := make(map[string]int)
+	setNumbered := func(key, value string) {
+		count[key]++
+		set(numberedKey(key, count[key]), value)
+	}
+	for _, id := range m.Identifiers {
+		setNumbered(propID+propertyKey(id.Kind), id.Value)
+	}
+	set(propAddress, m.Address)
+	for _, a := range m.Amounts {
+		value := a.Value
+		if a.Currency != "" {
+			value += " " + a.Currency
+		}
+		setNumbered(propAmount+propertyKey(a.Label), value)
+	}
+	set(propLanguage, m.Language)
+	set(propSource, m.SourceMD5)
+	set(propDescribed, m.Described)
+
+	if len(props) > maxProperties {
+		return nil, fmt.Errorf("too many fields: Drive stores at most %d properties per file, got %d", maxProperties, len(props))
+	}
+	for k, v := range props {
+		if len(k)+len(v) > maxPropertyBytes {
+			return nil, fmt.Errorf("%s: %q is too long, Drive stores at most %d bytes per property, shorten it", strings.TrimPrefix(k, propPrefix), v, maxPropertyBytes-len(k))
+		}
+	}
+	return props, nil
+}
+
+// MetadataFromAppProperties reads the Metadata stored in Drive appProperties.
+// It returns nil when there is none.
+func MetadataFromAppProperties(props map[string]string) *Metadata {
+	if props[propVersion] == "" {
+		return nil
+	}
+	m := &Metadata{
+		DocumentType: props[propType],
+		Holder:       props[propHolder],
+		BirthDate:    props[propBirthDate],
+		Issuer:       props[propIssuer],
+		IssueDate:    props[propIssueDate],
+		ExpiryDate:   props[propExpiryDate],
+		Address:      props[propAddress],
+		Language:     props[propLanguage],
+		SourceMD5:    props[propSource],
+		Described:    props[propDescribed],
+	}
+	// Sort keys for a deterministic order of identifiers and amounts, numbered ones in their order.
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ki, ni := splitNumberedKey(keys[i])
+		kj, nj := splitNumberedKey(keys[j])
+		if ki != kj {
+			return ki < kj
+		}
+		return ni < nj
+	})
+	for _, k := range keys {
+		key, _ := splitNumberedKey(k)
+		if kind, ok := strings.CutPrefix(key, propID); ok {
+			m.Identifiers = append(m.Identifiers, Identifier{Kind: kind, Value: props[k]})
+		}
+		if label, ok := strings.CutPrefix(key, propAmount); ok {
+			value, currency, _ := strings.Cut(props[k], " ")
+			m.Amounts = append(m.Amounts, Amount{Label: label, Value: value, Currency: currency})
+		}
+	}
+	return m
+}
+
+// metadataMarker starts the human-readable copy of the Metadata in a description.
+const metadataMarker = "[B3 metadata]"
+
+// String returns the human-readable block mirrored in descriptions.
+func (m *Metadata) String() string {
+	var b strings.Builder
+	b.WriteString(metadataMarker + "\n")
+	line := func(label, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", label, value)
+		}
+	}
+	line("Type", m.DocumentType)
+	line("Holder", m.Holder)
+	line("Born", m.BirthDate)
+	line("Issuer", m.Issuer)
+	line("Issued", m.IssueDate)
+	line("Expires", m.ExpiryDate)
+	for _, id := range m.Identifiers {
+		line(id.Kind, id.Value)
+	}
+	line("Address", m.Address)
+	for _, a := range m.Amounts {
+		line(a.Label, strings.TrimSpace(a.Value+" "+a.Currency))
+	}
+	line("Language", m.Language)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// stripMetadata returns the description without its metadata block.
+func stripMetadata(description string) string {
+	if i := strings.Index(description, metadataMarker); i >= 0 {
+		description = description[:i]
+	}
+	return strings.TrimSpace(description)
+}
+
+// withMetadata returns the description with its metadata block replaced by m.
+func withMetadata(description string, m *Metadata) string {
+	prose := stripMetadata(description)
+	if prose == "" {
+		return m.String()
+	}
+	return prose + "\n\n" + m.String()
+}
+
+// SetMetadata stores the Metadata of a file in its appProperties, replacing the previous one,
+// and mirrors it at the end of the description.
+//
+// If description is empty, the current description is kept and only its metadata block is updated.
+func (a *App) SetMetadata(ctx context.Context, fileID string, m *Metadata, description string) error {
+	if err := a.checkOnline(); err != nil {
+		return err
+	}
+	if err := m.Validate(); err != nil {
+		return fmt.Errorf("invalid metadata: %w", err)
+	}
+
+	current, err := a.filesGet(ctx, fileID).Fields("description", "appProperties", "md5Checksum").Do()
+	if err != nil {
+		return fmt.Errorf("unable to get metadata for file %s: %w", fileID, a.scopeError(err))
+	}
+	// The metadata describes the current content, as of now.
+	stamped := *m
+	if stamped.SourceMD5 == "" {
+		stamped.SourceMD5 = current.Md5Checksum
+	}
+	stamped.Described = time.Now().UTC().Format(time.RFC3339)
+	m = &stamped
+	props, err := m.AppProperties()
+	if err != nil {
+		return fmt.Errorf("invalid metadata: %w", err)
+	}
+	if description == "" {
+		description = current.Description
+	}
+
+	update := &drive.File{
+		AppProperties:   props,
+		Description:     withMetadata(description, m),
+		ForceSendFields: []string{"AppProperties"},
+	}
+	// Remove the properties of the previous metadata that are not set anymore.
+	for k := range current.AppProperties {
+		if _, ok := props[k]; !ok && strings.HasPrefix(k, propPrefix) {
+			update.NullFields = append(update.NullFields, "AppProperties."+k)
+		}
+	}
+	if _, err := a.filesUpdate(ctx, fileID, update).Fields("id").Do(); err != nil {
+		return fmt.Errorf("failed to update metadata for file %s: %w", fileID, a.scopeError(err))
+	}
+	return nil
+}
+
+// metadataFromArgs decodes a Metadata passed by the model as a tool argument.
+func metadataFromArgs(arg any) (*Metadata, error) {
+	data, err := json.Marshal(arg)
+	if err != nil {
+		return nil, err
+	}
+	m := &Metadata{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid metadata: %w", err)
+	}
+	return m, m.Validate()
+}
+
+// metadataSchema describes Metadata to the model.
+func metadataSchema() *genai.Schema {
+	str := func(description string) *genai.Schema {
+		return &genai.Schema{Type: genai.TypeString, Description: description}
+	}
+	return &genai.Schema{
+		Type:        genai.TypeObject,
+		Description: "Structured facts about the document. Only fill the fields actually present in the document.",
+		Properties: map[string]*genai.Schema{
+			"document_type": str("The kind of document, in snake_case, like passport, national_id, payslip, utility_bill, lease."),
+			"holder":        str("Full name of the person or entity the document is about."),
+			"birth_date":    str("Birth date of the holder, formatted as YYYY-MM-DD, if written."),
+			"issuer":        str("The authority or company that issued the document."),
+			"issue_date":    str("Issue date, formatted as YYYY-MM-DD."),
+			"expiry_date":   str("Expiry or end of validity date, formatted as YYYY-MM-DD."),
+			"identifiers": {
+				Type:        genai.TypeArray,
+				Description: "Document numbers, account numbers, reference codes, etc.",
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"kind":  str("What the identifier is, in snake_case, like passport_number, iban, tax_id, contract_number."),
+						"value": str("The identifier, exactly as written."),
+					},
+					Required: []string{"kind", "value"},
+				},
+			},
+			"address": str("The postal address on the document, on one line."),
+			"amounts": {
+				Type:        genai.TypeArray,
+				Description: "Money amounts, like a total to pay or a salary.",
+				Items: &genai.Schema{
+					Type: genai.TypeObject,
+					Properties: map[string]*genai.Schema{
+						"label":    str("What the amount is, in snake_case, like total, net_salary, monthly_rent."),
+						"value":    str("Decimal number with a dot, like 1234.56."),
+						"currency": str("ISO 4217 currency code, like EUR."),
+					},
+					Required: []string{"label", "value"},
+				},
+			},
+			"language": str("ISO 639-1 code of the document language, like fr."),
+		},
+	}
+}
@@ -0,0 +1,176 @@
+package b3app
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMetadataAppPropertiesRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		m    *Metadata
+	}{
+		{"empty", &Metadata{}},
+		{
+			name: "all fields",
+			m: &Metadata{
+				DocumentType: "passport", Holder: "Marie Curie", BirthDate: "1867-11-07", Issuer: "Préfecture de Paris",
+				IssueDate: "2021-03-12", ExpiryDate: "2031-03-11",
+				Identifiers: []Identifier{{Kind: "mrz", Value: "P<FRACURIE<<MARIE"}, {Kind: "passport_number", Value: "21AB12345"}},
+				Address:     "36 quai de Béthune, 75004 Paris",
+				Amounts:     []Amount{{Label: "fee", Value: "86", Currency: "EUR"}, {Label: "total", Value: "86.00"}},
+				Language:    "fr", SourceMD5: "0123456789abcdef",
+			},
+		},
+		{
+			name: "repeated kinds and labels",
+			m: &Metadata{
+				Identifiers: []Identifier{
+					{Kind: "iban", Value: "FR7630006000011234567890189"},
+					{Kind: "bic", Value: "AGRIFRPP"},
+					{Kind: "iban", Value: "DE89370400440532013000"},
+					{Kind: "iban", Value: "GB29NWBK60161331926819"},
+				},
+				Amounts: []Amount{{Label: "payment", Value: "10", Currency: "EUR"}, {Label: "payment", Value: "20", Currency: "EUR"}},
+			},
+		},
+		{
+			// Numeric kinds and labels are not taken for the number of a repeated field.
+			name: "numeric kinds and labels",
+			m: &Metadata{
+				Identifiers: []Identifier{{Kind: "2", Value: "first"}, {Kind: "2", Value: "second"}},
+				Amounts:     []Amount{{Label: "2024", Value: "1200", Currency: "EUR"}, {Label: "2023", Value: "1100", Currency: "EUR"}, {Label: "2024", Value: "80"}},
+			},
+		},
+		{
+			name: "five of a kind",
+			m: &Metadata{Identifiers: []Identifier{
+				{Kind: "ref", Value: "1"}, {Kind: "ref", Value: "2"}, {Kind: "ref", Value: "3"}, {Kind: "ref", Value: "4"}, {Kind: "ref", Value: "5"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			props, err := tt.m.AppProperties()
+			if err != nil {
+				t.Fatalf("AppProperties() error = %v", err)
+			}
+			got := MetadataFromAppProperties(props)
+			// Identifiers and amounts come back sorted by kind and label, in their order within a kind.
+			want := *tt.m
+			want.Identifiers = sortedIdentifiers(tt.m.Identifiers)
+			want.Amounts = sortedAmounts(tt.m.Amounts)
+			if !reflect.DeepEqual(got, &want) {
+				t.Errorf("MetadataFromAppProperties(%v) = %+v, want %+v", props, got, &want)
+			}
+		})
+	}
+}
+
+// sortedIdentifiers returns the identifiers sorted by kind, in their order within a kind.
+func sortedIdentifiers(ids []Identifier) []Identifier {
+	return slices.SortedStableFunc(slices.Values(ids), func(a, b Identifier) int { return strings.Compare(a.Kind, b.Kind) })
+}
+
+// sortedAmounts returns the amounts sorted by label, in their order within a label.
+func sortedAmounts(amounts []Amount) []Amount {
+	return slices.SortedStableFunc(slices.Values(amounts), func(a, b Amount) int { return strings.Compare(a.Label, b.Label) })
+}
+
+func TestMetadataAppPropertiesKeys(t *testing.T) {
+	m := &Metadata{
+		Identifiers: []Identifier{{Kind: "IBAN", Value: "A"}, {Kind: "iban", Value: "B"}, {Kind: "Passport Number", Value: "C"}},
+		Amounts:     []Amount{{Label: "total", Value: "1"}, {Label: "Total", Value: "2", Currency: "EUR"}},
+	}
+	props, err := m.AppProperties()
+	if err != nil {
+		t.Fatalf("AppProperties() error = %v", err)
+	}
+	want := map[string]string{
+		"b3.v": "1", "b3.id.iban": "A", "b3.id.iban#2": "B", "b3.id.passport_number": "C",
+		"b3.amount.total": "1", "b3.amount.total#2": "2 EUR",
+	}
+	if !reflect.DeepEqual(props, want) {
+		t.Errorf("AppProperties() = %v, want %v", props, want)
+	}
+}
+
+func TestMetadataAppPropertiesErrors(t *testing.T) {
+	six := make([]Identifier, maxRepeated+1)
+	for i := range six {
+		six[i] = Identifier{Kind: "iban", Value: "x"}
+	}
+	tests := []struct {
+		name string
+		m    *Metadata
+		want string
+	}{
+		{"bad date", &Metadata{IssueDate: "12/03/2021"}, "issue_date"},
+		{"identifier without kind", &Metadata{Identifiers: []Identifier{{Kind: "é", Value: "x"}}}, "identifiers[0]"},
+		{"amount without value", &Metadata{Amounts: []Amount{{Label: "total"}}}, "amounts[0]"},
+		{"too many of a kind", &Metadata{Identifiers: six}, "at most"},
+		{"language", &Metadata{Language: "fra"}, "language"},
+		{"too long", &Metadata{Address: strings.Repeat("a", maxPropertyBytes)}, "too long"},
+	}
+	for _, tt := range tests {
+		if _, err := tt.m.AppProperties(); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: AppProperties() error = %v, want it to mention %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestMetadataFromAppProperties(t *testing.T) {
+	if m := MetadataFromAppProperties(map[string]string{"other": "x"}); m != nil {
+		t.Errorf("MetadataFromAppProperties() without version = %+v, want nil", m)
+	}
+	// Numbered keys sort numerically.
+	props := map[string]string{"b3.v": "1", "b3.id.ref#10": "ten", "b3.id.ref#2": "two", "b3.id.ref": "one"}
+	want := []Identifier{{Kind: "ref", Value: "one"}, {Kind: "ref", Value: "two"}, {Kind: "ref", Value: "ten"}}
+	if got := MetadataFromAppProperties(props).Identifiers; !reflect.DeepEqual(got, want) {
+		t.Errorf("MetadataFromAppProperties().Identifiers = %v, want %v", got, want)
+	}
+}
+
+func TestQueryRepeatedIdentifiers(t *testing.T) {
+	clauses, err := (&FileQuery{Metadata: map[string]string{"identifier.iban": "FR76"}}).clauses()
+	if err != nil {
+		t.Fatalf("clauses() error = %v", err)
+	}
+	q := strings.Join(clauses, " and ")
+	for _, key := range []string{"'b3.id.iban'", "'b3.id.iban#2'", "'b3.id.iban#5'"} {
+		if !strings.Contains(q, key) {
+			t.Errorf("clauses() = %s, want a clause on %s", q, key)
+		}
+	}
+}
+
+func TestQueryClausesEscaping(t *testing.T) {
+	q := &FileQuery{
+		NameContains: `O'Brien`,
+		FullText:     `C:\Scans`,
+		Metadata: map[string]string{
+			"holder":             `Seán O'Brien`,
+			"birth_date":         "1980-01-02",
+			`identifier.o'k\ref`: `12\'34`,
+		},
+	}
+	clauses, err := q.clauses()
+	if err != nil {
+		t.Fatalf("clauses() error = %v", err)
+	}
+	want := []string{
+		`name contains 'O\'Brien'`,
+		`fullText contains 'C:\\Scans'`,
+		`appProperties has { key='b3.born' and value='1980-01-02' }`,
+		`appProperties has { key='b3.holder' and value='Seán O\'Brien' }`,
+	}
+	if !reflect.DeepEqual(clauses[:len(want)], want) {
+		t.Errorf("clauses() = %q, want %q", clauses[:len(want)], want)
+	}
+	// Names are turned into keys without quotes nor backslashes, values are escaped.
+	if got, want := clauses[len(want)], `appProperties has { key='b3.id.o_k_ref' and value='12\\\'34' }`; !strings.Contains(got, want) {
+		t.Errorf("clauses() identifier = %s, want it to contain %s", got, want)
+	}
+}
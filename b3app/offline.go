@@ -0,0 +1,75 @@
+package b3app
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrOffline is returned by operations that need Google Drive when B3 runs offline.
+var ErrOffline = errors.New("B3 is offline: this operation needs access to Google Drive")
+
+// NewOffline creates an App that works from the local index only, without any access to Google Drive.
+//
+// Listing and searching use the index as it was at the last synchronization,
+// and only pinned files (see Pin) can be read. All other operations return ErrOffline.
+func NewOffline(cfg *Config) (*App, error) {
+	if cfg == nil {
+		var err error
+		if cfg, err = LoadConfig(""); err != nil {
+			return nil, err
+		}
+	}
+	idx, err := loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil {
+		return nil, fmt.Errorf("no local index yet: run B3 once while online to build it")
+	}
+	return &App{
+		Config:    cfg,
+		Offline:   true,
+		DriveID:   idx.DriveID,
+		folderIDs: map[string]string{"B3": idx.B3FolderID, "B4": idx.B4FolderID},
+		index:     idx,
+	}, nil
+}
+
+// checkOnline returns ErrOffline when the App has no access to Google Drive.
+func (a *App) checkOnline() error {
+	if a.Offline {
+		return ErrOffline
+	}
+	return nil
+}
+
+// IndexSynced returns the time of the last successful synchronization of the local index,
+// or the zero time if there is no index yet.
+func (a *App) IndexSynced() time.Time {
+	a.indexMu.Lock()
+	defer a.indexMu.Unlock()
+	if a.index == nil {
+		return time.Time{}
+	}
+	return a.index.Synced
+}
+
+// Staleness describes how old the local index is, like "synchronized 3h ago".
+func (a *App) Staleness() string {
+	synced := a.IndexSynced()
+	if synced.IsZero() {
+		return "never synchronized"
+	}
+	age := time.Since(synced)
+	switch {
+	case age < time.Minute:
+		return "synchronized just now"
+	case age < time.Hour:
+		return fmt.Sprintf("synchronized %dm ago", int(age.Minutes()))
+	case age < 48*time.Hour:
+		return fmt.Sprintf("synchronized %dh ago", int(age.Hours()))
+	default:
+		return fmt.Sprintf("synchronized %d days ago", int(age.Hours()/24))
+	}
+}
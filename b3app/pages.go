@@ -0,0 +1,259 @@
+package b3app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"google.golang.org/genai"
+)
+
+const pdfMimeType = "application/pdf"
+
+// pageSelection matches a page selection without spaces, like "1,4-6".
+var pageSelection = regexp.MustCompile(`^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$`)
+
+// ErrTooLong is matched by the errors of documents over the limits of the 'analysis' section,
+// which can only be read section by section.
+var ErrTooLong = errors.New("document too long to be read at once")
+
+// tooLongError is an error matching ErrTooLong, telling how to read the document anyway.
+type tooLongError struct{ msg string }
+
+func (e *tooLongError) Error() string        { return e.msg }
+func (e *tooLongError) Is(target error) bool { return target == ErrTooLong }
+
+// cleanPages checks the syntax of a page selection, and returns it without spaces.
+func cleanPages(spec string) (string, error) {
+	spec = strings.Join(strings.Fields(spec), "")
+	if spec != "" && !pageSelection.MatchString(spec) {
+		return "", fmt.Errorf("invalid page selection %q: expected pages like \"3-5\" or \"1,4-6\"", spec)
+	}
+	return spec, nil
+}
+
+// parsePages parses a page selection like "3-5" or "1,4-6,9" of a document of count pages.
+// It returns the selected pages, sorted and without duplicates.
+func parsePages(spec string, count int) ([]int, error) {
+	selected := make(map[int]bool)
+	for _, r := range strings.Split(spec, ",") {
+		r = strings.TrimSpace(r)
+		from, to, isRange := strings.Cut(r, "-")
+		first, err := strconv.Atoi(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("invalid page selection %q: expected pages like \"3-5\" or \"1,4-6\"", spec)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(strings.TrimSpace(to)); err != nil {
+				return nil, fmt.Errorf("invalid page selection %q: expected pages like \"3-5\" or \"1,4-6\"", spec)
+			}
+		}
+		if first < 1 || last < first || last > count {
+			return nil, fmt.Errorf("invalid page range %q: the document has %d pages", r, count)
+		}
+		for p := first; p <= last; p++ {
+			selected[p] = true
+		}
+	}
+	pages := make([]int, 0, len(selected))
+	for p := range selected {
+		pages = append(pages, p)
+	}
+	sort.Ints(pages)
+	return pages, nil
+}
+
+// formatPages formats sorted pages as a compact selection, like "1,4-6".
+func formatPages(pages []int) string {
+	var ranges []string
+	for i := 0; i < len(pages); {
+		j := i
+		for j+1 < len(pages) && pages[j+1] == pages[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(pages[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", pages[i], pages[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
+
+// pdfPageCount returns the number of pages of a PDF.
+func pdfPageCount(content []byte) (int, error) {
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+	n, err := api.PageCount(bytes.NewReader(content), conf)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the PDF pages: %w", err)
+	}
+	return n, nil
+}
+
+// selectPDFPages returns a PDF made of the given pages of content only.
+func selectPDFPages(content []byte, pages []int) ([]byte, error) {
+	selection := make([]string, len(pages))
+	for i, p := range pages {
+		selection[i] = strconv.Itoa(p)
+	}
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+	var buf bytes.Buffer
+	if err := api.Trim(bytes.NewReader(content), &buf, selection, conf); err != nil {
+		return nil, fmt.Errorf("failed to extract pages %s: %w", formatPages(pages), err)
+	}
+	return buf.Bytes(), nil
+}
+
+// excerpt is the part of a document sent to the model.
+type excerpt struct {
+	Content  []byte
+	MimeType string
+	Pages    []int         // The pages of the document in the excerpt, nil for the whole document.
+	Total    int           // The number of pages of the document, 0 if unknown.
+	Text     *DocumentText // The text layer of a PDF excerpt, if it could be read.
+}
+
+// selectExcerpt applies the page selection, if any, and the size policy of the 'analysis' section to a document.
+//
+// The errors tell how to read the document anyway, section by section.
+func (a *App) selectExcerpt(content []byte, mimeType, pages string) (*excerpt, error) {
+	cfg := a.Config.Analysis
+	ex := &excerpt{Content: content, MimeType: mimeType}
+	if mimeType == pdfMimeType {
+		total, err := pdfPageCount(content)
+		if err != nil {
+			return nil, err
+		}
+		ex.Total = total
+		if pages != "" {
+			if ex.Pages, err = parsePages(pages, total); err != nil {
+				return nil, err
+			}
+		}
+		read := total
+		if ex.Pages != nil {
+			read = len(ex.Pages)
+		}
+		if read > cfg.MaxPages {
+			return nil, &tooLongError{fmt.Sprintf("too many pages: %d pages selected of a %d-page document, but at most %d are read at once (analysis.max_pages): read it section by section, with pages like \"1-%d\"", read, total, cfg.MaxPages, cfg.MaxPages)}
+		}
+		if ex.Pages != nil {
+			if ex.Content, err = selectPDFPages(content, ex.Pages); err != nil {
+				return nil, err
+			}
+		}
+	} else if pages != "" {
+		return nil, fmt.Errorf("pages can only be selected in PDF files, not in %s", mimeType)
+	}
+
+	if size := len(ex.Content); size > cfg.MaxFileMB<<20 {
+		advice := "it cannot be analyzed"
+		if mimeType == pdfMimeType {
+			advice = "read it section by section, with fewer pages"
+		}
+		return nil, &tooLongError{fmt.Sprintf("too large: %.1f MB to read, but at most %d MB are sent at once (analysis.max_file_mb): %s", float64(size)/(1<<20), cfg.MaxFileMB, advice)}
+	}
+	return ex, nil
+}
+
+// parts returns the model input for the excerpt, and a function to release it once the model has answered.
+//
+// When the text layer is sufficient, only the text is sent. Otherwise, small excerpts are sent inline,
+// and larger ones are uploaded with the Gemini Files API.
+func (ex *excerpt) parts(ctx context.Context, client *genai.Client, inlineLimit int) ([]*genai.Part, func(), error) {
+	var parts []*genai.Part
+	if ex.Pages != nil {
+		parts = append(parts, genai.NewPartFromText(fmt.Sprintf(
+			"This is an excerpt of a %d-page document: its pages %s only. Describe the excerpt, and number its pages from 1.",
+			ex.Total, formatPages(ex.Pages))))
+	}
+	if ex.textOnly() {
+		parts = append(parts, genai.NewPartFromText(
+			"This is the text layer of a PDF document, extracted page by page. Its images, like logos, photos or signatures, are not included.\n\n"+
+				ex.Text.String()))
+		return parts, func() {}, nil
+	}
+	if len(ex.Content) <= inlineLimit {
+		parts = append(parts, &genai.Part{InlineData: &genai.Blob{MIMEType: ex.MimeType, Data: ex.Content}})
+		return parts, func() {}, nil
+	}
+
+	file, err := client.Files.Upload(ctx, bytes.NewReader(ex.Content), &genai.UploadFileConfig{MIMEType: ex.MimeType, DisplayName: "b3 analysis"})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to upload the document for analysis: %w", err)
+	}
+	name := file.Name
+	release := func() {
+		// The file expires anyway, but there is no reason to keep a personal document there.
+		if _, err := client.Files.Delete(context.WithoutCancel(ctx), name, nil); err != nil {
+			log.Printf("warning: could not delete the uploaded file %s: %v", name, err)
+		}
+	}
+	// Large files are processed before they can be used.
+	for file.State == genai.FileStateProcessing {
+		select {
+		case <-ctx.Done():
+			release()
+			return nil, nil, ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+		if file, err = client.Files.Get(ctx, name, nil); err != nil {
+			release()
+			return nil, nil, fmt.Errorf("failed to get the uploaded document: %w", err)
+		}
+	}
+	if file.State == genai.FileStateFailed {
+		release()
+		return nil, nil, fmt.Errorf("the uploaded document could not be processed: %v", file.Error)
+	}
+	return append(parts, genai.NewPartFromURI(file.URI, file.MIMEType)), release, nil
+}
+
+// textOnly reports whether the text layer of the excerpt is enough to analyze it.
+func (ex *excerpt) textOnly() bool {
+	return ex.Text != nil && ex.Text.Sufficient()
+}
+
+// renumber maps the page numbers of an extraction from an excerpt to the pages of the whole document.
+func (e *Extraction) renumber(pages []int) {
+	if pages == nil {
+		return
+	}
+	remap := func(ps []int) []int {
+		out := make([]int, 0, len(ps))
+		for _, p := range ps {
+			if p >= 1 && p <= len(pages) {
+				out = append(out, pages[p-1])
+			}
+		}
+		return out
+	}
+	e.DocumentType.Pages = remap(e.DocumentType.Pages)
+	if e.Issuer != nil {
+		e.Issuer.Pages = remap(e.Issuer.Pages)
+	}
+	for _, fields := range [][]ExtractedField{e.Dates, e.Identifiers, e.Addresses} {
+		for i := range fields {
+			fields[i].Pages = remap(fields[i].Pages)
+		}
+	}
+	for i := range e.People {
+		e.People[i].Pages = remap(e.People[i].Pages)
+	}
+	for i := range e.Amounts {
+		e.Amounts[i].Pages = remap(e.Amounts[i].Pages)
+	}
+}
@@ -0,0 +1,124 @@
+package b3app
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestCleanPages(t *testing.T) {
+	tests := []struct {
+		spec, want string
+		ok         bool
+	}{
+		{"", "", true},
+		{"3", "3", true},
+		{" 3 - 5 ", "3-5", true},
+		{"1, 4-6", "1,4-6", true},
+		{"1;2", "", false},
+		{"3-", "", false},
+		{"-3", "", false},
+		{"a", "", false},
+	}
+	for _, test := range tests {
+		got, err := cleanPages(test.spec)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("cleanPages(%q) = %q, %v, want %q, ok %v", test.spec, got, err, test.want, test.ok)
+		}
+	}
+}
+
+func TestParsePages(t *testing.T) {
+	tests := []struct {
+		spec  string
+		count int
+		want  []int
+	}{
+		{"1", 1, []int{1}},
+		{"3-5", 10, []int{3, 4, 5}},
+		{"1,4-6,9", 10, []int{1, 4, 5, 6, 9}},
+		{"5-6,1-2", 10, []int{1, 2, 5, 6}},
+		{"1-3,2-4", 10, []int{1, 2, 3, 4}},
+		{"7-7", 7, []int{7}},
+		{"0", 10, nil},
+		{"5-3", 10, nil},
+		{"9-11", 10, nil},
+		{"x", 10, nil},
+		{"1-x", 10, nil},
+	}
+	for _, test := range tests {
+		got, err := parsePages(test.spec, test.count)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("parsePages(%q, %d) = %v, want an error", test.spec, test.count, got)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parsePages(%q, %d) = %v, %v, want %v", test.spec, test.count, got, err, test.want)
+		}
+	}
+}
+
+func TestFormatPages(t *testing.T) {
+	tests := []struct {
+		pages []int
+		want  string
+	}{
+		{nil, ""},
+		{[]int{1}, "1"},
+		{[]int{1, 2}, "1-2"},
+		{[]int{3, 4, 5}, "3-5"},
+		{[]int{1, 4, 5, 6, 9}, "1,4-6,9"},
+		{[]int{1, 3, 5}, "1,3,5"},
+	}
+	for _, test := range tests {
+		if got := formatPages(test.pages); got != test.want {
+			t.Errorf("formatPages(%v) = %q, want %q", test.pages, got, test.want)
+		}
+		// Formatted pages parse back to the same pages.
+		if test.pages != nil {
+			if back, err := parsePages(test.want, 10); err != nil || !reflect.DeepEqual(back, test.pages) {
+				t.Errorf("parsePages(%q) = %v, %v, want %v", test.want, back, err, test.pages)
+			}
+		}
+	}
+}
+
+func TestSelectExcerptTooLong(t *testing.T) {
+	a := newTestApp(t)
+	a.Config.Analysis.MaxFileMB = 1
+	if _, err := a.selectExcerpt(make([]byte, 1<<20+1), "text/plain", ""); !errors.Is(err, ErrTooLong) {
+		t.Errorf("selectExcerpt of a large file = %v, want ErrTooLong", err)
+	}
+	if _, err := a.selectExcerpt([]byte("short"), "text/plain", "1"); err == nil || errors.Is(err, ErrTooLong) {
+		t.Errorf("selectExcerpt of pages of a text = %v, want another error", err)
+	}
+	if _, err := a.selectExcerpt([]byte("short"), "text/plain", ""); err != nil {
+		t.Errorf("selectExcerpt of a short text failed: %v", err)
+	}
+}
+
+func TestNewAnalysisExcerpt(t *testing.T) {
+	a := newTestApp(t)
+	e := &Extraction{
+		SuggestedName: "Passport.pdf",
+		DocumentType:  ExtractedField{Value: "passport"},
+		Summary:       "A passport.",
+		People:        []ExtractedPerson{{Name: "Louis Martin", Role: "holder"}},
+	}
+
+	whole := a.newAnalysis(e, nil, "md5", "", nil)
+	if whole.Metadata == nil || whole.Metadata.SourceMD5 != "md5" || whole.SuggestedName == "" {
+		t.Errorf("analysis of the whole file = %+v, want a name and metadata of md5", whole)
+	}
+
+	// An excerpt does not describe the whole file.
+	part := a.newAnalysis(e, nil, "md5", "2-3", nil)
+	if part.Metadata != nil || part.SuggestedName != "" || part.Folder != "" {
+		t.Errorf("analysis of pages 2-3 = %+v, want no name, folder nor metadata", part)
+	}
+	if part.Description == "" || part.Pages != "2-3" {
+		t.Errorf("analysis of pages 2-3 = %+v, want a description of the pages", part)
+	}
+}
@@ -0,0 +1,796 @@
+package b3app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+// DocumentText is the text of a document, page by page, read locally.
+type DocumentText struct {
+	Pages  []PageText  `json:"pages"`
+	Fields []FormValue `json:"form_fields,omitempty"` // The filled fields of a PDF form.
+}
+
+// PageText is the text of a page.
+type PageText struct {
+	Page int    `json:"page"` // 1-based page number.
+	Text string `json:"text"`
+}
+
+// FormValue is the value of a filled field of a PDF form.
+type FormValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Pages []int  `json:"pages,omitempty"`
+}
+
+// minPageText is the number of letters and digits under which a page is considered to have no text layer,
+// like a scan with only a page number printed on it.
+const minPageText = 40
+
+// Sufficient reports whether the text stands for the document: every page has a text layer,
+// and almost all of it could be decoded.
+func (t *DocumentText) Sufficient() bool {
+	if len(t.Pages) == 0 {
+		return false
+	}
+	for _, p := range t.Pages {
+		words, undecoded := 0, 0
+		for _, r := range p.Text {
+			switch {
+			case r == unicode.ReplacementChar:
+				undecoded++
+			case unicode.IsLetter(r) || unicode.IsDigit(r):
+				words++
+			}
+		}
+		if words < minPageText || undecoded*100 > words {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the text for the model, with the page numbers.
+func (t *DocumentText) String() string {
+	var b strings.Builder
+	for _, p := range t.Pages {
+		fmt.Fprintf(&b, "--- Page %d ---\n%s\n", p.Page, p.Text)
+	}
+	if len(t.Fields) > 0 {
+		b.WriteString("--- Form fields ---\n")
+		for _, f := range t.Fields {
+			fmt.Fprintf(&b, "%s: %s\n", f.Name, f.Value)
+		}
+	}
+	return b.String()
+}
+
+// Plain returns the text of the pages and the values of the fields, without page numbers.
+func (t *DocumentText) Plain() string {
+	var parts []string
+	for _, p := range t.Pages {
+		if p.Text != "" {
+			parts = append(parts, p.Text)
+		}
+	}
+	for _, f := range t.Fields {
+		parts = append(parts, f.Value)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// ExtractPDFText reads the text layer and the form values of a PDF.
+//
+// The text is in the order of the content streams, which is the reading order of most generated documents.
+// Scans have no text layer: their pages are empty.
+func ExtractPDFText(content []byte) (t *DocumentText, err error) {
+	// pdfcpu panics on some corrupt files: they are an error like any unreadable PDF.
+	defer func() {
+		if r := recover(); r != nil {
+			t, err = nil, fmt.Errorf("failed to read the PDF: %v", r)
+		}
+	}()
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+	ctx, err := api.ReadAndValidate(bytes.NewReader(content), conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the PDF: %w", err)
+	}
+
+	t = &DocumentText{}
+	for nr := 1; nr <= ctx.PageCount; nr++ {
+		d, _, inherited, err := ctx.PageDict(nr, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read page %d: %w", nr, err)
+		}
+		stream, err := ctx.PageContent(d, nr)
+		if err != nil && err != model.ErrNoContent {
+			return nil, fmt.Errorf("failed to read page %d: %w", nr, err)
+		}
+		x := &textExtractor{ctx: ctx}
+		x.run(stream, inherited.Resources, 0)
+		t.Pages = append(t.Pages, PageText{Page: nr, Text: x.String()})
+	}
+
+	// A PDF without a form is not an error.
+	if fields, err := api.FormFields(bytes.NewReader(content), conf); err == nil {
+		for _, f := range fields {
+			if v := strings.TrimSpace(f.V); v != "" {
+				t.Fields = append(t.Fields, FormValue{Name: f.Name, Value: v, Pages: f.Pages})
+			}
+		}
+	}
+	return t, nil
+}
+
+// ReadText returns the text of a file, read locally: the text layer and form values of a PDF, at the given pages
+// if set, like "3-5", or the content of a text file, like a Google Sheet exported as CSV.
+func (a *App) ReadText(ctx context.Context, fileID, pages string) (*DocumentText, error) {
+	pages, err := cleanPages(pages)
+	if err != nil {
+		return nil, err
+	}
+	content, mimeType, err := a.GetFileContent(ctx, fileID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case mimeType == pdfMimeType:
+	case strings.HasPrefix(mimeType, "text/") || mimeType == "application/json":
+		if pages != "" {
+			return nil, fmt.Errorf("pages can only be selected in PDF files, not in %s", mimeType)
+		}
+		if len(content) > a.Config.Analysis.MaxFileMB<<20 {
+			return nil, fmt.Errorf("file %s is too large: %.1f MB, but at most %d MB are read at once (analysis.max_file_mb)", fileID, float64(len(content))/(1<<20), a.Config.Analysis.MaxFileMB)
+		}
+		return &DocumentText{Pages: []PageText{{Page: 1, Text: string(content)}}}, nil
+	default:
+		return nil, fmt.Errorf("file %s is a %s, which has no text layer: read it with ReadFile", fileID, mimeType)
+	}
+
+	text, err := ExtractPDFText(content)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the text of file %s: %w", fileID, err)
+	}
+	if pages != "" {
+		selected, err := parsePages(pages, len(text.Pages))
+		if err != nil {
+			return nil, err
+		}
+		text = text.only(selected)
+	}
+	if n := len(text.Pages); n > a.Config.Analysis.MaxPages {
+		return nil, fmt.Errorf("too many pages: %d pages selected, but at most %d are read at once (analysis.max_pages): read it section by section, with pages like \"1-%d\"", n, a.Config.Analysis.MaxPages, a.Config.Analysis.MaxPages)
+	}
+	return text, nil
+}
+
+// only returns the text of the selected pages, and the fields on them.
+func (t *DocumentText) only(pages []int) *DocumentText {
+	selected := make(map[int]bool, len(pages))
+	for _, p := range pages {
+		selected[p] = true
+	}
+	out := &DocumentText{Pages: []PageText{}}
+	for _, p := range t.Pages {
+		if selected[p.Page] {
+			out.Pages = append(out.Pages, p)
+		}
+	}
+	for _, f := range t.Fields {
+		for _, p := range f.Pages {
+			if selected[p] {
+				out.Fields = append(out.Fields, f)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// maxFormDepth limits the nesting of form XObjects, that could loop in a malformed PDF.
+const maxFormDepth = 8
+
+// textExtractor runs the text operators of content streams.
+type textExtractor struct {
+	ctx   *model.Context
+	b     strings.Builder
+	space bool // A space is pending before the next text.
+	line  bool // A new line is pending before the next text.
+}
+
+// String returns the text, with the blanks of each line collapsed, and without blank lines.
+func (x *textExtractor) String() string {
+	var lines []string
+	for _, line := range strings.Split(x.b.String(), "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// write adds decoded text, after the pending separator.
+func (x *textExtractor) write(s string) {
+	if s == "" {
+		return
+	}
+	if x.b.Len() > 0 {
+		switch {
+		case x.line:
+			x.b.WriteByte('\n')
+		case x.space && !strings.HasPrefix(s, " ") && !strings.HasSuffix(x.b.String(), " "):
+			x.b.WriteByte(' ')
+		}
+	}
+	x.space, x.line = false, false
+	x.b.WriteString(s)
+}
+
+// run interprets a content stream using the given resources.
+func (x *textExtractor) run(stream []byte, resources types.Dict, depth int) {
+	fonts := x.fontsOf(resources)
+	var font *fontDecoder
+	// The vertical position of the text line, in user space, and of the last text written.
+	scale, y, written := 1.0, 0.0, math.NaN()
+	write := func(s string) {
+		if s == "" {
+			return
+		}
+		if !math.IsNaN(written) && math.Abs(y-written) > 1 {
+			x.line = true
+		}
+		written = y
+		x.write(s)
+	}
+	lex := &contentLexer{b: stream}
+	var operands []any
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			return
+		}
+		op, isOp := tok.(contentOperator)
+		if !isOp {
+			operands = append(operands, tok)
+			continue
+		}
+		switch op {
+		case "BT":
+			scale, y = 1, 0
+			x.space = true
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[0].(contentName); ok {
+					font = fonts[string(name)]
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				tx, _ := operands[0].(float64)
+				ty, _ := operands[1].(float64)
+				y += ty * scale
+				if tx != 0 {
+					x.space = true
+				}
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				d, _ := operands[3].(float64)
+				if scale = math.Abs(d); scale == 0 {
+					scale = 1
+				}
+				y, _ = operands[5].(float64)
+				x.space = true
+			}
+		case "T*":
+			x.line = true
+		case "Tj":
+			if len(operands) >= 1 {
+				write(font.decode(operands[len(operands)-1]))
+			}
+		case "'", "\"":
+			x.line = true
+			if len(operands) >= 1 {
+				write(font.decode(operands[len(operands)-1]))
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				elems, _ := operands[len(operands)-1].([]any)
+				for _, e := range elems {
+					// Large negative adjustments, in thousandths of a text space unit, separate words.
+					if n, ok := e.(float64); ok && n < -200 {
+						x.space = true
+						continue
+					}
+					write(font.decode(e))
+				}
+			}
+		case "Do":
+			if len(operands) >= 1 && depth < maxFormDepth {
+				if name, ok := operands[0].(contentName); ok {
+					x.runForm(string(name), resources, depth)
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// runForm interprets the form XObject named name in resources, if it is one.
+func (x *textExtractor) runForm(name string, resources types.Dict, depth int) {
+	xobjects, err := x.ctx.DereferenceDict(resources["XObject"])
+	if err != nil || xobjects == nil {
+		return
+	}
+	sd, _, err := x.ctx.DereferenceStreamDict(xobjects[name])
+	if err != nil || sd == nil || sd.Dict.Subtype() == nil || *sd.Dict.Subtype() != "Form" {
+		return
+	}
+	if err := sd.Decode(); err != nil {
+		return
+	}
+	formResources, err := x.ctx.DereferenceDict(sd.Dict["Resources"])
+	if err != nil || formResources == nil {
+		formResources = resources
+	}
+	x.run(sd.Content, formResources, depth+1)
+}
+
+// fontsOf returns the decoders of the fonts of resources, by resource name.
+func (x *textExtractor) fontsOf(resources types.Dict) map[string]*fontDecoder {
+	fonts := make(map[string]*fontDecoder)
+	if resources == nil {
+		return fonts
+	}
+	dict, err := x.ctx.DereferenceDict(resources["Font"])
+	if err != nil || dict == nil {
+		return fonts
+	}
+	for name, o := range dict {
+		fd, err := x.ctx.DereferenceDict(o)
+		if err != nil || fd == nil {
+			continue
+		}
+		fonts[name] = newFontDecoder(x.ctx, fd)
+	}
+	return fonts
+}
+
+// fontDecoder turns the codes of a font into text.
+type fontDecoder struct {
+	codeLen   int               // Bytes per code: 2 for composite fonts, 1 otherwise.
+	toUnicode map[uint32]string // From the ToUnicode CMap, if any.
+	encoding  [256]rune         // For simple fonts without ToUnicode entry for a code.
+}
+
+// newFontDecoder returns the decoder of the font dict fd.
+func newFontDecoder(ctx *model.Context, fd types.Dict) *fontDecoder {
+	f := &fontDecoder{codeLen: 1}
+	if fd.Subtype() != nil && *fd.Subtype() == "Type0" {
+		f.codeLen = 2
+	}
+
+	// Simple fonts: a base encoding, and its differences.
+	base := charmap.Windows1252
+	var differences types.Array
+	switch enc := fd["Encoding"].(type) {
+	case types.Name:
+		if enc == "MacRomanEncoding" {
+			base = charmap.Macintosh
+		}
+	case types.IndirectRef, types.Dict:
+		if d, err := ctx.DereferenceDict(enc); err == nil && d != nil {
+			if n := d.NameEntry("BaseEncoding"); n != nil && *n == "MacRomanEncoding" {
+				base = charmap.Macintosh
+			}
+			differences, _ = ctx.DereferenceArray(d["Differences"])
+		}
+	}
+	for i := range f.encoding {
+		f.encoding[i] = base.DecodeByte(byte(i))
+	}
+	code := 0
+	for _, o := range differences {
+		switch v := o.(type) {
+		case types.Integer:
+			code = v.Value()
+		case types.Name:
+			if code >= 0 && code < 256 {
+				f.encoding[code] = glyphRune(string(v))
+			}
+			code++
+		}
+	}
+
+	if sd, _, err := ctx.DereferenceStreamDict(fd["ToUnicode"]); err == nil && sd != nil && sd.Decode() == nil {
+		f.toUnicode, f.codeLen = parseToUnicode(sd.Content, f.codeLen)
+	}
+	return f
+}
+
+// decode returns the text of a string operand, or "" if it is not a string.
+// A nil decoder, when no font is selected, decodes nothing.
+func (f *fontDecoder) decode(operand any) string {
+	s, ok := operand.(contentString)
+	if !ok || f == nil {
+		return ""
+	}
+	var b strings.Builder
+	for i := 0; i+f.codeLen <= len(s); i += f.codeLen {
+		var code uint32
+		for _, c := range s[i : i+f.codeLen] {
+			code = code<<8 | uint32(c)
+		}
+		if t, ok := f.toUnicode[code]; ok {
+			b.WriteString(t)
+			continue
+		}
+		switch {
+		case f.codeLen == 1:
+			b.WriteRune(f.encoding[code])
+		default:
+			// Composite fonts without a ToUnicode entry use glyph IDs: their text cannot be known.
+			b.WriteRune(unicode.ReplacementChar)
+		}
+	}
+	return b.String()
+}
+
+// maxBFRange is the largest range of codes of a ToUnicode CMap, beyond which it is ignored as corrupt.
+const maxBFRange = 0xFFFF
+
+// parseToUnicode parses the mappings of a ToUnicode CMap, and returns them with the code length
+// declared by its code space, or codeLen if there is none.
+func parseToUnicode(cmap []byte, codeLen int) (map[uint32]string, int) {
+	m := make(map[uint32]string)
+	lex := &contentLexer{b: cmap}
+	var operands []any
+	section := ""
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			return m, codeLen
+		}
+		op, isOp := tok.(contentOperator)
+		if !isOp {
+			if section != "" {
+				operands = append(operands, tok)
+			}
+			continue
+		}
+		switch op {
+		case "begincodespacerange", "beginbfchar", "beginbfrange":
+			section, operands = string(op), nil
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if lo, ok := operands[0].(contentString); ok && len(lo) > 0 {
+					codeLen = len(lo)
+				}
+			}
+			section = ""
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(contentString)
+				dst, ok2 := operands[i+1].(contentString)
+				if ok1 && ok2 {
+					m[codeOf(src)] = utf16Text(dst)
+				}
+			}
+			section = ""
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(contentString)
+				hi, ok2 := operands[i+1].(contentString)
+				if !ok1 || !ok2 {
+					continue
+				}
+				// Ranges are counted from their first code: a range ending at 0xFFFFFFFF must not wrap around.
+				first, last := codeOf(lo), codeOf(hi)
+				if last < first || last-first > maxBFRange {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case contentString:
+					// Consecutive codes map to consecutive characters: increment the last one.
+					runes := []rune(utf16Text(dst))
+					if len(runes) == 0 {
+						continue
+					}
+					for n := uint32(0); n <= last-first; n++ {
+						m[first+n] = string(runes)
+						runes[len(runes)-1]++
+					}
+				case []any:
+					for j, d := range dst {
+						if uint32(j) > last-first {
+							break
+						}
+						if s, ok := d.(contentString); ok {
+							m[first+uint32(j)] = utf16Text(s)
+						}
+					}
+				}
+			}
+			section = ""
+		}
+	}
+}
+
+// codeOf returns the character code of a CMap hex string.
+func codeOf(s contentString) uint32 {
+	var code uint32
+	for _, c := range s {
+		code = code<<8 | uint32(c)
+	}
+	return code
+}
+
+// utf16Text decodes the UTF-16BE text of a CMap destination.
+func utf16Text(s contentString) string {
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// glyphNames are the Adobe glyph names that are not a single character nor a letter with an accent.
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$', "percent": '%',
+	"ampersand": '&', "quotesingle": '\'', "parenleft": '(', "parenright": ')', "asterisk": '*', "plus": '+',
+	"comma": ',', "hyphen": '-', "period": '.', "slash": '/', "colon": ':', "semicolon": ';', "less": '<',
+	"equal": '=', "greater": '>', "question": '?', "at": '@', "bracketleft": '[', "backslash": '\\',
+	"bracketright": ']', "underscore": '_', "braceleft": '{', "bar": '|', "braceright": '}',
+	"zero": '0', "one": '1', "two": '2', "three": '3', "four": '4', "five": '5', "six": '6', "seven": '7',
+	"eight": '8', "nine": '9', "quoteleft": '‘', "quoteright": '’', "quotedblleft": '“', "quotedblright": '”',
+	"endash": '–', "emdash": '—', "bullet": '•', "ellipsis": '…', "Euro": '€', "euro": '€', "sterling": '£',
+	"degree": '°', "section": '§', "guillemotleft": '«', "guillemotright": '»', "germandbls": 'ß',
+	"oe": 'œ', "OE": 'Œ', "ae": 'æ', "AE": 'Æ', "oslash": 'ø', "Oslash": 'Ø', "nbspace": ' ',
+	"fi": 'ﬁ', "fl": 'ﬂ', "ff": 'ﬀ', "ffi": 'ﬃ', "ffl": 'ﬄ', "minus": '−', "multiply": '×',
+}
+
+// accents are the suffixes of glyph names of letters with an accent, like "eacute", as combining marks.
+var accents = map[string]rune{
+	"acute": '\u0301', "grave": '\u0300', "circumflex": '\u0302', "dieresis": '\u0308',
+	"tilde": '\u0303', "cedilla": '\u0327', "ring": '\u030A', "caron": '\u030C',
+}
+
+// glyphRune returns the character of an Adobe glyph name, like "eacute" or "uni00E9".
+func glyphRune(name string) rune {
+	if r, ok := glyphNames[name]; ok {
+		return r
+	}
+	if len(name) == 1 {
+		return rune(name[0])
+	}
+	if hex, ok := strings.CutPrefix(name, "uni"); ok && len(hex) == 4 {
+		if n, err := strconv.ParseUint(hex, 16, 32); err == nil {
+			return rune(n)
+		}
+	}
+	for suffix, mark := range accents {
+		if letter, ok := strings.CutSuffix(name, suffix); ok && len(letter) == 1 {
+			if r := []rune(norm.NFC.String(letter + string(mark))); len(r) == 1 {
+				return r[0]
+			}
+		}
+	}
+	return unicode.ReplacementChar
+}
+
+// Tokens of a content stream, besides numbers (float64) and arrays ([]any).
+type (
+	contentOperator string // Like "Tj".
+	contentName     string // Without the slash.
+	contentString   []byte // Literal or hexadecimal, decoded.
+)
+
+// contentLexer splits a content stream, or a CMap, into tokens.
+type contentLexer struct {
+	b []byte
+	i int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+// next returns the next token, or false at the end of the stream.
+// Dictionaries are skipped, and so is the data of inline images.
+func (l *contentLexer) next() (any, bool) {
+	for l.i < len(l.b) {
+		c := l.b[l.i]
+		switch {
+		case isPDFSpace(c):
+			l.i++
+		case c == '%':
+			for l.i < len(l.b) && l.b[l.i] != '\n' && l.b[l.i] != '\r' {
+				l.i++
+			}
+		case c == '(':
+			return l.literal(), true
+		case c == '<' && l.i+1 < len(l.b) && l.b[l.i+1] == '<':
+			l.skipDict()
+		case c == '<':
+			return l.hex(), true
+		case c == '[':
+			l.i++
+			var arr []any
+			for {
+				for l.i < len(l.b) && isPDFSpace(l.b[l.i]) {
+					l.i++
+				}
+				if l.i >= len(l.b) {
+					return arr, true
+				}
+				if l.b[l.i] == ']' {
+					l.i++
+					return arr, true
+				}
+				tok, ok := l.next()
+				if !ok {
+					return arr, true
+				}
+				arr = append(arr, tok)
+			}
+		case c == '/':
+			l.i++
+			return contentName(l.word()), true
+		case c == ']' || c == '>' || c == '{' || c == '}' || c == ')':
+			l.i++ // Unbalanced, ignored.
+		default:
+			w := l.word()
+			if w == "" {
+				l.i++
+				continue
+			}
+			if n, err := strconv.ParseFloat(w, 64); err == nil {
+				return n, true
+			}
+			if w == "ID" {
+				l.skipInlineImage()
+				continue
+			}
+			return contentOperator(w), true
+		}
+	}
+	return nil, false
+}
+
+// word reads regular characters.
+func (l *contentLexer) word() string {
+	start := l.i
+	for l.i < len(l.b) && !isPDFSpace(l.b[l.i]) && !isPDFDelimiter(l.b[l.i]) {
+		l.i++
+	}
+	return string(l.b[start:l.i])
+}
+
+// literal reads a string like "(Hello \(world\))".
+func (l *contentLexer) literal() contentString {
+	l.i++ // (
+	var s []byte
+	depth := 1
+	for l.i < len(l.b) {
+		c := l.b[l.i]
+		l.i++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return s
+			}
+		case '\\':
+			if l.i >= len(l.b) {
+				return s
+			}
+			e := l.b[l.i]
+			l.i++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.i < len(l.b) && l.b[l.i] == '\n' {
+					l.i++
+				}
+				continue // Line continuation.
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					n := int(e - '0')
+					for k := 0; k < 2 && l.i < len(l.b) && l.b[l.i] >= '0' && l.b[l.i] <= '7'; k++ {
+						n = n*8 + int(l.b[l.i]-'0')
+						l.i++
+					}
+					c = byte(n)
+				} else {
+					c = e // \( \) \\ and unknown escapes.
+				}
+			}
+		}
+		s = append(s, c)
+	}
+	return s
+}
+
+// hex reads a string like "<48656C6C6F>".
+func (l *contentLexer) hex() contentString {
+	l.i++ // <
+	var digits []byte
+	for l.i < len(l.b) && l.b[l.i] != '>' {
+		c := l.b[l.i]
+		if (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F') {
+			digits = append(digits, c)
+		}
+		l.i++
+	}
+	l.i++ // >
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	s := make(contentString, len(digits)/2)
+	for k := range s {
+		n, _ := strconv.ParseUint(string(digits[2*k:2*k+2]), 16, 8)
+		s[k] = byte(n)
+	}
+	return s
+}
+
+// skipDict skips a dictionary, like the properties of marked content.
+func (l *contentLexer) skipDict() {
+	l.i += 2 // <<
+	for l.i < len(l.b) {
+		switch {
+		case l.b[l.i] == '>' && l.i+1 < len(l.b) && l.b[l.i+1] == '>':
+			l.i += 2
+			return
+		case l.b[l.i] == '<' && l.i+1 < len(l.b) && l.b[l.i+1] == '<':
+			l.skipDict()
+		case l.b[l.i] == '(':
+			l.literal()
+		default:
+			l.i++
+		}
+	}
+}
+
+// skipInlineImage skips the binary data of an inline image, up to its "EI" operator.
+func (l *contentLexer) skipInlineImage() {
+	for l.i+2 <= len(l.b) {
+		if isPDFSpace(l.b[l.i]) && l.i+2 < len(l.b) && l.b[l.i+1] == 'E' && l.b[l.i+2] == 'I' &&
+			(l.i+3 == len(l.b) || isPDFSpace(l.b[l.i+3])) {
+			l.i += 3
+			return
+		}
+		l.i++
+	}
+	l.i = len(l.b)
+}
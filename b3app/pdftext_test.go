@@ -0,0 +1,231 @@
+package b3app
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+)
+
+// lexAll returns all the tokens of a content stream.
+func lexAll(s string) []any {
+	l := &contentLexer{b: []byte(s)}
+	var tokens []any
+	for {
+		tok, ok := l.next()
+		if !ok {
+			return tokens
+		}
+		tokens = append(tokens, tok)
+	}
+}
+
+func TestContentLexer(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []any
+	}{
+		{"literal", "(Hello) Tj", []any{contentString("Hello"), contentOperator("Tj")}},
+		{"nested parentheses", "(a (b) c) Tj", []any{contentString("a (b) c"), contentOperator("Tj")}},
+		{"escapes", `(\(x\)\n\\\101\7) Tj`, []any{contentString("(x)\n\\A\a"), contentOperator("Tj")}},
+		{"line continuation", "(ab\\\ncd)", []any{contentString("abcd")}},
+		{"hex", "<48656C6C6F> Tj", []any{contentString("Hello"), contentOperator("Tj")}},
+		{"hex with spaces and odd digits", "<48 65 6>", []any{contentString("He`")}},
+		{"array", "[(A) -120 (B)] TJ", []any{[]any{contentString("A"), -120.0, contentString("B")}, contentOperator("TJ")}},
+		{"names and numbers", "/F1 12 Tf", []any{contentName("F1"), 12.0, contentOperator("Tf")}},
+		{"comment", "% a comment\n(x)", []any{contentString("x")}},
+		{"dictionary skipped", "/P <</MCID 0 /Alt (a >> b)>> BDC", []any{contentName("P"), contentOperator("BDC")}},
+		{"inline image skipped", "BI /W 2 /H 1 ID \x00EI\xff EI (after) Tj", []any{contentOperator("BI"), contentName("W"), 2.0, contentName("H"), 1.0, contentString("after"), contentOperator("Tj")}},
+		{"unterminated literal", "(abc", []any{contentString("abc")}},
+		{"unterminated array", "[(a) 1", []any{[]any{contentString("a"), 1.0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lexAll(tt.in); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lexAll(%q) = %#v, want %#v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseToUnicode(t *testing.T) {
+	tests := []struct {
+		name    string
+		cmap    string
+		want    map[uint32]string
+		wantLen int
+	}{
+		{
+			name:    "bfchar",
+			cmap:    "1 begincodespacerange <0000> <FFFF> endcodespacerange 2 beginbfchar <0003> <0020> <0024> <00410301> endbfchar",
+			want:    map[uint32]string{3: " ", 0x24: "Á"},
+			wantLen: 2,
+		},
+		{
+			name:    "bfrange incremented",
+			cmap:    "1 beginbfrange <20> <22> <0061> endbfrange",
+			want:    map[uint32]string{0x20: "a", 0x21: "b", 0x22: "c"},
+			wantLen: 1,
+		},
+		{
+			name:    "bfrange array",
+			cmap:    "1 beginbfrange <01> <02> [<0066> <FB01> <0078>] endbfrange",
+			want:    map[uint32]string{1: "f", 2: "ﬁ"},
+			wantLen: 1,
+		},
+		{
+			name:    "surrogate pair",
+			cmap:    "1 beginbfchar <01> <D835DC00> endbfchar",
+			want:    map[uint32]string{1: "𝐀"},
+			wantLen: 1,
+		},
+		{
+			name:    "range at the end of the code space",
+			cmap:    "1 beginbfrange <FFFFFFFE> <FFFFFFFF> <0041> endbfrange",
+			want:    map[uint32]string{0xFFFFFFFE: "A", 0xFFFFFFFF: "B"},
+			wantLen: 1,
+		},
+		{
+			name:    "reversed range ignored",
+			cmap:    "1 beginbfrange <0010> <0001> <0041> endbfrange",
+			want:    map[uint32]string{},
+			wantLen: 1,
+		},
+		{
+			name:    "huge range ignored",
+			cmap:    "1 beginbfrange <00000000> <FFFFFFFF> <0041> endbfrange",
+			want:    map[uint32]string{},
+			wantLen: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done := make(chan struct{})
+			var got map[uint32]string
+			var gotLen int
+			go func() {
+				got, gotLen = parseToUnicode([]byte(tt.cmap), 1)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("parseToUnicode(%q) does not return", tt.cmap)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseToUnicode(%q) = %q, want %q", tt.cmap, got, tt.want)
+			}
+			if gotLen != tt.wantLen {
+				t.Errorf("parseToUnicode(%q) code length = %d, want %d", tt.cmap, gotLen, tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestGlyphRune(t *testing.T) {
+	tests := []struct {
+		name string
+		want rune
+	}{
+		{"A", 'A'},
+		{"space", ' '},
+		{"quoteright", '’'},
+		{"Euro", '€'},
+		{"eacute", 'é'},
+		{"Ccedilla", 'Ç'},
+		{"udieresis", 'ü'},
+		{"ntilde", 'ñ'},
+		{"uni00E9", 'é'},
+		{"uni20AC", '€'},
+		{"uniZZZZ", unicode.ReplacementChar},
+		{"g123", unicode.ReplacementChar},
+		{"", unicode.ReplacementChar},
+	}
+	for _, tt := range tests {
+		if got := glyphRune(tt.name); got != tt.want {
+			t.Errorf("glyphRune(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSufficient(t *testing.T) {
+	text := strings.Repeat("word ", minPageText/4+1)
+	tests := []struct {
+		name  string
+		pages []string
+		want  bool
+	}{
+		{"no page", nil, false},
+		{"text", []string{text}, true},
+		{"every page", []string{text, text}, true},
+		{"a scanned page", []string{text, "3"}, false},
+		{"too short", []string{"Page 1 of 2"}, false},
+		{"undecoded", []string{text + strings.Repeat("�", 5)}, false},
+		{"a few undecoded", []string{strings.Repeat(text, 10) + "�"}, true},
+	}
+	for _, tt := range tests {
+		d := &DocumentText{}
+		for i, p := range tt.pages {
+			d.Pages = append(d.Pages, PageText{Page: i + 1, Text: p})
+		}
+		if got := d.Sufficient(); got != tt.want {
+			t.Errorf("%s: Sufficient() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// minimalPDF returns a one-page PDF showing the content stream with the standard Helvetica font.
+func minimalPDF(content string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content)+1, content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+	}
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, o := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+func TestExtractPDFText(t *testing.T) {
+	pdf := minimalPDF("BT /F1 12 Tf 72 720 Td (Caf\\351 cr\\350me) Tj 0 -14 Td [(Total) -250 (: 42 \\200)] TJ ET")
+	got, err := ExtractPDFText(pdf)
+	if err != nil {
+		t.Fatalf("ExtractPDFText() error = %v", err)
+	}
+	if len(got.Pages) != 1 {
+		t.Fatalf("ExtractPDFText() has %d pages, want 1", len(got.Pages))
+	}
+	for _, want := range []string{"Café crème", "Total", "42 €"} {
+		if !strings.Contains(got.Pages[0].Text, want) {
+			t.Errorf("ExtractPDFText() text = %q, want it to contain %q", got.Pages[0].Text, want)
+		}
+	}
+}
+
+func FuzzExtractPDFText(f *testing.F) {
+	f.Add(minimalPDF("BT /F1 12 Tf (Hello) Tj ET"))
+	f.Add(minimalPDF("BT /F1 12 Tf [(A) -120 <42> (\\(C\\))] TJ T* (D) ' ET"))
+	f.Add(minimalPDF("q BI /W 1 /H 1 /BPC 8 /CS /G ID \x00 EI Q"))
+	f.Add([]byte("%PDF-1.4\n"))
+	f.Fuzz(func(t *testing.T, content []byte) {
+		// Any input may fail, but must neither panic nor hang.
+		ExtractPDFText(content)
+	})
+}
@@ -0,0 +1,250 @@
+package b3app
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pinnedFile is the content of an encrypted local copy of a file.
+type pinnedFile struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	MimeType string    `json:"mime_type"`
+	Modified time.Time `json:"modified"` // Version of the file when it was copied.
+	Content  []byte    `json:"content"`
+}
+
+// pinDir returns the directory holding the encrypted local copies.
+func pinDir() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "files"), nil
+}
+
+// pinPath returns the path to the encrypted local copy of a file.
+func pinPath(fileID string) (string, error) {
+	dir, err := pinDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fileID+".enc"), nil
+}
+
+// cacheKey returns the key encrypting the local copies, creating it on first use.
+//
+// The key is stored next to the token, readable by the user only: local copies
+// are as safe as the Drive access token itself. A backup of the configuration
+// directory holds both the key and the copies.
+func cacheKey() ([]byte, error) {
+	dir, err := configDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "cache.key")
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("invalid cache key %s: delete it along with %s", path, filepath.Join(dir, "files"))
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read cache key: %w", err)
+	}
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate cache key: %w", err)
+	}
+	if err := writePrivateFile(path, key); err != nil {
+		return nil, fmt.Errorf("failed to save cache key: %w", err)
+	}
+	return key, nil
+}
+
+// newCacheCipher returns the AES-GCM cipher for the local copies.
+func newCacheCipher() (cipher.AEAD, error) {
+	key, err := cacheKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// writePinned encrypts and stores a local copy.
+func writePinned(p *pinnedFile) error {
+	aead, err := newCacheCipher()
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to encode local copy: %w", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	// The file ID is authenticated, so that copies cannot be swapped.
+	sealed := aead.Seal(nonce, nonce, plain, []byte(p.ID))
+
+	path, err := pinPath(p.ID)
+	if err != nil {
+		return err
+	}
+	if err := writePrivateFile(path, sealed); err != nil {
+		return fmt.Errorf("failed to write local copy of %s: %w", p.ID, err)
+	}
+	return nil
+}
+
+// readPinned decrypts a local copy. It returns nil if there is none.
+func readPinned(fileID string) (*pinnedFile, error) {
+	path, err := pinPath(fileID)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read local copy of %s: %w", fileID, err)
+	}
+	aead, err := newCacheCipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("local copy of %s is corrupted", fileID)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(fileID))
+	if err != nil {
+		return nil, fmt.Errorf("local copy of %s cannot be decrypted: %w", fileID, err)
+	}
+	p := &pinnedFile{}
+	if err := json.Unmarshal(plain, p); err != nil {
+		return nil, fmt.Errorf("local copy of %s is corrupted: %w", fileID, err)
+	}
+	return p, nil
+}
+
+// Pinned returns the IDs of the files that have a local copy, sorted.
+func Pinned() ([]string, error) {
+	dir, err := pinDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local copies: %w", err)
+	}
+	var ids []string
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), ".enc"); ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// Pin downloads a file from the vault and keeps an encrypted local copy of it,
+// so that it can be read offline. The copy is refreshed on each synchronization.
+func (a *App) Pin(ctx context.Context, fileID string) (*File, error) {
+	if err := a.checkOnline(); err != nil {
+		return nil, err
+	}
+	if _, err := a.Sync(ctx); err != nil {
+		return nil, err
+	}
+	a.indexMu.Lock()
+	f, ok := a.index.Files[fileID]
+	a.indexMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("file %s is not in the B3 or B4 folders", fileID)
+	}
+	if err := a.writePinnedCopy(ctx, f.File); err != nil {
+		return nil, err
+	}
+	return &f.File, nil
+}
+
+// Unpin deletes the local copy of a file.
+func Unpin(fileID string) error {
+	path, err := pinPath(fileID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete local copy of %s: %w", fileID, err)
+	}
+	return nil
+}
+
+// writePinnedCopy downloads the current version of f and stores it locally.
+func (a *App) writePinnedCopy(ctx context.Context, f File) error {
+	content, mimeType, err := a.GetFileContent(ctx, f.ID)
+	if err != nil {
+		return err
+	}
+	return writePinned(&pinnedFile{ID: f.ID, Name: f.Name, MimeType: mimeType, Modified: f.Modified, Content: content})
+}
+
+// refreshPins updates the local copies of the files that changed, and drops the removed ones.
+// Failures are only logged: a stale local copy is still better than none.
+func (a *App) refreshPins(ctx context.Context, changes *IndexChanges) {
+	ids, err := Pinned()
+	if err != nil || len(ids) == 0 {
+		return
+	}
+	pinned := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		pinned[id] = true
+	}
+	for _, f := range changes.Removed {
+		if pinned[f.ID] {
+			if err := Unpin(f.ID); err != nil {
+				log.Printf("warning: %v", err)
+			}
+		}
+	}
+	for _, f := range append(changes.Added, changes.Modified...) {
+		if pinned[f.ID] {
+			if err := a.writePinnedCopy(ctx, f); err != nil {
+				log.Printf("warning: could not refresh local copy of %s: %v", f.ID, err)
+			}
+		}
+	}
+}
+
+// readPinnedContent returns the content of the local copy of a file, for offline reading.
+func readPinnedContent(fileID string) ([]byte, string, error) {
+	p, err := readPinned(fileID)
+	if err != nil {
+		return nil, "", err
+	}
+	if p == nil {
+		return nil, "", fmt.Errorf("%w, and file %s has no local copy (pin it with 'b3 pin %s' while online)", ErrOffline, fileID, fileID)
+	}
+	return p.Content, p.MimeType, nil
+}
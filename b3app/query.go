@@ -0,0 +1,243 @@
+package b3app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// FileQuery is a structured search of the vault files, run by Drive.
+//
+// All the filters that are set must match.
+type FileQuery struct {
+	NameContains   string `json:"name_contains,omitempty"`   // Words in the file name.
+	FullText       string `json:"full_text,omitempty"`       // Words in the name, description or content.
+	MimeType       string `json:"mime_type,omitempty"`       // Exact MIME type, or a prefix ending with "/", like "image/".
+	ModifiedAfter  string `json:"modified_after,omitempty"`  // YYYY-MM-DD or RFC 3339 time.
+	ModifiedBefore string `json:"modified_before,omitempty"` // YYYY-MM-DD or RFC 3339 time.
+	// Folder is the vault folder to search, with its subfolders, like "B3/Car". The whole vault by default.
+	Folder string `json:"folder,omitempty"`
+	// Metadata filters on the metadata stored with the files, by field name, like
+	// {"document_type": "passport", "identifier.passport_number": "12AB34567"}.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// clauses returns the Drive query clauses of the filters, escaped.
+func (q *FileQuery) clauses() ([]string, error) {
+	var clauses []string
+	if q.NameContains != "" {
+		clauses = append(clauses, fmt.Sprintf("name contains '%s'", escapeQuery(q.NameContains)))
+	}
+	if q.FullText != "" {
+		clauses = append(clauses, fmt.Sprintf("fullText contains '%s'", escapeQuery(q.FullText)))
+	}
+	switch {
+	case strings.HasSuffix(q.MimeType, "/"):
+		clauses = append(clauses, fmt.Sprintf("mimeType contains '%s'", escapeQuery(q.MimeType)))
+	case q.MimeType != "":
+		clauses = append(clauses, fmt.Sprintf("mimeType = '%s'", escapeQuery(q.MimeType)))
+	}
+	for _, d := range []struct{ name, value, op string }{
+		{"modified_after", q.ModifiedAfter, ">"},
+		{"modified_before", q.ModifiedBefore, "<"},
+	} {
+		if d.value == "" {
+			continue
+		}
+		t, err := parseQueryTime(d.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", d.name, err)
+		}
+		clauses = append(clauses, fmt.Sprintf("modifiedTime %s '%s'", d.op, t.UTC().Format(time.RFC3339)))
+	}
+
+	// Sort the fields for a deterministic query.
+	fields := make([]string, 0, len(q.Metadata))
+	for f := range q.Metadata {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	for _, f := range fields {
+		key, err := metadataProperty(f)
+		if err != nil {
+			return nil, fmt.Errorf("metadata: %w", err)
+		}
+		if !strings.HasPrefix(key, propID) && !strings.HasPrefix(key, propAmount) {
+			clauses = append(clauses, fmt.Sprintf("appProperties has { key='%s' and value='%s' }", escapeQuery(key), escapeQuery(q.Metadata[f])))
+			continue
+		}
+		// Any of the identifiers of that kind, or amounts with that label, may match.
+		var alternatives []string
+		for n := 1; n <= maxRepeated; n++ {
+			alternatives = append(alternatives, fmt.Sprintf("appProperties has { key='%s' and value='%s' }", escapeQuery(numberedKey(key, n)), escapeQuery(q.Metadata[f])))
+		}
+		clauses = append(clauses, "("+strings.Join(alternatives, " or ")+")")
+	}
+	return clauses, nil
+}
+
+// parseQueryTime parses a YYYY-MM-DD date or an RFC 3339 time.
+func parseQueryTime(s string) (time.Time, error) {
+	if t, err := time.Parse(dateLayout, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a YYYY-MM-DD date nor an RFC 3339 time", s)
+	}
+	return t, nil
+}
+
+// metadataProperty returns the appProperties key of a Metadata field, like "b3.expires" for "expiry_date".
+func metadataProperty(field string) (string, error) {
+	switch field {
+	case "document_type":
+		return propType, nil
+	case "holder":
+		return propHolder, nil
+	case "issuer":
+		return propIssuer, nil
+	case "issue_date":
+		return propIssueDate, nil
+	case "expiry_date":
+		return propExpiryDate, nil
+	case "birth_date":
+		return propBirthDate, nil
+	case "address":
+		return propAddress, nil
+	case "language":
+		return propLanguage, nil
+	}
+	if kind, ok := strings.CutPrefix(field, "identifier."); ok && kind != "" {
+		return propID + propertyKey(kind), nil
+	}
+	if label, ok := strings.CutPrefix(field, "amount."); ok && label != "" {
+		return propAmount + propertyKey(label), nil
+	}
+	return "", fmt.Errorf("unknown field %q, expected document_type, holder, birth_date, issuer, issue_date, expiry_date, address, language, identifier.<kind> or amount.<label>", field)
+}
+
+// foldersUnder returns the IDs of the vault folder at path, like "B3/Car", and of all its subfolders, sorted.
+func (idx *Index) foldersUnder(path string) ([]string, error) {
+	path = strings.Trim(path, "/")
+	ids := []string{idx.B3FolderID, idx.B4FolderID}
+	for id := range idx.Folders {
+		ids = append(ids, id)
+	}
+	var under []string
+	for _, id := range ids {
+		p := idx.pathOf(id)
+		if p != "" && (path == "" || p == path || strings.HasPrefix(p, path+"/")) {
+			under = append(under, id)
+		}
+	}
+	if len(under) == 0 {
+		return nil, fmt.Errorf("no folder %q in the vault, expected a path like B3 or B3/Car", path)
+	}
+	sort.Strings(under)
+	return under, nil
+}
+
+// QueryFiles runs the query on Drive, restricted to the vault, and returns a page of at most pageSize files,
+// and the token of the next page, or "" if it is the last one.
+//
+// Drive cannot search a folder tree, so the query lists the files whose parent is one of the vault folders,
+// by batches of folders. A page never spans two batches, it may then have fewer files than pageSize, and
+// files are sorted by modification time within a batch only. Batches without any match are skipped.
+// The index is synchronized on the first page only.
+func (a *App) QueryFiles(ctx context.Context, q *FileQuery, pageSize int, pageToken string) ([]File, string, error) {
+	if err := a.checkOnline(); err != nil {
+		return nil, "", err
+	}
+	clauses, err := q.clauses()
+	if err != nil {
+		return nil, "", err
+	}
+	// The index knows the vault folders.
+	if pageToken == "" {
+		if _, err := a.Sync(ctx); err != nil {
+			return nil, "", err
+		}
+	}
+	a.indexMu.Lock()
+	folders, err := a.index.foldersUnder(q.Folder)
+	a.indexMu.Unlock()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The page token is the batch number followed by the Drive page token.
+	batch, driveToken := 0, ""
+	if pageToken != "" {
+		n, token, _ := strings.Cut(pageToken, ":")
+		if batch, err = strconv.Atoi(n); err != nil || batch < 0 {
+			return nil, "", fmt.Errorf("invalid page token %q", pageToken)
+		}
+		driveToken = token
+	}
+	size := a.Config.Drive.BatchSize
+	if batch*size >= len(folders) {
+		return nil, "", fmt.Errorf("invalid page token %q", pageToken)
+	}
+
+	for {
+		batchFolders := folders[batch*size : min((batch+1)*size, len(folders))]
+		var parents []string
+		for _, id := range batchFolders {
+			parents = append(parents, fmt.Sprintf("'%s' in parents", escapeQuery(id)))
+		}
+		query := strings.Join(append([]string{
+			"(" + strings.Join(parents, " or ") + ")",
+			"trashed = false",
+			fmt.Sprintf("mimeType != '%s'", folderMimeType),
+		}, clauses...), " and ")
+
+		call := a.filesList(ctx).
+			Q(query).
+			PageSize(int64(pageSize)).
+			PageToken(driveToken).
+			OrderBy("modifiedTime desc").
+			Fields(googleapi.Field("nextPageToken, files(" + listFields + ")"))
+		var page *drive.FileList
+		err = retryRateLimited(ctx, func() (err error) {
+			page, err = call.Do()
+			return err
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to query files: %w", a.scopeError(err))
+		}
+
+		files := []File{}
+		for _, f := range page.Files {
+			file, err := newFile(f)
+			if err != nil {
+				return nil, "", err
+			}
+			if len(f.Parents) > 0 {
+				a.indexMu.Lock()
+				file.Path = a.index.pathOf(f.Parents[0])
+				a.indexMu.Unlock()
+			}
+			files = append(files, file)
+		}
+
+		// Move on to the next Drive page, or the next batch.
+		switch {
+		case page.NextPageToken != "":
+			driveToken = page.NextPageToken
+		case (batch+1)*size < len(folders):
+			batch, driveToken = batch+1, ""
+		default:
+			return files, "", nil
+		}
+		if len(files) > 0 {
+			return files, fmt.Sprintf("%d:%s", batch, driveToken), nil
+		}
+	}
+}
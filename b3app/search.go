@@ -0,0 +1,449 @@
+package b3app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// token is a normalized word, with its position in the original text.
+type token struct {
+	term       string
+	start, end int // Byte offsets in the original text.
+}
+
+// foldings are the letters that do not decompose into a base letter and accents.
+var foldings = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'ł': "l", 'đ': "d", 'ð': "d", 'þ': "th", 'ı': "i",
+}
+
+// fold returns the lower case, accent free, form of r.
+func fold(r rune) string {
+	r = unicode.ToLower(r)
+	if s, ok := foldings[r]; ok {
+		return s
+	}
+	var b strings.Builder
+	for _, c := range norm.NFD.String(string(r)) {
+		if !unicode.Is(unicode.Mn, c) {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// isIdeograph reports whether r belongs to a script written without spaces,
+// whose characters are indexed one by one.
+func isIdeograph(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai)
+}
+
+// tokenize splits text into accent-insensitive, lower case terms.
+//
+// Words are sequences of letters and digits, in any script. Ideographs are terms on their own.
+func tokenize(text string) []token {
+	var tokens []token
+	var cur strings.Builder
+	start := 0
+	flush := func(end int) {
+		if cur.Len() > 0 {
+			tokens = append(tokens, token{term: cur.String(), start: start, end: end})
+			cur.Reset()
+		}
+	}
+	for i, r := range text {
+		switch {
+		case isIdeograph(r):
+			flush(i)
+			start = i
+			cur.WriteString(fold(r))
+			flush(i + utf8.RuneLen(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r):
+			if cur.Len() == 0 {
+				start = i
+			}
+			cur.WriteString(fold(r))
+		default:
+			flush(i)
+		}
+	}
+	flush(len(text))
+	return tokens
+}
+
+// Searchable fields of a file, and their weight in the ranking.
+var searchFields = []struct {
+	name   string
+	weight float64
+}{
+	{"name", 3},
+	{"path", 1},
+	{"description", 1},
+	{"text", 1},
+}
+
+// searchDoc is a file in the inverted index.
+type searchDoc struct {
+	file   File
+	fields [4]string  // Texts of the searchFields.
+	length float64    // Weighted number of terms.
+	terms  []termFreq // Weighted frequency of each term, sorted by term.
+}
+
+// termFreq is the weighted frequency of a term in a searchDoc.
+type termFreq struct {
+	term string
+	freq float64
+}
+
+// SearchIndex is an inverted index of the vault files, ranked with BM25.
+type SearchIndex struct {
+	docs     []*searchDoc
+	postings map[string][]int // Documents containing each term, by position in docs.
+	terms    []string         // All terms, sorted, for prefix matching.
+	avgLen   float64
+}
+
+// BM25 parameters.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// prefixWeight discounts terms only matching a query term as a prefix, like "passports" for "passport".
+	prefixWeight = 0.5
+)
+
+// NewSearchIndex indexes the files, with the extracted text of documents, by file ID, if any.
+func NewSearchIndex(files []File, texts map[string]string) *SearchIndex {
+	s := &SearchIndex{postings: make(map[string][]int)}
+	total := 0.0
+	for _, f := range files {
+		d := &searchDoc{file: f, fields: [4]string{f.Name, f.Path, f.Description, texts[f.ID]}}
+		freqs := make(map[string]float64)
+		for i, text := range d.fields {
+			for _, t := range tokenize(text) {
+				freqs[t.term] += searchFields[i].weight
+				d.length += searchFields[i].weight
+			}
+		}
+		for term, freq := range freqs {
+			d.terms = append(d.terms, termFreq{term, freq})
+			if len(s.postings[term]) == 0 {
+				s.terms = append(s.terms, term)
+			}
+			s.postings[term] = append(s.postings[term], len(s.docs))
+		}
+		sort.Slice(d.terms, func(i, j int) bool { return d.terms[i].term < d.terms[j].term })
+		total += d.length
+		s.docs = append(s.docs, d)
+	}
+	sort.Strings(s.terms)
+	if len(s.docs) > 0 {
+		s.avgLen = total / float64(len(s.docs))
+	}
+	return s
+}
+
+// freq returns the weighted frequency of term in d.
+func (d *searchDoc) freq(term string) float64 {
+	i := sort.Search(len(d.terms), func(i int) bool { return d.terms[i].term >= term })
+	if i < len(d.terms) && d.terms[i].term == term {
+		return d.terms[i].freq
+	}
+	return 0
+}
+
+// SearchResult is a file matching a search query.
+type SearchResult struct {
+	File    File    `json:"file"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"` // The passage best matching the query.
+}
+
+// Search returns the best matches for query, at most limit.
+//
+// Every query term must match, either exactly or as the prefix of a word.
+func (s *SearchIndex) Search(query string, limit int) []SearchResult {
+	var queryTerms []string
+	for _, t := range tokenize(query) {
+		queryTerms = append(queryTerms, t.term)
+	}
+	if len(queryTerms) == 0 {
+		return nil
+	}
+
+	n := float64(len(s.docs))
+	scores := make(map[int]float64)
+	matched := make(map[int]int) // Number of query terms matched by each document.
+	for _, q := range queryTerms {
+		hits := make(map[int]float64)
+		// Terms starting with q are contiguous in the sorted terms.
+		for i := sort.SearchStrings(s.terms, q); i < len(s.terms) && strings.HasPrefix(s.terms[i], q); i++ {
+			term := s.terms[i]
+			weight := 1.0
+			if term != q {
+				weight = prefixWeight
+			}
+			docs := s.postings[term]
+			idf := math.Log(1 + (n-float64(len(docs))+0.5)/(float64(len(docs))+0.5))
+			for _, di := range docs {
+				d := s.docs[di]
+				tf := d.freq(term)
+				score := weight * idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*d.length/s.avgLen))
+				hits[di] = math.Max(hits[di], score)
+			}
+		}
+		for di, score := range hits {
+			scores[di] += score
+			matched[di]++
+		}
+	}
+
+	var results []SearchResult
+	for di, score := range scores {
+		if matched[di] < len(queryTerms) {
+			continue
+		}
+		d := s.docs[di]
+		results = append(results, SearchResult{File: d.file, Score: math.Round(score*1000) / 1000, Snippet: d.snippet(queryTerms)})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].File.ID < results[j].File.ID
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// snippetRunes is the approximate length of a snippet.
+const snippetRunes = 160
+
+// snippet returns the passage of the description or the text containing the most query terms.
+// It falls back to the name.
+func (d *searchDoc) snippet(queryTerms []string) string {
+	bestText, bestStart, bestEnd, bestCount := "", 0, 0, 0
+	for _, text := range d.fields[2:] {
+		tokens := tokenize(text)
+		for i, t := range tokens {
+			if !matchesAny(t.term, queryTerms) {
+				continue
+			}
+			// Count the matching terms in a window starting at this one.
+			count, end := 0, t.end
+			for _, u := range tokens[i:] {
+				if utf8.RuneCountInString(text[t.start:u.end]) > snippetRunes {
+					break
+				}
+				end = u.end
+				if matchesAny(u.term, queryTerms) {
+					count++
+				}
+			}
+			if count > bestCount {
+				bestText, bestStart, bestEnd, bestCount = text, t.start, end, count
+			}
+		}
+	}
+	if bestCount == 0 {
+		return d.file.Name
+	}
+
+	// Give some context before the first match, without cutting words.
+	start := bestStart
+	for back := 0; start > 0 && back < snippetRunes/4; back++ {
+		_, size := utf8.DecodeLastRuneInString(bestText[:start])
+		start -= size
+	}
+	for start > 0 && start < bestStart {
+		r, size := utf8.DecodeRuneInString(bestText[start:])
+		if unicode.IsSpace(r) {
+			break
+		}
+		start += size
+	}
+	snippet := strings.Join(strings.Fields(bestText[start:bestEnd]), " ")
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if bestEnd < len(bestText) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// matchesAny reports whether term matches one of the query terms, exactly or as a prefix.
+func matchesAny(term string, queryTerms []string) bool {
+	for _, q := range queryTerms {
+		if strings.HasPrefix(term, q) {
+			return true
+		}
+	}
+	return false
+}
+
+// Search searches the files of B3 and B4 in the local index, and returns the best matches, at most limit.
+//
+// The name, path, description (including metadata) and extracted text of files are searched.
+// The inverted index is kept between searches, and rebuilt when the files or their texts change.
+func (a *App) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	if _, err := a.Sync(ctx); err != nil {
+		return nil, err
+	}
+	files := append(a.indexedFiles("B3"), a.indexedFiles("B4")...)
+	key, err := searchKey(files)
+	if err != nil {
+		return nil, err
+	}
+
+	a.searchMu.Lock()
+	defer a.searchMu.Unlock()
+	if a.searchIndex == nil || a.searchKey != key {
+		texts, err := loadTexts()
+		if err != nil {
+			return nil, err
+		}
+		extracted := make(map[string]string)
+		for _, f := range files {
+			// Ignore the text extracted from a previous version of the file.
+			if t, ok := texts[f.ID]; ok && t.current(f) {
+				extracted[f.ID] = t.Text
+			}
+		}
+		a.searchIndex, a.searchKey = NewSearchIndex(files, extracted), key
+	}
+	return a.searchIndex.Search(query, limit), nil
+}
+
+// searchKey identifies the searchable content of files: it changes when a file, or the file of extracted texts, does.
+func searchKey(files []File) (string, error) {
+	h := fnv.New64a()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%s\x00%d\x00", f.ID, f.Path, f.Name, f.Description, f.MD5Checksum, f.Modified.UnixNano())
+	}
+	path, err := textsPath()
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(path); err == nil {
+		fmt.Fprintf(h, "%d\x00%d", info.Size(), info.ModTime().UnixNano())
+	}
+	return strconv.FormatUint(h.Sum64(), 16), nil
+}
+
+// extractedText is the text extracted from a version of a file.
+type extractedText struct {
+	MD5      string    `json:"md5"`               // Checksum of the file content the text was extracted from.
+	Modified time.Time `json:"modified,omitzero"` // Modification time of the file, for Google Workspace files that have no checksum.
+	Text     string    `json:"text"`
+}
+
+// current reports whether t was extracted from the current version of f.
+//
+// Google Workspace files have no checksum in Drive, their text is the one of their last modification.
+func (t extractedText) current(f File) bool {
+	if f.MD5Checksum != "" {
+		return t.MD5 == f.MD5Checksum
+	}
+	return !t.Modified.IsZero() && t.Modified.Equal(f.Modified)
+}
+
+// textsMu protects the file of extracted texts.
+var textsMu sync.Mutex
+
+// textsPath returns the path to the file of extracted texts.
+func textsPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "texts.json"), nil
+}
+
+// loadTexts reads the extracted texts, by file ID.
+func loadTexts() (map[string]extractedText, error) {
+	textsMu.Lock()
+	defer textsMu.Unlock()
+	return readTexts()
+}
+
+func readTexts() (map[string]extractedText, error) {
+	path, err := textsPath()
+	if err != nil {
+		return nil, err
+	}
+	texts := make(map[string]extractedText)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return texts, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read extracted texts: %w", err)
+	}
+	if err := json.Unmarshal(data, &texts); err != nil {
+		return nil, fmt.Errorf("failed to decode extracted texts %s: %w", path, err)
+	}
+	return texts, nil
+}
+
+// storeText records the text extracted from a file, so that it can be searched.
+func storeText(fileID string, t extractedText) error {
+	textsMu.Lock()
+	defer textsMu.Unlock()
+	texts, err := readTexts()
+	if err != nil {
+		return err
+	}
+	texts[fileID] = t
+	return writeTexts(texts)
+}
+
+// touchText records that the text extracted from the content of checksum md5 is the one of the
+// Google Workspace file modified at that time.
+func touchText(fileID, md5 string, modified time.Time) error {
+	textsMu.Lock()
+	defer textsMu.Unlock()
+	texts, err := readTexts()
+	if err != nil {
+		return err
+	}
+	t, ok := texts[fileID]
+	if !ok || t.MD5 != md5 || t.Modified.Equal(modified) {
+		return nil
+	}
+	t.Modified = modified
+	texts[fileID] = t
+	return writeTexts(texts)
+}
+
+// writeTexts writes the extracted texts of all the files.
+func writeTexts(texts map[string]extractedText) error {
+	data, err := json.Marshal(texts)
+	if err != nil {
+		return fmt.Errorf("failed to encode extracted texts: %w", err)
+	}
+	path, err := textsPath()
+	if err != nil {
+		return err
+	}
+	if err := writePrivateFile(path, data); err != nil {
+		return fmt.Errorf("failed to write extracted texts: %w", err)
+	}
+	return nil
+}
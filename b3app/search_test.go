@@ -0,0 +1,224 @@
+package b3app
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"Passport", []string{"passport"}},
+		{"Carte d'identité, 2024-05", []string{"carte", "d", "identite", "2024", "05"}},
+		{"Élève À Noël", []string{"eleve", "a", "noel"}},
+		{"Straße Œuvre Ærø Łódź", []string{"strasse", "oeuvre", "aero", "lodz"}},
+		{"école", []string{"ecole"}}, // Decomposed accent.
+		{"Москва Αθήνα", []string{"москва", "αθηνα"}},
+		{"東京都 tax", []string{"東", "京", "都", "tax"}},
+		{"  --  ", nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, tok := range tokenize(test.text) {
+			got = append(got, tok.term)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestTokenizeOffsets(t *testing.T) {
+	text := "Reçu: Élève 東京"
+	for _, tok := range tokenize(text) {
+		original := text[tok.start:tok.end]
+		if got := tokenize(original); len(got) != 1 || got[0].term != tok.term {
+			t.Errorf("text[%d:%d] = %q does not tokenize to %q", tok.start, tok.end, original, tok.term)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	tests := map[rune]string{
+		'a': "a", 'A': "a", 'é': "e", 'Ç': "c", 'ñ': "n", 'Ø': "o", 'ß': "ss", 'œ': "oe", 'ı': "i", '1': "1",
+	}
+	for r, want := range tests {
+		if got := fold(r); got != want {
+			t.Errorf("fold(%q) = %q, want %q", r, got, want)
+		}
+	}
+}
+
+// searchFiles are the files of the search tests.
+var searchFiles = []File{
+	{ID: "passport", Name: "Passport John.pdf", Path: "Identity", Description: "Passport of John, valid until 2030."},
+	{ID: "id", Name: "Carte d'identité.pdf", Path: "Identity", Description: "French identity card of Marie."},
+	{ID: "tax", Name: "Tax notice 2023.pdf", Path: "Taxes", Description: "Income tax notice."},
+	{ID: "payslip", Name: "Payslip May.pdf", Path: "Payslips", Description: "Salary of May."},
+}
+
+func TestSearchIndex(t *testing.T) {
+	texts := map[string]string{
+		"tax":     "Avis d'impôt sur le revenu. Montant de l'impôt: 1 234 €.",
+		"payslip": "Salaire brut, cotisations, impôt prélevé à la source.",
+	}
+	s := NewSearchIndex(searchFiles, texts)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", nil},
+		{"passport", []string{"passport"}},
+		{"PASSPORT john", []string{"passport"}},
+		{"identite", []string{"id"}},
+		{"IDENTITÉ", []string{"id"}},
+		{"identity", []string{"id", "passport"}}, // In the path and the description of the identity card.
+		{"impot", []string{"tax", "payslip"}},    // Twice in the tax notice.
+		{"pass", []string{"passport"}},           // Prefix.
+		{"identity marie", []string{"id"}},       // Every term must match.
+		{"passport marie", nil},                  // In different files.
+		{"2030", []string{"passport"}},           // Digits.
+		{"revenu impot", []string{"tax"}},        // Accents and text.
+		{"nothing", nil},
+	}
+	for _, test := range tests {
+		var got []string
+		for _, r := range s.Search(test.query, 0) {
+			got = append(got, r.File.ID)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Search(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+
+	if got := s.Search("identity", 1); len(got) != 1 {
+		t.Errorf("Search(identity, 1) returned %d results, want 1", len(got))
+	}
+}
+
+func TestSearchIndexRanking(t *testing.T) {
+	files := []File{
+		{ID: "a", Name: "Notes.txt", Description: "lease"},
+		{ID: "b", Name: "Lease.pdf", Description: "lease of the flat"},
+		{ID: "c", Name: "Other.pdf", Description: "leases and other contracts, a much longer description of many things"},
+	}
+	results := NewSearchIndex(files, nil).Search("lease", 0)
+	var got []string
+	for _, r := range results {
+		got = append(got, r.File.ID)
+	}
+	// An exact match in the name ranks first, a prefix match in a long description last.
+	if want := []string{"b", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Search(lease) = %q, want %q", got, want)
+	}
+	for i := 1; i < len(results); i++ {
+		if results[i].Score > results[i-1].Score {
+			t.Errorf("results are not sorted by score: %v", results)
+		}
+	}
+}
+
+func TestSearchSnippet(t *testing.T) {
+	long := "Introduction. "
+	for range 30 {
+		long += "Lorem ipsum dolor sit amet. "
+	}
+	long += "The notice period of the lease is three months."
+	s := NewSearchIndex([]File{{ID: "x", Name: "Lease.pdf"}}, map[string]string{"x": long})
+
+	results := s.Search("notice period", 0)
+	if len(results) != 1 {
+		t.Fatalf("Search returned %d results, want 1", len(results))
+	}
+	snippet := results[0].Snippet
+	if want := "notice period of the lease is three months"; !strings.Contains(snippet, want) {
+		t.Errorf("snippet %q does not contain %q", snippet, want)
+	}
+	if !strings.HasPrefix(snippet, "…") {
+		t.Errorf("snippet %q does not start with an ellipsis", snippet)
+	}
+
+	// Without a match in the description or text, the snippet is the name.
+	if got := s.Search("lease.pdf", 0); len(got) != 1 || got[0].Snippet == "" {
+		t.Errorf("Search(lease.pdf) = %v, want a snippet", got)
+	}
+}
+
+func TestExtractedTextCurrent(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		text extractedText
+		file File
+		want bool
+	}{
+		{"same checksum", extractedText{MD5: "a"}, File{MD5Checksum: "a"}, true},
+		{"other checksum", extractedText{MD5: "a"}, File{MD5Checksum: "b"}, false},
+		{"workspace same time", extractedText{MD5: "export", Modified: modified}, File{Modified: modified}, true},
+		{"workspace same time elsewhere", extractedText{MD5: "export", Modified: modified.In(time.FixedZone("CET", 3600))}, File{Modified: modified}, true},
+		{"workspace modified", extractedText{MD5: "export", Modified: modified}, File{Modified: modified.Add(time.Second)}, false},
+		{"workspace unknown time", extractedText{MD5: "export"}, File{Modified: modified}, false},
+	}
+	for _, test := range tests {
+		if got := test.text.current(test.file); got != test.want {
+			t.Errorf("%s: current = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestAppSearch(t *testing.T) {
+	doc := testFile("b3", "doc", "Scan.pdf", nil)
+	sheet := testFile("b3", "sheet", "Budget", nil)
+	sheet.MimeType, sheet.MD5Checksum = "application/vnd.google-apps.spreadsheet", ""
+	a := newTestApp(t, doc, sheet)
+	ctx := context.Background()
+
+	search := func(query string) []string {
+		t.Helper()
+		results, err := a.Search(ctx, query, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, r := range results {
+			ids = append(ids, r.File.ID)
+		}
+		sort.Strings(ids)
+		return ids
+	}
+
+	if got := search("electricity"); got != nil {
+		t.Fatalf("Search(electricity) = %q before any text", got)
+	}
+	if err := storeText("doc", extractedText{MD5: "md5-doc", Text: "Electricity bill"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := storeText("sheet", extractedText{MD5: "export", Modified: sheet.Modified, Text: "Electricity 120 €"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := search("electricity"), []string{"doc", "sheet"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Search(electricity) = %q, want %q", got, want)
+	}
+
+	// The sheet is edited: its text is stale until its content is read again, or found unchanged.
+	edited := sheet
+	edited.Modified = sheet.Modified.Add(time.Hour)
+	a.index.Files["sheet"] = edited
+	if got, want := search("electricity"), []string{"doc"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Search(electricity) after an edit = %q, want %q", got, want)
+	}
+	if err := touchText("sheet", "export", edited.Modified); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := search("electricity"), []string{"doc", "sheet"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Search(electricity) after the same export = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,349 @@
+package b3app
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/genai"
+)
+
+// EmbedTask tells the embedder what the texts are used for.
+type EmbedTask string
+
+const (
+	EmbedDocument EmbedTask = "RETRIEVAL_DOCUMENT" // Texts stored in the vector store.
+	EmbedQuery    EmbedTask = "RETRIEVAL_QUERY"    // Texts searched for.
+)
+
+// Embedder turns texts into vectors, close when the texts have a close meaning.
+type Embedder interface {
+	// Name identifies the embedder and its model: vectors of different embedders cannot be compared.
+	Name() string
+	// Embed returns one vector per text.
+	Embed(ctx context.Context, texts []string, task EmbedTask) ([][]float32, error)
+}
+
+// Names of the embedders that can be configured in the 'embeddings' section.
+const (
+	EmbedderGemini = "gemini" // Gemini embeddings, the default.
+	EmbedderHash   = "hash"   // A local, deterministic, bag of words embedder.
+)
+
+// NewEmbedder returns the embedder configured in cfg.
+func NewEmbedder(cfg *Config, client *genai.Client) Embedder {
+	if cfg.Embeddings.Embedder == EmbedderHash {
+		return &HashEmbedder{Dim: cfg.Embeddings.Dimensions}
+	}
+	return &GeminiEmbedder{Client: client, Model: cfg.Embeddings.Model}
+}
+
+// GeminiEmbedder computes embeddings with the Gemini API.
+type GeminiEmbedder struct {
+	Client *genai.Client
+	Model  string // Like "gemini-embedding-001".
+}
+
+// geminiEmbedBatch is the maximum number of texts per request.
+const geminiEmbedBatch = 100
+
+func (e *GeminiEmbedder) Name() string { return EmbedderGemini + ":" + e.Model }
+
+func (e *GeminiEmbedder) Embed(ctx context.Context, texts []string, task EmbedTask) ([][]float32, error) {
+	var vectors [][]float32
+	for start := 0; start < len(texts); start += geminiEmbedBatch {
+		end := min(start+geminiEmbedBatch, len(texts))
+		var contents []*genai.Content
+		for _, t := range texts[start:end] {
+			contents = append(contents, genai.NewContentFromText(t, genai.RoleUser))
+		}
+		resp, err := e.Client.Models.EmbedContent(ctx, e.Model, contents, &genai.EmbedContentConfig{TaskType: string(task)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute embeddings: %w", err)
+		}
+		if len(resp.Embeddings) != end-start {
+			return nil, fmt.Errorf("failed to compute embeddings: got %d vectors for %d texts", len(resp.Embeddings), end-start)
+		}
+		for _, emb := range resp.Embeddings {
+			vectors = append(vectors, normalize(emb.Values))
+		}
+	}
+	return vectors, nil
+}
+
+// HashEmbedder is a local embedder hashing words and their trigrams into a fixed size vector.
+//
+// It knows nothing about meaning, but works offline, for free, and deterministically.
+type HashEmbedder struct {
+	Dim int // Dimension of the vectors, 256 if zero.
+}
+
+func (e *HashEmbedder) dim() int {
+	if e.Dim <= 0 {
+		return 256
+	}
+	return e.Dim
+}
+
+func (e *HashEmbedder) Name() string { return fmt.Sprintf("%s:%d", EmbedderHash, e.dim()) }
+
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string, task EmbedTask) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, e.dim())
+		add := func(feature string, weight float32) {
+			h := fnv.New32a()
+			h.Write([]byte(feature))
+			sum := h.Sum32()
+			// The top bit chooses the sign, so that collisions cancel out on average.
+			if sum&(1<<31) != 0 {
+				weight = -weight
+			}
+			v[int(sum%uint32(len(v)))] += weight
+		}
+		for _, t := range tokenize(text) {
+			add(t.term, 1)
+			// Trigrams make close words, like plural forms, close vectors.
+			padded := "^" + t.term + "$"
+			for j := 0; j+3 <= len(padded); j++ {
+				add(padded[j:j+3], 0.3)
+			}
+		}
+		vectors[i] = normalize(v)
+	}
+	return vectors, nil
+}
+
+// normalize scales v to a unit vector, so that the dot product is the cosine similarity.
+func normalize(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm == 0 {
+		return v
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	out := make([]float32, len(v))
+	for i, x := range v {
+		out[i] = x * scale
+	}
+	return out
+}
+
+// dot returns the dot product of two vectors of the same dimension.
+func dot(a, b []float32) float64 {
+	var s float64
+	for i := range min(len(a), len(b)) {
+		s += float64(a[i]) * float64(b[i])
+	}
+	return s
+}
+
+// chunkRunes is the approximate length of a chunk of text.
+const chunkRunes = 1000
+
+// chunks splits the searchable content of a file into passages of about chunkRunes,
+// on paragraph or word boundaries. The first one starts with the name and path.
+func chunks(f File, text string) []string {
+	content := strings.TrimSpace(f.Path + "/" + f.Name + "\n" + f.Description + "\n\n" + text)
+	var out []string
+	for content != "" {
+		if utf8.RuneCountInString(content) <= chunkRunes {
+			out = append(out, content)
+			break
+		}
+		// Cut at the last paragraph, line or space before the limit.
+		limit := len(string([]rune(content)[:chunkRunes]))
+		cut := -1
+		for _, sep := range []string{"\n\n", "\n", " "} {
+			if i := strings.LastIndex(content[:limit], sep); i > chunkRunes/2 {
+				cut = i
+				break
+			}
+		}
+		if cut < 0 {
+			cut = limit
+		}
+		out = append(out, strings.TrimSpace(content[:cut]))
+		content = strings.TrimLeftFunc(content[cut:], unicode.IsSpace)
+	}
+	return out
+}
+
+// VectorStore is the persistent store of the embeddings of the vault files.
+type VectorStore struct {
+	Embedder string                 `json:"embedder"` // Name of the embedder of all vectors.
+	Files    map[string]FileVectors `json:"files"`    // By file ID.
+}
+
+// FileVectors are the embeddings of the chunks of a file.
+type FileVectors struct {
+	Source  string      `json:"source"` // Hash of the chunks, to detect changes.
+	Vectors [][]float32 `json:"vectors"`
+}
+
+// vectorsPath returns the path to the vector store.
+func vectorsPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "vectors.json"), nil
+}
+
+// loadVectorStore reads the vector store. A missing store is empty.
+func loadVectorStore() (*VectorStore, error) {
+	path, err := vectorsPath()
+	if err != nil {
+		return nil, err
+	}
+	vs := &VectorStore{Files: make(map[string]FileVectors)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return vs, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vector store: %w", err)
+	}
+	if err := json.Unmarshal(data, vs); err != nil {
+		return nil, fmt.Errorf("failed to decode vector store %s: %w", path, err)
+	}
+	if vs.Files == nil {
+		vs.Files = make(map[string]FileVectors)
+	}
+	return vs, nil
+}
+
+// save writes the vector store.
+func (vs *VectorStore) save() error {
+	path, err := vectorsPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(vs)
+	if err != nil {
+		return fmt.Errorf("failed to encode vector store: %w", err)
+	}
+	if err := writePrivateFile(path, data); err != nil {
+		return fmt.Errorf("failed to write vector store: %w", err)
+	}
+	return nil
+}
+
+// sourceHash identifies the chunks of a file.
+func sourceHash(chunks []string) string {
+	h := sha256.New()
+	for _, c := range chunks {
+		h.Write([]byte(c))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// RelevantDocument is a file relevant to a goal.
+type RelevantDocument struct {
+	File    File    `json:"file"`
+	Score   float64 `json:"score"`   // Cosine similarity of the best passage, from -1 to 1.
+	Passage string  `json:"passage"` // The passage of the file closest to the goal.
+}
+
+// FindRelevantDocuments returns the files of B3 and B4 whose content is the closest in meaning to goal, at most limit.
+//
+// The vector store is brought up to date first: only new or changed files are embedded.
+func (a *App) FindRelevantDocuments(ctx context.Context, embedder Embedder, goal string, limit int) ([]RelevantDocument, error) {
+	if _, err := a.Sync(ctx); err != nil {
+		return nil, err
+	}
+	texts, err := loadTexts()
+	if err != nil {
+		return nil, err
+	}
+	vs, err := loadVectorStore()
+	if err != nil {
+		return nil, err
+	}
+	if vs.Embedder != embedder.Name() {
+		// Vectors of another embedder are meaningless, start over.
+		vs = &VectorStore{Embedder: embedder.Name(), Files: make(map[string]FileVectors)}
+	}
+
+	files := append(a.indexedFiles("B3"), a.indexedFiles("B4")...)
+	fileChunks := make(map[string][]string)
+	var stale []string // Files to embed.
+	var pending []string
+	for _, f := range files {
+		text := ""
+		if t, ok := texts[f.ID]; ok && t.current(f) {
+			text = t.Text
+		}
+		fileChunks[f.ID] = chunks(f, text)
+		if vs.Files[f.ID].Source != sourceHash(fileChunks[f.ID]) {
+			stale = append(stale, f.ID)
+			pending = append(pending, fileChunks[f.ID]...)
+		}
+	}
+
+	changed := len(stale) > 0
+	if len(pending) > 0 {
+		vectors, err := embedder.Embed(ctx, pending, EmbedDocument)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range stale {
+			n := len(fileChunks[id])
+			vs.Files[id] = FileVectors{Source: sourceHash(fileChunks[id]), Vectors: vectors[:n]}
+			vectors = vectors[n:]
+		}
+	}
+	// Forget the files that left the vault.
+	for id := range vs.Files {
+		if _, ok := fileChunks[id]; !ok {
+			delete(vs.Files, id)
+			changed = true
+		}
+	}
+	if changed {
+		if err := vs.save(); err != nil {
+			return nil, err
+		}
+	}
+
+	query, err := embedder.Embed(ctx, []string{goal}, EmbedQuery)
+	if err != nil {
+		return nil, err
+	}
+	var results []RelevantDocument
+	for _, f := range files {
+		best, passage := math.Inf(-1), ""
+		for i, v := range vs.Files[f.ID].Vectors {
+			if s := dot(query[0], v); s > best {
+				best, passage = s, fileChunks[f.ID][i]
+			}
+		}
+		if passage != "" {
+			results = append(results, RelevantDocument{File: f, Score: math.Round(best*1000) / 1000, Passage: passage})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].File.ID < results[j].File.ID
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
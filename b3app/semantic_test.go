@@ -0,0 +1,197 @@
+package b3app
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestHashEmbedder(t *testing.T) {
+	e := &HashEmbedder{Dim: 64}
+	if got, want := e.Name(), "hash:64"; got != want {
+		t.Errorf("Name() = %q, want %q", got, want)
+	}
+	if got, want := (&HashEmbedder{}).Name(), "hash:256"; got != want {
+		t.Errorf("Name() = %q, want %q", got, want)
+	}
+
+	texts := []string{"passport renewal", "Passport renewal", "passports renewals", "electricity bill", ""}
+	vectors, err := e.Embed(context.Background(), texts, EmbedDocument)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors) != len(texts) {
+		t.Fatalf("Embed returned %d vectors for %d texts", len(vectors), len(texts))
+	}
+	for i, v := range vectors[:4] {
+		if len(v) != 64 {
+			t.Errorf("vector %d has %d dimensions, want 64", i, len(v))
+		}
+		if norm := dot(v, v); math.Abs(norm-1) > 1e-5 {
+			t.Errorf("vector %d has a norm of %v, want 1", i, norm)
+		}
+	}
+	if s := dot(vectors[0], vectors[1]); math.Abs(s-1) > 1e-5 {
+		t.Errorf("case changes the vector: similarity %v", s)
+	}
+	if plural, other := dot(vectors[0], vectors[2]), dot(vectors[0], vectors[3]); plural <= other {
+		t.Errorf("plural forms are not closer (%v) than another text (%v)", plural, other)
+	}
+	if norm := dot(vectors[4], vectors[4]); norm != 0 {
+		t.Errorf("the empty text has a norm of %v, want 0", norm)
+	}
+
+	again, _ := e.Embed(context.Background(), texts[:1], EmbedQuery)
+	if s := dot(vectors[0], again[0]); math.Abs(s-1) > 1e-5 {
+		t.Errorf("Embed is not deterministic: similarity %v", s)
+	}
+}
+
+func TestChunks(t *testing.T) {
+	f := File{Path: "Identity", Name: "Passport.pdf", Description: "The passport of Marie."}
+	if got := chunks(f, ""); len(got) != 1 || got[0] != "Identity/Passport.pdf\nThe passport of Marie." {
+		t.Errorf("chunks of a short file = %q", got)
+	}
+
+	var b strings.Builder
+	for i := range 200 {
+		b.WriteString("Élément numéro ")
+		b.WriteString(strings.Repeat("x", i%7))
+		if i%20 == 19 {
+			b.WriteString(".\n\n")
+		} else {
+			b.WriteString(" ")
+		}
+	}
+	text := b.String()
+	got := chunks(f, text)
+	if len(got) < 2 {
+		t.Fatalf("chunks of a long file = %d chunks, want several", len(got))
+	}
+	if !strings.HasPrefix(got[0], "Identity/Passport.pdf\n") {
+		t.Errorf("the first chunk does not start with the path and name: %q", got[0][:40])
+	}
+	for i, c := range got {
+		if c == "" || c != strings.TrimSpace(c) {
+			t.Errorf("chunk %d is empty or not trimmed: %q", i, c)
+		}
+		if n := utf8.RuneCountInString(c); n > chunkRunes {
+			t.Errorf("chunk %d has %d runes, more than %d", i, n, chunkRunes)
+		}
+		if !utf8.ValidString(c) {
+			t.Errorf("chunk %d is cut within a rune", i)
+		}
+	}
+	// Chunks are cut on spaces: no word is lost or split.
+	want := strings.Fields(f.Path + "/" + f.Name + "\n" + f.Description + "\n\n" + text)
+	if joined := strings.Fields(strings.Join(got, " ")); strings.Join(joined, " ") != strings.Join(want, " ") {
+		t.Errorf("the chunks do not hold the words of the content")
+	}
+
+	// A content without spaces is cut anyway.
+	long := chunks(File{Name: "x"}, strings.Repeat("é", 3*chunkRunes))
+	if len(long) != 4 {
+		t.Errorf("chunks of a content without spaces = %d chunks, want 4", len(long))
+	}
+}
+
+// countingEmbedder is an embedder counting the texts it embeds for documents.
+type countingEmbedder struct {
+	HashEmbedder
+	name     string
+	embedded int
+}
+
+func (e *countingEmbedder) Name() string { return e.name }
+
+func (e *countingEmbedder) Embed(ctx context.Context, texts []string, task EmbedTask) ([][]float32, error) {
+	if task == EmbedDocument {
+		e.embedded += len(texts)
+	}
+	return e.HashEmbedder.Embed(ctx, texts, task)
+}
+
+func TestFindRelevantDocuments(t *testing.T) {
+	passport := testFile("b3", "passport", "Passport.pdf", nil)
+	passport.Description = "Passport of Marie Curie, issued by the prefecture."
+	bill := testFile("b3", "bill", "Bill.pdf", nil)
+	bill.Description = "Electricity bill of the flat, to pay before March."
+	lease := testFile("b4", "lease", "Lease.pdf", nil)
+	lease.Description = "Lease of the flat, with the rent and the deposit."
+	a := newTestApp(t, passport, bill, lease)
+	if err := storeText("bill", extractedText{MD5: "md5-bill", Text: "Consumption: 1200 kWh of electricity."}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	e := &countingEmbedder{name: "counting"}
+
+	find := func(goal string) []RelevantDocument {
+		t.Helper()
+		docs, err := a.FindRelevantDocuments(ctx, e, goal, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return docs
+	}
+
+	docs := find("electricity consumption")
+	if len(docs) != 3 || docs[0].File.ID != "bill" {
+		t.Fatalf("FindRelevantDocuments(electricity consumption) = %+v, want the bill first", docs)
+	}
+	if !strings.Contains(docs[0].Passage, "kWh") {
+		t.Errorf("the passage of the bill %q does not hold its text", docs[0].Passage)
+	}
+	for i := 1; i < len(docs); i++ {
+		if docs[i].Score > docs[i-1].Score {
+			t.Errorf("documents are not sorted by score: %+v", docs)
+		}
+	}
+	if got := find("passport Marie"); got[0].File.ID != "passport" {
+		t.Errorf("FindRelevantDocuments(passport Marie) ranks %s first, want the passport", got[0].File.ID)
+	}
+	if got := find("flat"); len(got) != 3 {
+		t.Errorf("FindRelevantDocuments(flat) = %d documents, want 3", len(got))
+	}
+	if got, err := a.FindRelevantDocuments(ctx, e, "flat", 1); err != nil || len(got) != 1 {
+		t.Errorf("FindRelevantDocuments(flat, 1) = %d documents, %v, want 1", len(got), err)
+	}
+
+	// The files are embedded once, until they change.
+	if e.embedded != 3 {
+		t.Errorf("%d chunks embedded, want 3", e.embedded)
+	}
+	e.embedded = 0
+	lease.Description = "Lease of the flat, renewed."
+	a.index.Files["lease"] = lease
+	delete(a.index.Files, "passport")
+	find("flat")
+	if e.embedded != 1 {
+		t.Errorf("%d chunks embedded after a change, want 1", e.embedded)
+	}
+	vs, err := loadVectorStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := vs.Files["passport"]; ok || len(vs.Files) != 2 {
+		t.Errorf("the vector store holds %d files, want the 2 left in the vault", len(vs.Files))
+	}
+
+	// The bill is modified: its text is stale, and left out of its passages.
+	e.embedded = 0
+	bill.MD5Checksum = "md5-bill-2"
+	a.index.Files["bill"] = bill
+	if docs := find("kWh"); e.embedded != 1 || strings.Contains(docs[0].Passage, "kWh") {
+		t.Errorf("%d chunks embedded after a new version, with passage %q: want 1, without the old text", e.embedded, docs[0].Passage)
+	}
+
+	// Vectors of another embedder are not comparable: everything is embedded again.
+	other := &countingEmbedder{name: "other"}
+	if _, err := a.FindRelevantDocuments(ctx, other, "flat", 0); err != nil {
+		t.Fatal(err)
+	}
+	if other.embedded != 2 {
+		t.Errorf("%d chunks embedded with another embedder, want 2", other.embedded)
+	}
+}
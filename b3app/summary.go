@@ -0,0 +1,104 @@
+package b3app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/etnz/b3/expert"
+	"google.golang.org/genai"
+)
+
+// recentFiles is the number of recently modified files listed in the vault summary.
+const recentFiles = 10
+
+// VaultSummary returns a compact description of the vault for the system prompt:
+// the number of files per folder and per document type, and the recently modified files.
+//
+// It is computed from the local index, and stays small however large the vault is.
+func (a *App) VaultSummary() string {
+	files := append(a.indexedFiles("B3"), a.indexedFiles("B4")...)
+
+	folders := make(map[string]int)
+	types := make(map[string]int)
+	noMetadata := 0
+	for _, f := range files {
+		// Categories are the first level of subfolders, like "B3/Identity".
+		parts := strings.SplitN(f.Path, "/", 3)
+		folders[strings.Join(parts[:min(len(parts), 2)], "/")]++
+		if f.Metadata != nil && f.Metadata.DocumentType != "" {
+			types[f.Metadata.DocumentType]++
+		} else {
+			noMetadata++
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d files in B3, %d in B4 (index %s).\n", folders["B3"]+countUnder(folders, "B3/"), folders["B4"]+countUnder(folders, "B4/"), a.Staleness())
+	b.WriteString("Files per folder: " + formatCounts(folders) + ".\n")
+	if len(types) > 0 {
+		b.WriteString("Files per document type: " + formatCounts(types) + ".\n")
+	}
+	if noMetadata > 0 {
+		fmt.Fprintf(&b, "%d files have no structured metadata yet.\n", noMetadata)
+	}
+
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Modified.After(files[j].Modified) })
+	if len(files) > 0 {
+		b.WriteString("Recently modified files:\n")
+		for _, f := range files[:min(len(files), recentFiles)] {
+			fmt.Fprintf(&b, "  * %s/%s (ID %s), %s\n", f.Path, f.Name, f.ID, f.Modified.Format("2006-01-02 15:04"))
+		}
+	}
+	return b.String()
+}
+
+// countUnder returns the number of files in the folders starting with prefix.
+func countUnder(counts map[string]int, prefix string) int {
+	n := 0
+	for k, c := range counts {
+		if strings.HasPrefix(k, prefix) {
+			n += c
+		}
+	}
+	return n
+}
+
+// formatCounts formats counts like "B3/Car: 3, B3/Identity: 5", sorted by key.
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %d", k, counts[k]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// mutatingTools are the tools that change the vault content.
+var mutatingTools = map[string]bool{
+	"UpdateFile":   true,
+	"DownloadToB4": true,
+	"B4Merge":      true,
+	"CreateDoc":    true,
+	"FillForm":     true,
+	"B4Delete":     true,
+}
+
+// refreshingTool wraps a tool changing the vault, so that the system prompt is refreshed after each successful call.
+type refreshingTool struct {
+	expert.Tool
+	refresh func(ctx context.Context)
+}
+
+func (t *refreshingTool) Call(ctx context.Context, args map[string]any) genai.FunctionResponse {
+	resp := t.Tool.Call(ctx, args)
+	if _, failed := resp.Response["error"]; !failed {
+		t.refresh(ctx)
+	}
+	return resp
+}
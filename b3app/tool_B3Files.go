@@ -28,9 +28,11 @@ func (t *B3FilesTool) Declare() genai.FunctionDeclaration {
 		Description: `Fetches the most up-to-date index of all files in the user's B3 folder. 
 		You should call this at the beginning of a new conversation 
 		or if you suspect the user may have added or changed files. 
+		The result also reports the files added, modified, moved or removed since the previous listing (in B3 or B4).
 		In the result you will get a list of all files and for each:
 		  - their unique ID: to communicate with other tools)
 		  - a human meaningful name: to communicate with the user
+		  - the folder path (like B3/Car), MIME type, size, MD5 checksum (identical checksums mean duplicates), creation and modification times, parents and owners
 		  - a rather long description that describes the document nature, purpose and content. 
 		`,
 	}
@@ -45,12 +47,24 @@ func (t *B3FilesTool) Call(ctx context.Context, args map[string]any) (resp genai
 		}
 	}()
 
-	files, err := t.app.B3Files(ctx)
+	changes, err := t.app.Sync(ctx)
 	if err != nil {
 		resp.Response["error"] = err.Error()
 		return
 	}
+	files := t.app.indexedFiles("B3")
 	resp.Response["output"] = files
+	if t.app.Offline {
+		resp.Response["offline"] = fmt.Sprintf("B3 is offline, this index was %s.", t.app.Staleness())
+	}
+	if !changes.Empty() {
+		// Tell exactly what changed since the last listing, across B3 and B4.
+		resp.Response["changes"] = changes
+	}
+	if limitations := t.app.Scope.Limitations(); len(limitations) > 0 {
+		// The listing may be incomplete, make sure the model knows why.
+		resp.Response["limitations"] = limitations
+	}
 	t.logger.LogResponse("B3Files", fmt.Sprintf("Found %d files.", len(files)))
 	return
 }
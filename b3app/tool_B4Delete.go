@@ -31,7 +31,8 @@ func (t *B4DeleteTool) Declare() genai.FunctionDeclaration {
 	return genai.FunctionDeclaration{
 		Name: "B4Delete",
 		Description: `Permanently deletes one or more files from the B4 folder.
-		This action is irreversible. It will only delete files located inside the B4 folder as a safety measure.`,
+		This action is irreversible. It will only delete files located inside the B4 folder as a safety measure.
+		When the vault is in a shared drive, files are moved to the shared drive trash instead, where they are purged after 30 days.`,
 		Parameters: &genai.Schema{
 			Type: genai.TypeObject,
 			Properties: map[string]*genai.Schema{
@@ -114,13 +114,19 @@ func (t *B4MergeTool) Call(ctx context.Context, args map[string]any) (resp genai
 	var tempFiles []string
 	// If appending, the target file must be the first in the list for merging.
 	if targetFileID != "" {
-		content, mimeType, err := t.app.GetFileContent(ctx, targetFileID)
+		// Google Docs are read as PDF, but their content cannot be replaced by a PDF.
+		targetMeta, err := t.app.filesGet(ctx, targetFileID).Fields("mimeType").Do()
 		if err != nil {
-			resp.Response["error"] = fmt.Sprintf("getting content for target file %s: %s", targetFileID, err)
+			resp.Response["error"] = fmt.Sprintf("failed to get metadata for target file %s: %v", targetFileID, err)
+			return
+		}
+		if targetMeta.MimeType != "application/pdf" {
+			resp.Response["error"] = fmt.Sprintf("target file %s is not a PDF (%s), cannot merge", targetFileID, targetMeta.MimeType)
 			return
 		}
-		if mimeType != "application/pdf" {
-			resp.Response["error"] = fmt.Sprintf("target file %s is not a PDF (%s), cannot merge", targetFileID, mimeType)
+		content, _, err := t.app.GetFileContent(ctx, targetFileID)
+		if err != nil {
+			resp.Response["error"] = fmt.Sprintf("getting content for target file %s: %s", targetFileID, err)
 			return
 		}
 		tmpFile, err := os.CreateTemp("", "b3-merge-target-*.pdf")
@@ -139,7 +145,7 @@ func (t *B4MergeTool) Call(ctx context.Context, args map[string]any) (resp genai
 	}
 
 	for _, id := range fileIDs {
-		fileMeta, err := t.app.DriveService.Files.Get(id).Fields("mimeType").Do()
+		fileMeta, err := t.app.filesGet(ctx, id).Fields("mimeType").Do()
 		if err != nil {
 			resp.Response["error"] = fmt.Sprintf("failed to get metadata for file %s: %v", id, err)
 			return
@@ -0,0 +1,76 @@
+package b3app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/etnz/b3/expert"
+	"google.golang.org/genai"
+)
+
+type CheckConsistencyTool struct {
+	app    *App
+	logger expert.ConversationLogger
+}
+
+func NewCheckConsistencyTool(app *App) *CheckConsistencyTool {
+	return &CheckConsistencyTool{app: app}
+}
+
+func (t *CheckConsistencyTool) Start(ctx context.Context, client *genai.Client, logger expert.ConversationLogger) error {
+	t.logger = logger
+	return nil
+}
+
+func (t *CheckConsistencyTool) Declare() genai.FunctionDeclaration {
+	return genai.FunctionDeclaration{
+		Name: "CheckConsistency",
+		Description: `Cross-checks what the documents of the vault say about each person, locally and instantly, and reports the conflicts:
+		names spelled differently, different birth dates or tax numbers, different addresses on documents of the same period,
+		and impossible dates, like a document issued before its holder is born.
+		Use it before filling a form or preparing a procedure, to know which value is right, or when the user asks to check their documents.
+		It returns a list of conflicts, with:
+		  - 'entity': the person concerned.
+		  - 'kind': one of "name-variant", "birth-date", "identifier", "address" or "date".
+		  - 'severity': "error", "warning" or "info".
+		  - 'message': what is inconsistent.
+		  - 'facts': the conflicting values, each with the 'file_id' and 'file' it comes from.
+		It only knows what is in the metadata of the files, and in the documents already read.`,
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"entity": {Type: genai.TypeString, Description: "Optional. Only report the conflicts of people whose name contains this, like \"Curie\"."},
+			},
+		},
+	}
+}
+
+func (t *CheckConsistencyTool) Call(ctx context.Context, args map[string]any) (resp genai.FunctionResponse) {
+	resp.Response = make(map[string]any)
+	defer func() {
+		if err, ok := resp.Response["error"]; ok {
+			t.logger.LogResponse("CheckConsistency", fmt.Sprintf("Error: %v", err))
+		}
+	}()
+
+	entity, _ := args["entity"].(string)
+	t.logger.LogQuestion("CheckConsistency", fmt.Sprintf("Check the consistency of the documents %s", entity))
+
+	conflicts := t.app.CheckConsistency(time.Now())
+	if entity != "" {
+		want := foldWords(entity)
+		var filtered []Conflict
+		for _, c := range conflicts {
+			if strings.Contains(foldWords(c.Entity), want) {
+				filtered = append(filtered, c)
+			}
+		}
+		conflicts = filtered
+	}
+
+	resp.Response["output"] = conflicts
+	t.logger.LogResponse("CheckConsistency", fmt.Sprintf("Found %d conflicts.", len(conflicts)))
+	return
+}
@@ -88,7 +88,7 @@ func (t *CreateDocTool) Call(ctx context.Context, args map[string]any) (resp gen
 	}
 
 	// 2. Copy and Convert to Google Doc
-	newDoc, err := t.app.DriveService.Files.Copy(tempMdFile.ID, &drive.File{
+	newDoc, err := t.app.filesCopy(ctx, tempMdFile.ID, &drive.File{
 		Name:     outputName,
 		MimeType: "application/vnd.google-apps.document",
 	}).Fields("id", "name").Do()
@@ -0,0 +1,78 @@
+package b3app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/etnz/b3/expert"
+	"google.golang.org/genai"
+)
+
+type FindRelevantDocumentsTool struct {
+	app      *App
+	embedder Embedder
+	logger   expert.ConversationLogger
+}
+
+func NewFindRelevantDocumentsTool(app *App) *FindRelevantDocumentsTool {
+	return &FindRelevantDocumentsTool{app: app}
+}
+
+func (t *FindRelevantDocumentsTool) Start(ctx context.Context, client *genai.Client, logger expert.ConversationLogger) error {
+	t.embedder = NewEmbedder(t.app.Config, client)
+	t.logger = logger
+	return nil
+}
+
+func (t *FindRelevantDocumentsTool) Declare() genai.FunctionDeclaration {
+	return genai.FunctionDeclaration{
+		Name: "FindRelevantDocuments",
+		Description: `Finds the documents of the B3 and B4 folders that best serve a goal, by meaning rather than keywords,
+		like "something that proves where I live" or "proof of income for the last 3 months".
+		Returns candidates, the most relevant first, each with the file, a similarity score from -1 to 1,
+		and the passage of the document closest to the goal.
+		Candidates are not guaranteed to fit: check them, and read them when in doubt.
+		`,
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"goal":  {Type: genai.TypeString, Description: "What the documents are needed for, in plain words."},
+				"limit": {Type: genai.TypeInteger, Description: "The maximum number of candidates, 5 by default."},
+			},
+			Required: []string{"goal"},
+		},
+	}
+}
+
+func (t *FindRelevantDocumentsTool) Call(ctx context.Context, args map[string]any) (resp genai.FunctionResponse) {
+	resp.Response = make(map[string]any)
+	defer func() {
+		if err, ok := resp.Response["error"]; ok {
+			t.logger.LogResponse("FindRelevantDocuments", fmt.Sprintf("Error: %v", err))
+		}
+	}()
+
+	goal, ok := args["goal"].(string)
+	if !ok || goal == "" {
+		resp.Response["error"] = fmt.Sprintf("invalid 'goal' argument: %v", args["goal"])
+		return
+	}
+	limit := 5
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = int(l)
+	}
+
+	t.logger.LogQuestion("FindRelevantDocuments", fmt.Sprintf("Find documents for %q.", goal))
+
+	docs, err := t.app.FindRelevantDocuments(ctx, t.embedder, goal, limit)
+	if err != nil {
+		resp.Response["error"] = err.Error()
+		return
+	}
+	resp.Response["output"] = docs
+	if t.app.Offline {
+		resp.Response["offline"] = fmt.Sprintf("B3 is offline, this index was %s.", t.app.Staleness())
+	}
+	t.logger.LogResponse("FindRelevantDocuments", fmt.Sprintf("Found %d candidates.", len(docs)))
+	return
+}
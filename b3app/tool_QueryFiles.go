@@ -0,0 +1,115 @@
+package b3app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/etnz/b3/expert"
+	"google.golang.org/genai"
+)
+
+type QueryFilesTool struct {
+	app    *App
+	logger expert.ConversationLogger
+}
+
+func NewQueryFilesTool(app *App) *QueryFilesTool {
+	return &QueryFilesTool{app: app}
+}
+
+func (t *QueryFilesTool) Start(ctx context.Context, client *genai.Client, logger expert.ConversationLogger) error {
+	t.logger = logger
+	return nil
+}
+
+func (t *QueryFilesTool) Declare() genai.FunctionDeclaration {
+	str := func(description string) *genai.Schema {
+		return &genai.Schema{Type: genai.TypeString, Description: description}
+	}
+	return genai.FunctionDeclaration{
+		Name: "QueryFiles",
+		Description: `Asks Google Drive for the files of the B3 and B4 folders matching filters.
+		All the filters that are set must match. Use it to locate documents without listing all files,
+		for instance every file modified this year in B3/Car, or the passport of a given holder.
+		Returns a page of files, and a 'next_page_token' to pass back to get the next page, absent on the last page.
+		Pages can have fewer files than requested even when there are more.
+		The most recently modified files come first within a page, but not across pages: read all pages to find the most recent ones.
+		`,
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"name_contains":   str("Words in the file name."),
+				"full_text":       str("Words in the file name, description or content."),
+				"mime_type":       str("Exact MIME type, like application/pdf, or a prefix ending with '/', like image/."),
+				"modified_after":  str("Only files modified after this date, formatted as YYYY-MM-DD."),
+				"modified_before": str("Only files modified before this date, formatted as YYYY-MM-DD."),
+				"folder":          str("The vault folder to search, with its subfolders, like B3/Car. The whole vault by default."),
+				"metadata": {
+					Type: genai.TypeArray,
+					Description: `Filters on the structured metadata of the files: the field must have exactly this value.
+					Fields are document_type, holder, birth_date, issuer, issue_date, expiry_date, address, language, identifier.<kind> (like identifier.passport_number) or amount.<label>.`,
+					Items: &genai.Schema{
+						Type: genai.TypeObject,
+						Properties: map[string]*genai.Schema{
+							"field": str("The metadata field, like document_type."),
+							"value": str("The exact value, like passport."),
+						},
+						Required: []string{"field", "value"},
+					},
+				},
+				"page_size":  {Type: genai.TypeInteger, Description: "The maximum number of files in the page, 50 by default."},
+				"page_token": str("The 'next_page_token' of the previous page, to get the next one."),
+			},
+		},
+	}
+}
+
+func (t *QueryFilesTool) Call(ctx context.Context, args map[string]any) (resp genai.FunctionResponse) {
+	resp.Response = make(map[string]any)
+	defer func() {
+		if err, ok := resp.Response["error"]; ok {
+			t.logger.LogResponse("QueryFiles", fmt.Sprintf("Error: %v", err))
+		}
+	}()
+
+	q := &FileQuery{}
+	q.NameContains, _ = args["name_contains"].(string)
+	q.FullText, _ = args["full_text"].(string)
+	q.MimeType, _ = args["mime_type"].(string)
+	q.ModifiedAfter, _ = args["modified_after"].(string)
+	q.ModifiedBefore, _ = args["modified_before"].(string)
+	q.Folder, _ = args["folder"].(string)
+	if arg, ok := args["metadata"]; ok && arg != nil {
+		var filters []struct{ Field, Value string }
+		data, _ := json.Marshal(arg)
+		if err := json.Unmarshal(data, &filters); err != nil {
+			resp.Response["error"] = fmt.Sprintf("invalid 'metadata' argument: %v", err)
+			return
+		}
+		q.Metadata = make(map[string]string)
+		for _, f := range filters {
+			q.Metadata[f.Field] = f.Value
+		}
+	}
+	pageSize := 50
+	if s, ok := args["page_size"].(float64); ok && s > 0 {
+		pageSize = min(int(s), 1000)
+	}
+	pageToken, _ := args["page_token"].(string)
+
+	filters, _ := json.Marshal(q)
+	t.logger.LogQuestion("QueryFiles", fmt.Sprintf("Query files matching %s.", filters))
+
+	files, next, err := t.app.QueryFiles(ctx, q, pageSize, pageToken)
+	if err != nil {
+		resp.Response["error"] = err.Error()
+		return
+	}
+	resp.Response["output"] = files
+	if next != "" {
+		resp.Response["next_page_token"] = next
+	}
+	t.logger.LogResponse("QueryFiles", fmt.Sprintf("Found %d files.", len(files)))
+	return
+}
@@ -29,8 +29,32 @@ func (t *ReadFileTool) Declare() genai.FunctionDeclaration {
 		Name: "ReadFile",
 		Description: `Reads and extract the full detailed content of a single, specific file. 
 		Use this when you need to perform a deep analysis of a document, 
-		especially one that has a missing or incomplete description.`,
-		Parameters: &genai.Schema{Type: genai.TypeObject, Properties: map[string]*genai.Schema{"file_id": {Type: genai.TypeString, Description: "The unique ID of the file to read."}}, Required: []string{"file_id"}},
+		especially one that has a missing or incomplete description.
+		Google Docs and Slides are read as PDF, Google Sheets as CSV.
+		It returns:
+		  - 'extraction': the structured content (suggested name, document type, people, dates, identifiers, addresses, amounts),
+		    each fact with a 'confidence' from 0 to 1 and the 'pages' where it was found.
+		  - 'suggested_name': a file name, following the naming pattern of the document type.
+		  - 'description': a description generated from the extraction.
+		  - 'folder': the B3 sub-folder where this type of document is filed.
+		  - 'metadata': the metadata ready to be stored with UpdateFile.
+		  'suggested_name', 'folder' and 'metadata' are only returned for the whole document, not for 'pages':
+		  compose them yourself from the sections read.
+		  - 'warnings': facts dropped because they were invalid, and fields missing or inconsistent for the document type.
+		  - 'pages': the pages read, when not the whole document.
+		  - 'text_layer': true when a PDF was analyzed from its text layer only, without its images.
+		  - 'cached': when set, the time of a previous analysis of the same content, returned instantly.
+		Double check facts with a low confidence before using them.
+		Long PDF documents must be read section by section, with 'pages': the error tells when a document is too long.`,
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"file_id": {Type: genai.TypeString, Description: "The unique ID of the file to read."},
+				"pages":   {Type: genai.TypeString, Description: "Optional. The pages of a PDF to read, like \"3-5\" or \"1,4-6\". The whole document by default."},
+				"refresh": {Type: genai.TypeBoolean, Description: "When true, read the file again even if it did not change since the last analysis."},
+			},
+			Required: []string{"file_id"},
+		},
 	}
 }
 
@@ -48,53 +72,21 @@ func (t *ReadFileTool) Call(ctx context.Context, args map[string]any) (resp gena
 		return
 	}
 
-	t.logger.LogQuestion("ReadFile", fmt.Sprintf("Read file with ID: %s", fileID))
-
-	content, mimeType, err := t.app.GetFileContent(ctx, fileID)
-	if err != nil {
-		resp.Response["error"] = err.Error()
-		return
+	pages, _ := args["pages"].(string)
+	if pages != "" {
+		t.logger.LogQuestion("ReadFile", fmt.Sprintf("Read pages %s of file with ID: %s", pages, fileID))
+	} else {
+		t.logger.LogQuestion("ReadFile", fmt.Sprintf("Read file with ID: %s", fileID))
 	}
 
-	// Send the blob to a dedicated Gemini instance for doc reading
-	genContent := []*genai.Content{&genai.Content{
-		// TODO(etnz): this is a bug, the role should be user
-		Role: genai.RoleUser,
-		Parts: []*genai.Part{
-			&genai.Part{
-				InlineData: &genai.Blob{MIMEType: mimeType, Data: content},
-			},
-		},
-	}}
-
-	gen, err := t.client.Models.GenerateContent(ctx, "gemini-2.5-pro", genContent, &genai.GenerateContentConfig{
-		SystemInstruction: &genai.Content{Parts: []*genai.Part{
-			{Text: `Read the file provided to you, and extract a good name and description.
-			A good name reflects the administrative nature of the document.
-			A good description describes:
-			  - the administrative nature of the document.
-			  - the adminstrative purpose of such a document.
-			  - the content of the file. If the file contains personal data (ID number, name, personal dates, expiration dates) they
-			    must be extracted and listed in the description.
-`},
-		}},
-	})
-
+	refresh, _ := args["refresh"].(bool)
+	analysis, err := t.app.AnalyzeFile(ctx, t.client, fileID, pages, refresh)
 	if err != nil {
-		resp.Response["error"] = fmt.Sprintf("analyzing content: %v", err)
-		return
-	}
-	if len(gen.Candidates) == 0 {
-		resp.Response["error"] = "received 0 Candidates from analysis"
-		return
-	}
-	parts := gen.Candidates[0].Content.Parts
-	if len(parts) == 0 || parts[0].Text == "" {
-		resp.Response["error"] = "received empty response from analysis"
+		resp.Response["error"] = err.Error()
 		return
 	}
 
-	resp.Response["output"] = parts[0].Text
-	t.logger.LogResponse("ReadFile", "Successfully extracted and analyzed file content.")
+	resp.Response["output"] = analysis
+	t.logger.LogResponse("ReadFile", fmt.Sprintf("Successfully analyzed file content as %s, with %d warnings.", analysis.Extraction.DocumentType.Value, len(analysis.Warnings)))
 	return
 }
@@ -0,0 +1,74 @@
+package b3app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/etnz/b3/expert"
+	"google.golang.org/genai"
+)
+
+type ReadTextTool struct {
+	app    *App
+	logger expert.ConversationLogger
+}
+
+func NewReadTextTool(app *App) *ReadTextTool {
+	return &ReadTextTool{app: app}
+}
+
+func (t *ReadTextTool) Start(ctx context.Context, client *genai.Client, logger expert.ConversationLogger) error {
+	t.logger = logger
+	return nil
+}
+
+func (t *ReadTextTool) Declare() genai.FunctionDeclaration {
+	return genai.FunctionDeclaration{
+		Name: "ReadText",
+		Description: `Reads the raw text of a file, locally and instantly: the text layer and the filled form fields of a PDF,
+		or the content of a text file, like a Google Sheet read as CSV.
+		Use it for cheap and precise lookups, like copying an identifier, an IBAN or an amount exactly as printed.
+		It returns:
+		  - 'text': the text of each page, and the form fields with their value.
+		  - 'complete': false when some pages have no usable text layer, like scans: read those with ReadFile.
+		Word spacing is approximate. Scans and images have no text: use ReadFile for them.`,
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"file_id": {Type: genai.TypeString, Description: "The unique ID of the file to read."},
+				"pages":   {Type: genai.TypeString, Description: "Optional. The pages of a PDF to read, like \"3-5\" or \"1,4-6\". The whole document by default."},
+			},
+			Required: []string{"file_id"},
+		},
+	}
+}
+
+func (t *ReadTextTool) Call(ctx context.Context, args map[string]any) (resp genai.FunctionResponse) {
+	resp.Response = make(map[string]any)
+	defer func() {
+		if err, ok := resp.Response["error"]; ok {
+			t.logger.LogResponse("ReadText", fmt.Sprintf("Error: %v", err))
+		}
+	}()
+
+	fileID, ok := args["file_id"].(string)
+	if !ok || fileID == "" {
+		resp.Response["error"] = fmt.Sprintf("invalid 'file_id' argument: %v", args["file_id"])
+		return
+	}
+	pages, _ := args["pages"].(string)
+	t.logger.LogQuestion("ReadText", fmt.Sprintf("Read the text of file %s %s", fileID, pages))
+
+	text, err := t.app.ReadText(ctx, fileID, pages)
+	if err != nil {
+		resp.Response["error"] = err.Error()
+		return
+	}
+
+	resp.Response["output"] = map[string]any{
+		"text":     text,
+		"complete": text.Sufficient(),
+	}
+	t.logger.LogResponse("ReadText", fmt.Sprintf("Read the text of %d pages and %d form fields.", len(text.Pages), len(text.Fields)))
+	return
+}
@@ -0,0 +1,76 @@
+package b3app
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/etnz/b3/expert"
+	"google.golang.org/genai"
+)
+
+type SearchFilesTool struct {
+	app    *App
+	logger expert.ConversationLogger
+}
+
+func NewSearchFilesTool(app *App) *SearchFilesTool {
+	return &SearchFilesTool{app: app}
+}
+
+func (t *SearchFilesTool) Start(ctx context.Context, client *genai.Client, logger expert.ConversationLogger) error {
+	t.logger = logger
+	return nil
+}
+
+func (t *SearchFilesTool) Declare() genai.FunctionDeclaration {
+	return genai.FunctionDeclaration{
+		Name: "SearchFiles",
+		Description: `Searches the files of the B3 and B4 folders by keywords, like "passport Marie" or "EDF 2024".
+		The search looks into file names, folder paths, descriptions, metadata and the content of documents already read,
+		ignoring case and accents. Every keyword must match, either a whole word or the beginning of a word.
+		Returns the best matches first, each with the file, a relevance score, and a snippet of the matching passage.
+		Use it to find a document instead of scanning the full list of files.
+		`,
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"query": {Type: genai.TypeString, Description: "The keywords to search for."},
+				"limit": {Type: genai.TypeInteger, Description: "The maximum number of results, 10 by default."},
+			},
+			Required: []string{"query"},
+		},
+	}
+}
+
+func (t *SearchFilesTool) Call(ctx context.Context, args map[string]any) (resp genai.FunctionResponse) {
+	resp.Response = make(map[string]any)
+	defer func() {
+		if err, ok := resp.Response["error"]; ok {
+			t.logger.LogResponse("SearchFiles", fmt.Sprintf("Error: %v", err))
+		}
+	}()
+
+	query, ok := args["query"].(string)
+	if !ok || query == "" {
+		resp.Response["error"] = fmt.Sprintf("invalid 'query' argument: %v", args["query"])
+		return
+	}
+	limit := 10
+	if l, ok := args["limit"].(float64); ok && l > 0 {
+		limit = int(l)
+	}
+
+	t.logger.LogQuestion("SearchFiles", fmt.Sprintf("Search files for %q.", query))
+
+	results, err := t.app.Search(ctx, query, limit)
+	if err != nil {
+		resp.Response["error"] = err.Error()
+		return
+	}
+	resp.Response["output"] = results
+	if t.app.Offline {
+		resp.Response["offline"] = fmt.Sprintf("B3 is offline, this index was %s.", t.app.Staleness())
+	}
+	t.logger.LogResponse("SearchFiles", fmt.Sprintf("Found %d files.", len(results)))
+	return
+}
@@ -31,16 +31,24 @@ func (t *UpdateFileTool) Declare() genai.FunctionDeclaration {
 		describe the file content in detail, contains all the relevant personal information contained
 		in the file, as well as the relationship with the primary identity, and any extra relevant information
 		that might have been captured in the discussion.
-		Optionally, for files in the B4 folder, an 'archive' option will move them to the B3 folder.
-		Returns true on success.
+		Always fill the structured 'metadata' too, with the facts found in the document: it is stored
+		in a queryable form, and a readable copy of it is appended to the description automatically.
+		Optionally, for files in the B4 folder, an 'archive' option will move them to the B3 folder, in the folder of their document type.
+		Identifiers with check digits (IBAN, card number, machine-readable zone, nir, dni, steuer_id) are verified:
+		the update is refused when one is invalid, as it is most likely misread. Check it in the document, and
+		only set 'accept_invalid' when it is really printed that way.
+		Returns true on success, and 'warnings' when the metadata misses required fields or breaks
+		the validity rules of its document type: check the document and fix them.
 		`,
 		Parameters: &genai.Schema{
 			Type: genai.TypeObject,
 			Properties: map[string]*genai.Schema{
-				"file_id":     {Type: genai.TypeString, Description: "The unique FileID of the file to modify."},
-				"name":        {Type: genai.TypeString, Description: "The new name for the file."},
-				"description": {Type: genai.TypeString, Description: "The new text for the file's description."},
-				"archive":     {Type: genai.TypeBoolean, Description: "when true, and the file will be moved to the B4 folder."},
+				"file_id":        {Type: genai.TypeString, Description: "The unique FileID of the file to modify."},
+				"name":           {Type: genai.TypeString, Description: "The new name for the file."},
+				"description":    {Type: genai.TypeString, Description: "The new text for the file's description."},
+				"metadata":       metadataSchema(),
+				"archive":        {Type: genai.TypeBoolean, Description: "when true, the file is moved to the B3 folder, in the folder of its document type, like B3/Housing."},
+				"accept_invalid": {Type: genai.TypeBoolean, Description: "Optional. When true, identifiers failing their check digits are written anyway."},
 			},
 			Required: []string{"file_id"},
 		},
@@ -67,11 +75,28 @@ func (t *UpdateFileTool) Call(ctx context.Context, args map[string]any) (resp ge
 		return
 	}
 
-	if name == "" && description == "" {
-		resp.Response["error"] = "update tool called without 'name' or 'description' to update."
+	var metadata *Metadata
+	if arg, ok := args["metadata"]; ok && arg != nil {
+		var err error
+		if metadata, err = metadataFromArgs(arg); err != nil {
+			resp.Response["error"] = err.Error()
+			return
+		}
+		// The model writes metadata for the current content, whatever it copied from a listing.
+		metadata.SourceMD5 = ""
+	}
+
+	if name == "" && description == "" && metadata == nil {
+		resp.Response["error"] = "update tool called without 'name', 'description' or 'metadata' to update."
 		return
 	}
 	archive, _ := args["archive"].(bool)
+	if accept, _ := args["accept_invalid"].(bool); metadata != nil && !accept {
+		if invalid := metadata.invalidIdentifiers(); len(invalid) > 0 {
+			resp.Response["error"] = fmt.Sprintf("invalid identifiers, check them in the document: %s", strings.Join(invalid, "; "))
+			return
+		}
+	}
 	// arch will be true iif the parameter is there and its value is true
 
 	var updates []string
@@ -81,14 +106,22 @@ func (t *UpdateFileTool) Call(ctx context.Context, args map[string]any) (resp ge
 	if description != "" {
 		updates = append(updates, "description")
 	}
+	if metadata != nil {
+		updates = append(updates, "metadata")
+	}
 
 	t.logger.LogQuestion("UpdateFile", fmt.Sprintf("Update file %s: set %s.", fileID, strings.Join(updates, " and ")))
 
-	err := t.app.UpdateFile(ctx, fileID, name, description, archive)
+	err := t.app.UpdateFile(ctx, fileID, name, description, metadata, archive)
 	if err != nil {
 		resp.Response["error"] = err.Error()
 		return
 	}
 	resp.Response["output"] = true
+	if metadata != nil {
+		if problems := t.app.Config.checkMetadata(metadata); len(problems) > 0 {
+			resp.Response["warnings"] = problems
+		}
+	}
 	return
 }
@@ -0,0 +1,165 @@
+package b3app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+const folderMimeType = "application/vnd.google-apps.folder"
+
+// findB3FolderID returns the ID of the B3 folder.
+func (a *App) findB3FolderID(ctx context.Context) (string, error) {
+	return a.resolveVaultFolder(ctx, "B3", a.Config.Vault.B3Folder, a.Config.Vault.B3FolderID)
+}
+
+// findB4FolderID returns the ID of the B4 folder.
+func (a *App) findB4FolderID(ctx context.Context) (string, error) {
+	return a.resolveVaultFolder(ctx, "B4", a.Config.Vault.B4Folder, a.Config.Vault.B4FolderID)
+}
+
+// resolveVaultFolder returns the ID of the vault folder called role ("B3" or "B4").
+//
+// A pinned folder ID takes precedence over the path. Otherwise the path (like
+// "Admin/Family/B3") is walked from the root of the Drive. The result is cached
+// for the whole session, so the Drive is only queried once per folder.
+func (a *App) resolveVaultFolder(ctx context.Context, role, path, pinnedID string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if id, ok := a.folderIDs[role]; ok {
+		return id, nil
+	}
+
+	var id string
+	var err error
+	if pinnedID != "" {
+		id, err = a.checkFolderID(ctx, role, pinnedID)
+	} else {
+		id, err = a.findFolderPath(ctx, path)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if a.folderIDs == nil {
+		a.folderIDs = make(map[string]string)
+	}
+	a.folderIDs[role] = id
+	return id, nil
+}
+
+// checkFolderID verifies that the pinned folder id exists and is a folder.
+func (a *App) checkFolderID(ctx context.Context, role, id string) (string, error) {
+	f, err := a.filesGet(ctx, id).Fields("id", "mimeType", "trashed", "driveId").Do()
+	if err != nil {
+		return "", fmt.Errorf("pinned %s folder ID %q is not accessible: %w", role, id, a.scopeError(err))
+	}
+	if f.MimeType != folderMimeType {
+		return "", fmt.Errorf("pinned %s folder ID %q is not a folder (%s)", role, id, f.MimeType)
+	}
+	if f.Trashed {
+		return "", fmt.Errorf("pinned %s folder ID %q is in the trash", role, id)
+	}
+	if f.DriveId != a.DriveID {
+		return "", fmt.Errorf("pinned %s folder ID %q is not in the configured drive (vault.shared_drive)", role, id)
+	}
+	return f.Id, nil
+}
+
+// findFolderPath walks a slash separated folder path from the root of the user's Drive,
+// or from the root of the shared drive holding the vault.
+//
+// Missing folders are created when the configuration allows it, or when running
+// with the restricted ScopeFile where B3 cannot see folders it did not create.
+func (a *App) findFolderPath(ctx context.Context, path string) (string, error) {
+	root := "root"
+	if a.DriveID != "" {
+		root = a.DriveID
+	}
+	return a.findSubfolder(ctx, root, "", path)
+}
+
+// findSubfolder walks a slash separated folder path from the folder parentID, whose path is parentPath,
+// creating missing folders like findFolderPath.
+func (a *App) findSubfolder(ctx context.Context, parentID, parentPath, path string) (string, error) {
+	create := a.Config.Vault.Create || a.Scope == ScopeFile
+
+	walked := parentPath
+	for _, name := range splitFolderPath(path) {
+		walked += "/" + name
+		query := fmt.Sprintf("name = '%s' and mimeType = '%s' and '%s' in parents and trashed = false", escapeQuery(name), folderMimeType, parentID)
+		fileList, err := a.filesList(ctx).Q(query).PageSize(10).Fields("files(id, modifiedTime)").Do()
+		if err != nil {
+			return "", fmt.Errorf("failed to search for '%s' folder: %w", walked, err)
+		}
+
+		switch len(fileList.Files) {
+		case 1:
+			parentID = fileList.Files[0].Id
+		case 0:
+			if !create {
+				return "", fmt.Errorf("'%s' folder not found in your Google Drive. Please create it, or set 'vault.create: true' in the configuration, and try again", walked)
+			}
+			folder, err := a.filesCreate(ctx, &drive.File{
+				Name:     name,
+				MimeType: folderMimeType,
+				Parents:  []string{parentID},
+			}).Fields("id").Do()
+			if err != nil {
+				return "", fmt.Errorf("failed to create '%s' folder: %w", walked, err)
+			}
+			parentID = folder.Id
+		default:
+			var ids []string
+			for _, f := range fileList.Files {
+				ids = append(ids, fmt.Sprintf("%s (modified %s)", f.Id, f.ModifiedTime))
+			}
+			return "", fmt.Errorf("%d folders match '%s': %s. Rename the extra ones, or pin the right one with a folder ID in the configuration", len(ids), walked, strings.Join(ids, ", "))
+		}
+	}
+	return parentID, nil
+}
+
+// findSharedDrive returns the ID of the shared drive identified by nameOrID.
+func (a *App) findSharedDrive(ctx context.Context, nameOrID string) (string, error) {
+	query := fmt.Sprintf("name = '%s'", escapeQuery(nameOrID))
+	list, err := a.DriveService.Drives.List().Context(ctx).Q(query).PageSize(10).Fields("drives(id, name)").Do()
+	if err != nil {
+		return "", fmt.Errorf("failed to search for shared drive '%s': %w", nameOrID, a.scopeError(err))
+	}
+	switch len(list.Drives) {
+	case 1:
+		return list.Drives[0].Id, nil
+	case 0:
+		// Maybe it's an ID.
+		d, err := a.DriveService.Drives.Get(nameOrID).Context(ctx).Fields("id").Do()
+		if err != nil {
+			return "", fmt.Errorf("shared drive '%s' not found, check its name or ID and that you are a member", nameOrID)
+		}
+		return d.Id, nil
+	default:
+		var ids []string
+		for _, d := range list.Drives {
+			ids = append(ids, d.Id)
+		}
+		return "", fmt.Errorf("%d shared drives are named '%s': %s. Use the shared drive ID instead", len(ids), nameOrID, strings.Join(ids, ", "))
+	}
+}
+
+// splitFolderPath splits a folder path like "Admin/Family/B3" into its folder names.
+func splitFolderPath(path string) []string {
+	var names []string
+	for _, name := range strings.Split(path, "/") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// escapeQuery escapes a string literal to be used in a Drive query.
+func escapeQuery(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/etnz/b3/b3app"
+	"google.golang.org/genai"
+)
+
+// command is a subcommand of the b3 CLI, like "b3 ls".
+type command struct {
+	name  string // Name typed after b3.
+	usage string // Arguments, for the usage message.
+	help  string // One line description.
+	// run executes the command with the arguments following its name.
+	run func(ctx context.Context, env *cmdEnv, args []string) error
+}
+
+// cmdEnv is what commands share: the configuration and the global flags.
+type cmdEnv struct {
+	cfg     *b3app.Config
+	offline bool
+}
+
+// commands are all the subcommands, in the order of the usage message.
+var commands = []*command{
+	{name: "ls", usage: "[-json]", help: "List the documents in B3 and B4 from the local index, online or offline.", run: runLs},
+	{name: "pin", usage: "<file-id>...", help: "Keep encrypted local copies of files so that they can be read offline.", run: runPin},
+	{name: "unpin", usage: "<file-id>...", help: "Delete the local copies of files.", run: runUnpin},
+	{name: "search", usage: "[-n 10] [-json] <query>", help: "Search the documents in B3 and B4 by keywords, ignoring case and accents.", run: runSearch},
+	{name: "index", usage: "[-yes] [-dry-run] [-restart] [-limit n]", help: "Analyze the documents with a missing, stale or poor description, and review the proposed names and descriptions.", run: runIndex},
+	{name: "lint", usage: "[-json] [-fix [-yes]]", help: "Audit the names, descriptions and metadata of the documents, and fix them after review.", run: runLint},
+	{name: "check", usage: "[-json]", help: "Cross-check what the documents say about each person, and report the conflicts.", run: runCheck},
+	{name: "expiring", usage: "[-within 90d] [-json]", help: "List the documents that expire, or must be renewed, within a period.", run: runExpiring},
+	{name: "calendar", usage: "[-o b3.ics] [-upload]", help: "Export the expirations, renewals, notice periods and deadlines as an iCalendar file, to import in any calendar.", run: runCalendar},
+}
+
+// findCommand returns the command called name, or nil.
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// printCommands prints the list of commands for the usage message.
+func printCommands() {
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %s %s\n    \t%s\n", c.name, c.usage, c.help)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+// openApp returns an App synchronized with Google Drive, or, when offline is
+// requested or Drive cannot be reached, an App working from the local index.
+func openApp(ctx context.Context, env *cmdEnv) (*b3app.App, error) {
+	if env.offline {
+		return b3app.NewOffline(env.cfg)
+	}
+	app, err := b3app.New(ctx, env.cfg)
+	if err == nil {
+		printLimitations(app.Scope)
+		_, err = app.Sync(ctx)
+	}
+	if err == nil {
+		return app, nil
+	}
+	// Fall back to the local index, if there is one.
+	offlineApp, offErr := b3app.NewOffline(env.cfg)
+	if offErr != nil {
+		return nil, err
+	}
+	fmt.Fprintf(os.Stderr, "⚠️  Cannot reach Google Drive (%v).\n", err)
+	fmt.Fprintf(os.Stderr, "⚠️  Working offline from the local index, %s.\n", offlineApp.Staleness())
+	return offlineApp, nil
+}
+
+func runLs(ctx context.Context, env *cmdEnv, args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	jsonFlag := fs.Bool("json", false, "Print the index as JSON.")
+	fs.Parse(args)
+
+	app, err := openApp(ctx, env)
+	if err != nil {
+		return err
+	}
+	b3Files, err := app.B3Files(ctx)
+	if err != nil {
+		return err
+	}
+	b4Files, err := app.B4Files(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *jsonFlag {
+		return json.NewEncoder(os.Stdout).Encode(map[string]any{
+			"synced": app.IndexSynced(),
+			"b3":     b3Files,
+			"b4":     b4Files,
+		})
+	}
+
+	pinned, err := b3app.Pinned()
+	if err != nil {
+		return err
+	}
+	isPinned := make(map[string]bool)
+	for _, id := range pinned {
+		isPinned[id] = true
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, f := range append(b3Files, b4Files...) {
+		pin := ""
+		if isPinned[f.ID] {
+			pin = "📌"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", f.Path, f.Modified.Format("2006-01-02"), f.Name, f.ID, pin)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	status := ""
+	if app.Offline {
+		status = " (offline)"
+	}
+	fmt.Fprintf(os.Stderr, "%d files in B3, %d in B4, index %s%s.\n", len(b3Files), len(b4Files), app.Staleness(), status)
+	return nil
+}
+
+func runPin(ctx context.Context, env *cmdEnv, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: b3 pin <file-id>...")
+	}
+	if env.offline {
+		return b3app.ErrOffline
+	}
+	app, err := b3app.New(ctx, env.cfg)
+	if err != nil {
+		return err
+	}
+	for _, id := range args {
+		f, err := app.Pin(ctx, id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("📌 %s (%s) is available offline.\n", f.Name, f.ID)
+	}
+	return nil
+}
+
+func runUnpin(ctx context.Context, env *cmdEnv, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: b3 unpin <file-id>...")
+	}
+	pinned, err := b3app.Pinned()
+	if err != nil {
+		return err
+	}
+	for _, id := range args {
+		if i := sort.SearchStrings(pinned, id); i == len(pinned) || pinned[i] != id {
+			return fmt.Errorf("file %s has no local copy, pinned files are: %s", id, strings.Join(pinned, ", "))
+		}
+		if err := b3app.Unpin(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runSearch(ctx context.Context, env *cmdEnv, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	limit := fs.Int("n", 10, "Maximum number of results.")
+	jsonFlag := fs.Bool("json", false, "Print the results as JSON.")
+	fs.Parse(args)
+	query := strings.Join(fs.Args(), " ")
+	if query == "" {
+		return fmt.Errorf("usage: b3 search [-n 10] [-json] <query>")
+	}
+
+	app, err := openApp(ctx, env)
+	if err != nil {
+		return err
+	}
+	results, err := app.Search(ctx, query, *limit)
+	if err != nil {
+		return err
+	}
+
+	if *jsonFlag {
+		return json.NewEncoder(os.Stdout).Encode(results)
+	}
+	for _, r := range results {
+		fmt.Printf("%s/%s  (%s)\n    %s\n", r.File.Path, r.File.Name, r.File.ID, r.Snippet)
+	}
+	fmt.Fprintf(os.Stderr, "%d matches, index %s.\n", len(results), app.Staleness())
+	return nil
+}
+
+func runIndex(ctx context.Context, env *cmdEnv, args []string) error {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	yes := fs.Bool("yes", false, "Apply all the proposals without review.")
+	dryRun := fs.Bool("dry-run", false, "Show the proposals, but do not apply any.")
+	restart := fs.Bool("restart", false, "Discard the previous run instead of resuming it.")
+	limit := fs.Int("limit", 0, "Analyze at most this number of documents.")
+	fs.Parse(args)
+
+	if env.offline {
+		return b3app.ErrOffline
+	}
+	app, err := b3app.New(ctx, env.cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := app.Sync(ctx); err != nil {
+		return err
+	}
+
+	run, err := b3app.LoadIndexRun()
+	if err != nil {
+		return err
+	}
+	if run != nil && !*restart {
+		fmt.Fprintf(os.Stderr, "Resuming the run started on %s: %d analyzed, %d to analyze, %d reviewed.\n",
+			run.Started.Format("2006-01-02 15:04"), run.Count(b3app.ProposalAnalyzed), run.Count(b3app.ProposalPending)+run.Count(b3app.ProposalFailed),
+			run.Count(b3app.ProposalApplied)+run.Count(b3app.ProposalRejected))
+	} else {
+		run = app.NewIndexRun(*limit)
+		if err := run.Save(); err != nil {
+			return err
+		}
+	}
+	if len(run.Proposals) == 0 {
+		fmt.Println("All documents are well described.")
+		return run.Remove()
+	}
+
+	return analyzeAndReview(ctx, app, run, *yes, *dryRun)
+}
+
+func runLint(ctx context.Context, env *cmdEnv, args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	jsonFlag := fs.Bool("json", false, "Print the findings as JSON.")
+	fix := fs.Bool("fix", false, "Analyze the files with fixable findings, and review the proposed names, descriptions and metadata.")
+	yes := fs.Bool("yes", false, "With -fix, apply all the proposals without review.")
+	fs.Parse(args)
+
+	app, err := openApp(ctx, env)
+	if err != nil {
+		return err
+	}
+	findings := app.Lint(time.Now())
+
+	counts := make(map[b3app.Severity]int)
+	fixable := 0
+	for _, f := range findings {
+		counts[f.Severity]++
+		if f.Fixable {
+			fixable++
+		}
+	}
+	if *jsonFlag {
+		if err := json.NewEncoder(os.Stdout).Encode(findings); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, f := range findings {
+			fmt.Fprintf(w, "%s\t%s/%s\t%s\t%s\n", f.Severity, f.File.Path, f.File.Name, f.Rule, f.Message)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%d errors, %d warnings, %d infos, %d fixable, index %s.\n",
+			counts[b3app.SeverityError], counts[b3app.SeverityWarning], counts[b3app.SeverityInfo], fixable, app.Staleness())
+	}
+
+	if !*fix {
+		if counts[b3app.SeverityError] > 0 {
+			return fmt.Errorf("found %d errors, run 'b3 lint -fix' to fix them", counts[b3app.SeverityError])
+		}
+		return nil
+	}
+	if app.Offline {
+		return b3app.ErrOffline
+	}
+	// The fixes are an index run: it must not replace one in progress.
+	if previous, err := b3app.LoadIndexRun(); err != nil {
+		return err
+	} else if previous != nil {
+		return fmt.Errorf("an analysis started on %s is in progress: finish it with 'b3 index', or discard it with 'b3 index -restart'", previous.Started.Format("2006-01-02 15:04"))
+	}
+	run := b3app.NewFixRun(findings)
+	if len(run.Proposals) == 0 {
+		fmt.Println("Nothing to fix.")
+		return nil
+	}
+	if err := run.Save(); err != nil {
+		return err
+	}
+	return analyzeAndReview(ctx, app, run, *yes, false)
+}
+
+func runCheck(ctx context.Context, env *cmdEnv, args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	jsonFlag := fs.Bool("json", false, "Print the conflicts as JSON.")
+	fs.Parse(args)
+
+	app, err := openApp(ctx, env)
+	if err != nil {
+		return err
+	}
+	conflicts := app.CheckConsistency(time.Now())
+
+	counts := make(map[b3app.Severity]int)
+	for _, c := range conflicts {
+		counts[c.Severity]++
+	}
+	if *jsonFlag {
+		if err := json.NewEncoder(os.Stdout).Encode(conflicts); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, c := range conflicts {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Severity, c.Entity, c.Kind, c.Message)
+			for _, f := range c.Facts {
+				fmt.Fprintf(w, "\t\t\t  %s: %s\n", f.File, f.Value)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%d errors, %d warnings, %d infos, index %s.\n",
+			counts[b3app.SeverityError], counts[b3app.SeverityWarning], counts[b3app.SeverityInfo], app.Staleness())
+	}
+	if counts[b3app.SeverityError] > 0 {
+		return fmt.Errorf("found %d conflicts between documents", counts[b3app.SeverityError])
+	}
+	return nil
+}
+
+func runExpiring(ctx context.Context, env *cmdEnv, args []string) error {
+	fs := flag.NewFlagSet("expiring", flag.ExitOnError)
+	within := fs.String("within", env.cfg.Expiry.Within, "The period to look ahead, like 90d, 6m or 1y, expiry.within of the configuration by default.")
+	jsonFlag := fs.Bool("json", false, "Print the documents as JSON.")
+	fs.Parse(args)
+
+	period, err := b3app.ParsePeriod(*within)
+	if err != nil {
+		return fmt.Errorf("invalid -within: %w", err)
+	}
+	app, err := openApp(ctx, env)
+	if err != nil {
+		return err
+	}
+	expiring := app.Expiring(time.Now(), period)
+
+	if *jsonFlag {
+		return json.NewEncoder(os.Stdout).Encode(expiring)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, e := range expiring {
+		source := ""
+		if e.FromDescription {
+			source = " (from the description)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s/%s\t%s%s\n", e.Status, e.Deadline(), e.File.Path, e.File.Name, e.Summary(), source)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d documents to renew within %s, index %s.\n", len(expiring), *within, app.Staleness())
+	return nil
+}
+
+func runCalendar(ctx context.Context, env *cmdEnv, args []string) error {
+	fs := flag.NewFlagSet("calendar", flag.ExitOnError)
+	out := fs.String("o", "b3.ics", "The file to write, or '-' for the standard output, or '' for none.")
+	upload := fs.Bool("upload", false, "Upload the calendar to B4, replacing the previous upload.")
+	fs.Parse(args)
+
+	app, err := openApp(ctx, env)
+	if err != nil {
+		return err
+	}
+	events := app.CalendarEvents(time.Now())
+	var buf bytes.Buffer
+	if err := b3app.WriteICS(&buf, events, time.Now()); err != nil {
+		return err
+	}
+
+	switch *out {
+	case "":
+	case "-":
+		if _, err := os.Stdout.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	default:
+		if err := os.WriteFile(*out, buf.Bytes(), 0600); err != nil {
+			return fmt.Errorf("failed to write the calendar: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "%d events written to %s.\n", len(events), *out)
+	}
+	if *upload {
+		f, err := app.UploadCalendar(ctx, buf.Bytes())
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%d events uploaded to B4/%s (ID %s).\n", len(events), f.Name, f.ID)
+	}
+	return nil
+}
+
+// analyzeAndReview analyzes the proposals of the run, and lets the user review them, unless yes or dryRun is set.
+// The run is removed once every proposal is reviewed, or saved to be resumed by 'b3 index'.
+func analyzeAndReview(ctx context.Context, app *b3app.App, run *b3app.IndexRun, yes, dryRun bool) error {
+	// Interrupting the analysis keeps what is done, for the next run.
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	client, err := genai.NewClient(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create genai client: %w", err)
+	}
+	todo := run.Count(b3app.ProposalPending) + run.Count(b3app.ProposalFailed)
+	done := 0
+	err = app.Analyze(ctx, client, run, func(p *b3app.IndexProposal) {
+		done++
+		status := "✓"
+		switch p.Status {
+		case b3app.ProposalFailed:
+			status = "✗ " + p.Error
+		case b3app.ProposalTooLong:
+			status = "– " + p.Error
+		}
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s/%s %s\n", done, todo, p.File.Path, p.File.Name, status)
+	})
+	if errors.Is(err, context.Canceled) {
+		return fmt.Errorf("interrupted, run 'b3 index' again to resume")
+	}
+	if err != nil {
+		return err
+	}
+	stop()
+
+	in := bufio.NewReader(os.Stdin)
+	applyAll := yes
+review:
+	for _, p := range run.Proposals {
+		if p.Status != b3app.ProposalAnalyzed {
+			continue
+		}
+		printProposal(p)
+		if dryRun {
+			continue
+		}
+		// Unrecognized answers are asked again: a typo must not reject the proposal.
+		for !applyAll {
+			fmt.Print("Apply? [y]es, [n]o, [s]kip for now, [a]ll, [q]uit: ")
+			answer, err := in.ReadString('\n')
+			if err != nil && answer == "" {
+				fmt.Println()
+				break review // The input is over.
+			}
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "y", "yes":
+			case "a", "all":
+				applyAll = true
+			case "s", "skip", "":
+				continue review
+			case "q", "quit":
+				break review
+			case "n", "no":
+				if err := run.Reject(p); err != nil {
+					return err
+				}
+				continue review
+			default:
+				fmt.Println("Please answer y, n, s, a or q.")
+				continue
+			}
+			break
+		}
+		// Invalid identifiers are only written when the user read the warnings and answered yes.
+		if err := app.Apply(ctx, run, p, !applyAll); errors.Is(err, b3app.ErrInvalidIdentifiers) {
+			fmt.Fprintf(os.Stderr, "⚠️  %v, left to review.\n", err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		fmt.Printf("✓ %s updated.\n", p.Name)
+	}
+
+	failed := run.Count(b3app.ProposalFailed)
+	left := run.Count(b3app.ProposalAnalyzed)
+	fmt.Fprintf(os.Stderr, "%d applied, %d rejected, %d failed, %d left to review.\n", run.Count(b3app.ProposalApplied), run.Count(b3app.ProposalRejected), failed, left)
+	if n := run.Count(b3app.ProposalTooLong); n > 0 {
+		fmt.Fprintf(os.Stderr, "%d documents are too long to be read at once, and are not proposed again: ask b3 to read them section by section.\n", n)
+	}
+	if left > 0 {
+		fmt.Fprintln(os.Stderr, "Run 'b3 index' again to review the rest.")
+		return nil
+	}
+	// The run is kept to retry the failed analyses. Rejections are kept apart, for all the runs to come.
+	if failed > 0 {
+		fmt.Fprintln(os.Stderr, "Run 'b3 index' again to retry the failed analyses.")
+		return nil
+	}
+	return run.Remove()
+}
+
+// printProposal prints the changes proposed for a file, as a diff.
+func printProposal(p *b3app.IndexProposal) {
+	fmt.Printf("\n%s/%s (%s)\n", p.File.Path, p.File.Name, strings.Join(p.Reasons, ", "))
+	if p.Name != p.File.Name {
+		fmt.Printf("  name:\n  - %s\n  + %s\n", p.File.Name, p.Name)
+	}
+	fmt.Println("  description:")
+	for _, l := range strings.Split(strings.TrimSpace(p.File.Description), "\n") {
+		if l != "" {
+			fmt.Printf("  - %s\n", l)
+		}
+	}
+	desc := p.Analysis.Description + "\n\n" + p.Analysis.Metadata.String()
+	for _, l := range strings.Split(desc, "\n") {
+		fmt.Printf("  + %s\n", l)
+	}
+	for _, w := range p.Analysis.Warnings {
+		fmt.Printf("  ⚠️  %s\n", w)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"time"
 
 	"github.com/etnz/b3/b3app"
 )
@@ -15,13 +16,20 @@ import (
 func main() {
 	verboseFlag := flag.Bool("v", false, "Print logs")
 	loginFlag := flag.Bool("login", false, "Authorize the B3 CLI to access your Google Drive.")
+	scopeFlag := flag.String("scope", "", "With -login, the Drive access to grant: 'full' for the whole Drive, or 'file' for only the files B3 creates or is given. Defaults to the configured auth.scope.")
+	configFlag := flag.String("config", "", "Path to the configuration file (default $B3_CONFIG or ~/.config/b3/config.yaml).")
+	modelFlag := flag.String("model", "", "Override the model used by the B3 expert.")
+	languageFlag := flag.String("language", "", "Override the language B3 uses to answer and write descriptions.")
 	listFlag := flag.Bool("list", false, "List files in your B3 Google Drive folder as JSON.")
+	offlineFlag := flag.Bool("offline", false, "Work from the local index without accessing Google Drive: read-only, and only pinned files can be read.")
 
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "B3: The Bureaucratic Barriers Buster\n\n")
 		fmt.Fprintf(os.Stderr, "B3 is a chat-first intelligent agent for your documents.\n")
 		fmt.Fprintf(os.Stderr, "Run without flags to start a conversational session.\n\n")
-		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [command [args] | message...]\n\n", os.Args[0])
+		printCommands()
+		fmt.Fprintf(os.Stderr, "Flags:\n")
 		flag.PrintDefaults()
 	}
 
@@ -32,24 +40,58 @@ func main() {
 		log.SetOutput(io.Discard)
 	}
 
+	cfg, err := b3app.LoadConfig(*configFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// Command line flags take precedence over the configuration file and environment.
+	if *modelFlag != "" {
+		cfg.SetModel(b3app.ExpertB3, *modelFlag)
+	}
+	if *languageFlag != "" {
+		cfg.Language = *languageFlag
+	}
+
 	// Handle -login flag
 	if *loginFlag {
-		err := b3app.Login()
+		if *scopeFlag == "" {
+			*scopeFlag = cfg.Auth.Scope
+		}
+		scope, err := b3app.ParseScopeMode(*scopeFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		err = b3app.Login(cfg, scope)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Authentication failed: %v\n", err)
 			os.Exit(1)
 		}
 		fmt.Println("✅ Successfully logged in. B3 is now authorized to access your Google Drive.")
+		printLimitations(scope)
+		return
+	}
+
+	env := &cmdEnv{cfg: cfg, offline: *offlineFlag}
+
+	// Handle subcommands
+	if cmd := findCommand(flag.Arg(0)); cmd != nil {
+		if err := cmd.run(ctx, env, flag.Args()[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 		return
 	}
 
 	// Handle -list flag
 	if *listFlag {
-		app, err := b3app.New(ctx)
+		app, err := b3app.New(ctx, cfg)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+		printLimitations(app.Scope)
 
 		files, err := app.B3Files(ctx)
 		if err != nil {
@@ -65,31 +107,40 @@ func main() {
 	}
 
 	// Default action: Start the conversational agent
-	app, err := b3app.New(ctx)
+	fmt.Fprintln(os.Stderr, "B3 is getting ready, synchronizing B3 and B4 folders...")
+	app, err := openApp(ctx, env)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error initializing B3: %v\n", err)
 		os.Exit(1)
 	}
-
-	fmt.Fprintln(os.Stderr, "B3 is getting ready, scanning B3 and B4 folders...")
-	b3Files, err := app.B3Files(ctx)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error listing B3 files: %v\n", err)
-		os.Exit(1)
+	if !app.SessionChanges.Empty() {
+		fmt.Fprintf(os.Stderr, "Since your last session: %s.\n", app.SessionChanges)
 	}
-	b4Files, err := app.B4Files(ctx)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error listing B4 files: %v\n", err)
-		os.Exit(1)
+	if within, err := b3app.ParsePeriod(app.Config.Expiry.Within); err == nil {
+		if n := len(app.Expiring(time.Now(), within)); n > 0 {
+			fmt.Fprintf(os.Stderr, "%d documents to renew within %s, see 'b3 expiring'.\n", n, app.Config.Expiry.Within)
+		}
 	}
 
 	args := flag.Args()
 
 	// Create the B3 expert, passing the application context and the content expert.
-	b3Expert := b3app.NewB3Expert(app, b3Files, b4Files)
+	b3Expert := b3app.NewB3Expert(app)
 	agent := b3app.NewAgent(b3Expert, os.Stdout, os.Stdin)
 	if err := agent.Run(ctx, args...); err != nil {
 		fmt.Fprintf(os.Stderr, "\nAn error occurred: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+// printLimitations warns the user about operations unavailable with the granted scope.
+func printLimitations(scope b3app.ScopeMode) {
+	limitations := scope.Limitations()
+	if len(limitations) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "⚠️  B3 is running with the restricted %q Drive scope:\n", scope)
+	for _, l := range limitations {
+		fmt.Fprintf(os.Stderr, "  - %s\n", l)
+	}
+}
@@ -0,0 +1,48 @@
+package validate
+
+import "fmt"
+
+// ibanLengths is the length of the IBANs of each country, from the IBAN registry.
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16, "BG": 22, "BH": 22, "BR": 29,
+	"BY": 28, "CH": 21, "CR": 22, "CY": 28, "CZ": 24, "DE": 22, "DK": 18, "DO": 28, "EE": 20, "EG": 29,
+	"ES": 24, "FI": 18, "FO": 18, "FR": 27, "GB": 22, "GE": 22, "GI": 23, "GL": 18, "GR": 27, "GT": 28,
+	"HR": 21, "HU": 28, "IE": 22, "IL": 23, "IQ": 23, "IS": 26, "IT": 27, "JO": 30, "KW": 30, "KZ": 20,
+	"LB": 28, "LC": 32, "LI": 21, "LT": 20, "LU": 20, "LV": 21, "MC": 27, "MD": 24, "ME": 22, "MK": 19,
+	"MR": 27, "MT": 31, "MU": 30, "NL": 18, "NO": 15, "PK": 24, "PL": 28, "PS": 29, "PT": 25, "QA": 29,
+	"RO": 24, "RS": 22, "SA": 24, "SC": 31, "SE": 24, "SI": 19, "SK": 24, "SM": 27, "ST": 25, "SV": 28,
+	"TL": 23, "TN": 24, "TR": 26, "UA": 29, "VA": 22, "VG": 24, "XK": 20,
+}
+
+// IBAN checks an International Bank Account Number: its length for its country, and its ISO 7064 MOD 97-10 checksum.
+func IBAN(value string) error {
+	s := compact(value)
+	if len(s) < 15 || len(s) > 34 {
+		return fmt.Errorf("an IBAN has 15 to 34 characters, not %d", len(s))
+	}
+	country := s[:2]
+	if !isLetter(country[0]) || !isLetter(country[1]) || !digits(s[2:4]) {
+		return fmt.Errorf("an IBAN starts with a country code and two check digits")
+	}
+	if n, ok := ibanLengths[country]; ok && len(s) != n {
+		return fmt.Errorf("an IBAN of %s has %d characters, not %d", country, n, len(s))
+	}
+	// The check is on the IBAN with its first 4 characters moved to the end, and letters as numbers from 10 to 35.
+	rem := 0
+	for _, c := range s[4:] + s[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			rem = (rem*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			rem = (rem*100 + int(c-'A') + 10) % 97
+		default:
+			return fmt.Errorf("invalid character %q in an IBAN", c)
+		}
+	}
+	if rem != 1 {
+		return fmt.Errorf("wrong check digits")
+	}
+	return nil
+}
+
+func isLetter(c byte) bool { return c >= 'A' && c <= 'Z' }
@@ -0,0 +1,33 @@
+package validate
+
+import "testing"
+
+func TestIBAN(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		// Examples of the IBAN registry.
+		{"FR7630006000011234567890189", true},
+		{"DE89370400440532013000", true},
+		{"GB29NWBK60161331926819", true},
+		{"GB29 NWBK 6016 1331 9268 19", true},
+		{"gb29nwbk60161331926819", true},
+		{"NL91ABNA0417164300", true},
+		{"BE68539007547034", true},
+		{"CH9300762011623852957", true},
+		{"NO9386011117947", true},
+		{"GB29NWBK60161331926818", false}, // Wrong check digits.
+		{"GB92NWBK60161331926819", false},
+		{"FR763000600001123456789018", false}, // One character short for France.
+		{"DE89370400440532013000X", false},
+		{"1289370400440532013000", false},
+		{"DE89-3704-0044-0532-0130-0!", false},
+		{"DE89", false},
+	}
+	for _, tt := range tests {
+		if err := IBAN(tt.value); (err == nil) != tt.valid {
+			t.Errorf("IBAN(%q) = %v, want valid %v", tt.value, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package validate
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MRZ is the machine-readable zone of a travel document, as defined by ICAO 9303.
+type MRZ struct {
+	Format         string // "TD1" (ID cards, 3 lines of 30), "TD2" (2 lines of 36) or "TD3" (passports, 2 lines of 44).
+	DocumentCode   string // Like "P" for a passport, "ID" or "I" for an ID card.
+	IssuingState   string // ISO 3166-1 alpha-3 code, like "FRA", or "D" for Germany.
+	Surname        string
+	GivenNames     string
+	DocumentNumber string
+	Nationality    string
+	BirthDate      string // YYYY-MM-DD.
+	Sex            string // "M", "F" or "" when unspecified.
+	ExpiryDate     string // YYYY-MM-DD.
+}
+
+// mrzLines splits a machine-readable zone into its lines, without spaces, whether they are separated
+// by new lines or written as a single line.
+func mrzLines(value string) []string {
+	var lines []string
+	for _, l := range strings.Split(strings.ToUpper(value), "\n") {
+		if l = strings.Join(strings.Fields(l), ""); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	if len(lines) == 1 {
+		l := lines[0]
+		switch len(l) {
+		case 90:
+			return []string{l[:30], l[30:60], l[60:]}
+		case 72:
+			return []string{l[:36], l[36:]}
+		case 88:
+			return []string{l[:44], l[44:]}
+		}
+	}
+	return lines
+}
+
+// checkDigit computes the ICAO 9303 check digit of s: digits count as themselves, letters from 10 to 35,
+// fillers '<' as 0, with the weights 7, 3, 1 repeated.
+func checkDigit(s string) (byte, error) {
+	weights := [3]int{7, 3, 1}
+	sum := 0
+	for i := 0; i < len(s); i++ {
+		var v int
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+			v = int(c - '0')
+		case c >= 'A' && c <= 'Z':
+			v = int(c-'A') + 10
+		case c == '<':
+			v = 0
+		default:
+			return 0, fmt.Errorf("invalid character %q in a machine-readable zone", c)
+		}
+		sum += v * weights[i%3]
+	}
+	return byte('0' + sum%10), nil
+}
+
+// verify checks the check digit of a field, named what in the error.
+func verify(what, field string, digit byte) error {
+	want, err := checkDigit(field)
+	if err != nil {
+		return err
+	}
+	// An optional field left empty may have a filler as its check digit.
+	if digit == '<' && strings.Trim(field, "<") == "" {
+		return nil
+	}
+	if digit != want {
+		return fmt.Errorf("wrong check digit for the %s: %c instead of %c", what, digit, want)
+	}
+	return nil
+}
+
+// mrzDate converts a YYMMDD date of a machine-readable zone. Birth dates are in the past,
+// and expiry dates are assumed within 50 years from now.
+func mrzDate(yymmdd string, birth bool) (string, error) {
+	t, err := time.Parse("060102", yymmdd)
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q in a machine-readable zone", yymmdd)
+	}
+	// time.Parse puts 69-99 in the 1900s, and 00-68 in the 2000s.
+	now := time.Now()
+	year := now.Year()/100*100 + t.Year()%100
+	if birth && year > now.Year() {
+		year -= 100
+	}
+	if !birth && year > now.Year()+50 {
+		year -= 100
+	}
+	return fmt.Sprintf("%04d-%s", year, t.Format("01-02")), nil
+}
+
+// mrzNames splits the name field of a machine-readable zone, like "CURIE<<MARIE<SALOMEA".
+func mrzNames(field string) (surname, given string) {
+	surname, given, _ = strings.Cut(strings.TrimRight(field, "<"), "<<")
+	clean := func(s string) string {
+		return strings.Join(strings.FieldsFunc(s, func(r rune) bool { return r == '<' }), " ")
+	}
+	return clean(surname), clean(given)
+}
+
+// ParseMRZ parses the machine-readable zone of a passport, an ID card or a visa, and checks all its check digits.
+//
+// Formats outside ICAO 9303, like the French ID cards issued before 2021, return ErrUnsupported.
+func ParseMRZ(value string) (*MRZ, error) {
+	lines := mrzLines(value)
+	m := &MRZ{}
+	var birth, expiry string
+	switch {
+	case len(lines) == 3 && len(lines[0]) == 30 && len(lines[1]) == 30 && len(lines[2]) == 30:
+		l1, l2, l3 := lines[0], lines[1], lines[2]
+		m.Format = "TD1"
+		m.DocumentCode, m.IssuingState = strings.TrimRight(l1[:2], "<"), strings.TrimRight(l1[2:5], "<")
+		number, digit := l1[5:14], l1[14]
+		if digit == '<' {
+			// Long document numbers continue in the optional data, with their check digit last.
+			rest, _, _ := strings.Cut(l1[15:], "<")
+			if rest == "" {
+				return nil, fmt.Errorf("missing check digit for the document number")
+			}
+			number, digit = number+rest[:len(rest)-1], rest[len(rest)-1]
+		}
+		if err := verify("document number", number, digit); err != nil {
+			return nil, err
+		}
+		m.DocumentNumber = strings.TrimRight(number, "<")
+		birth, expiry = l2[0:6], l2[8:14]
+		if err := verify("birth date", birth, l2[6]); err != nil {
+			return nil, err
+		}
+		if err := verify("expiry date", expiry, l2[14]); err != nil {
+			return nil, err
+		}
+		if err := verify("whole zone", l1[5:30]+l2[0:7]+l2[8:15]+l2[18:29], l2[29]); err != nil {
+			return nil, err
+		}
+		m.Sex, m.Nationality = strings.Trim(l2[7:8], "<X"), strings.TrimRight(l2[15:18], "<")
+		m.Surname, m.GivenNames = mrzNames(l3)
+
+	case len(lines) == 2 && (len(lines[0]) == 36 && len(lines[1]) == 36 || len(lines[0]) == 44 && len(lines[1]) == 44):
+		l1, l2 := lines[0], lines[1]
+		n := len(l1)
+		if n == 36 && strings.HasPrefix(l1, "IDFRA") {
+			// French ID cards issued before 2021 have their own layout.
+			return nil, ErrUnsupported
+		}
+		m.Format = "TD2"
+		if n == 44 {
+			m.Format = "TD3"
+		}
+		m.DocumentCode, m.IssuingState = strings.TrimRight(l1[:2], "<"), strings.TrimRight(l1[2:5], "<")
+		m.Surname, m.GivenNames = mrzNames(l1[5:])
+		if err := verify("document number", l2[0:9], l2[9]); err != nil {
+			return nil, err
+		}
+		m.DocumentNumber = strings.TrimRight(l2[0:9], "<")
+		birth, expiry = l2[13:19], l2[21:27]
+		if err := verify("birth date", birth, l2[19]); err != nil {
+			return nil, err
+		}
+		if err := verify("expiry date", expiry, l2[27]); err != nil {
+			return nil, err
+		}
+		if n == 44 {
+			if err := verify("personal number", l2[28:42], l2[42]); err != nil {
+				return nil, err
+			}
+		}
+		if err := verify("whole zone", l2[0:10]+l2[13:20]+l2[21:n-1], l2[n-1]); err != nil {
+			return nil, err
+		}
+		m.Sex, m.Nationality = strings.Trim(l2[20:21], "<X"), strings.TrimRight(l2[10:13], "<")
+
+	default:
+		sizes := make([]string, len(lines))
+		for i, l := range lines {
+			sizes[i] = fmt.Sprint(len(l))
+		}
+		return nil, fmt.Errorf("a machine-readable zone has 3 lines of 30 characters, or 2 lines of 36 or 44, not %s", strings.Join(sizes, ", "))
+	}
+
+	var err error
+	if m.BirthDate, err = mrzDate(birth, true); err != nil {
+		return nil, err
+	}
+	if m.ExpiryDate, err = mrzDate(expiry, false); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
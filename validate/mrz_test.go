@@ -0,0 +1,98 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseMRZ(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  *MRZ
+	}{
+		{
+			name:  "TD3 specimen",
+			value: "P<UTOERIKSSON<<ANNA<MARIA<<<<<<<<<<<<<<<<<<<\nL898902C36UTO7408122F1204159ZE184226B<<<<<10",
+			want: &MRZ{Format: "TD3", DocumentCode: "P", IssuingState: "UTO", Surname: "ERIKSSON", GivenNames: "ANNA MARIA",
+				DocumentNumber: "L898902C3", Nationality: "UTO", BirthDate: "1974-08-12", Sex: "F", ExpiryDate: "2012-04-15"},
+		},
+		{
+			name:  "TD3 on a single line with spaces",
+			value: "P<UTOERIKSSON<<ANNA<MARIA<<<<<<<<<<<<<<<<<<< L898902C36UTO7408122F1204159ZE184226B<<<<<10",
+			want: &MRZ{Format: "TD3", DocumentCode: "P", IssuingState: "UTO", Surname: "ERIKSSON", GivenNames: "ANNA MARIA",
+				DocumentNumber: "L898902C3", Nationality: "UTO", BirthDate: "1974-08-12", Sex: "F", ExpiryDate: "2012-04-15"},
+		},
+		{
+			name:  "TD2 specimen",
+			value: "I<UTOERIKSSON<<ANNA<MARIA<<<<<<<<<<<\nD231458907UTO7408122F1204159<<<<<<<6",
+			want: &MRZ{Format: "TD2", DocumentCode: "I", IssuingState: "UTO", Surname: "ERIKSSON", GivenNames: "ANNA MARIA",
+				DocumentNumber: "D23145890", Nationality: "UTO", BirthDate: "1974-08-12", Sex: "F", ExpiryDate: "2012-04-15"},
+		},
+		{
+			name:  "TD1 specimen",
+			value: "I<UTOD231458907<<<<<<<<<<<<<<<\n7408122F1204159UTO<<<<<<<<<<<6\nERIKSSON<<ANNA<MARIA<<<<<<<<<<",
+			want: &MRZ{Format: "TD1", DocumentCode: "I", IssuingState: "UTO", Surname: "ERIKSSON", GivenNames: "ANNA MARIA",
+				DocumentNumber: "D23145890", Nationality: "UTO", BirthDate: "1974-08-12", Sex: "F", ExpiryDate: "2012-04-15"},
+		},
+		{
+			name:  "TD1 with a long document number",
+			value: "I<UTOD23145890<7349<<<<<<<<<<<\n3407127M9507122UTO<<<<<<<<<<<2\nSTEVENSON<<PETER<JOHN<<<<<<<<<",
+			want: &MRZ{Format: "TD1", DocumentCode: "I", IssuingState: "UTO", Surname: "STEVENSON", GivenNames: "PETER JOHN",
+				DocumentNumber: "D23145890734", Nationality: "UTO", BirthDate: "1934-07-12", Sex: "M", ExpiryDate: "1995-07-12"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMRZ(tt.value)
+			if err != nil {
+				t.Fatalf("ParseMRZ() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMRZ() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMRZErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"wrong document number digit", "P<UTOERIKSSON<<ANNA<MARIA<<<<<<<<<<<<<<<<<<<\nL898902C37UTO7408122F1204159ZE184226B<<<<<10"},
+		{"wrong birth date digit", "P<UTOERIKSSON<<ANNA<MARIA<<<<<<<<<<<<<<<<<<<\nL898902C36UTO7408123F1204159ZE184226B<<<<<10"},
+		{"wrong composite digit", "P<UTOERIKSSON<<ANNA<MARIA<<<<<<<<<<<<<<<<<<<\nL898902C36UTO7408122F1204159ZE184226B<<<<<11"},
+		{"misread character", "I<UTOD231458907<<<<<<<<<<<<<<<\n7408122F1204159UTO<<<<<<<<<<<6\nERIKSSON<<ANNA<MARIA<<<<<<<<<<"[:31] + "8408122F1204159UTO<<<<<<<<<<<6\nERIKSSON<<ANNA<MARIA<<<<<<<<<<"},
+		{"long number without its digit", "I<UTOD23145890<<<<<<<<<<<<<<<<\n3407127M9507122UTO<<<<<<<<<<<2\nSTEVENSON<<PETER<JOHN<<<<<<<<<"},
+		{"wrong line length", "P<UTOERIKSSON<<ANNA\nL898902C36UTO7408122F1204159ZE184226B<<<<<10"},
+		{"invalid character", "P<UTOERIKSSON<<ANNA<MARIA<<<<<<<<<<<<<<<<<<<\nL898902C36UTO7408122F1204159ZE184226B<<<<!10"},
+	}
+	for _, tt := range tests {
+		if _, err := ParseMRZ(tt.value); err == nil {
+			t.Errorf("%s: ParseMRZ() = nil error, want one", tt.name)
+		}
+	}
+	if _, err := ParseMRZ("IDFRADOUEL<<<<<<<<<<<<<<<<<<<<932013\n0506932020438CHRISTIANE<<NI2906209F3"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("ParseMRZ(French ID card) = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestCheckDigit(t *testing.T) {
+	tests := []struct {
+		field string
+		want  byte
+	}{
+		{"L898902C3", '6'},
+		{"740812", '2'},
+		{"120415", '9'},
+		{"D23145890734", '9'},
+		{"<<<<<<<<<", '0'},
+	}
+	for _, tt := range tests {
+		if got, err := checkDigit(tt.field); err != nil || got != tt.want {
+			t.Errorf("checkDigit(%q) = %c, %v, want %c", tt.field, got, err, tt.want)
+		}
+	}
+}
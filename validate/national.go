@@ -0,0 +1,110 @@
+package validate
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// NIR checks a French social security number (numéro d'inscription au répertoire): 13 digits and a 2-digit key.
+// Born in Corsica, the department is "2A" or "2B".
+func NIR(value string) error {
+	s := compact(value)
+	if len(s) != 15 {
+		return fmt.Errorf("a NIR has 15 characters, not %d", len(s))
+	}
+	number := s[:13]
+	// For the key, Corsica departments 2A and 2B count as 19 and 18.
+	switch number[5:7] {
+	case "2A":
+		number = number[:5] + "19" + number[7:]
+	case "2B":
+		number = number[:5] + "18" + number[7:]
+	}
+	if !digits(number) || !digits(s[13:]) {
+		return fmt.Errorf("a NIR has only digits, but for a Corsica department")
+	}
+	if s[0] != '1' && s[0] != '2' && s[0] != '3' && s[0] != '4' && s[0] != '7' && s[0] != '8' {
+		return fmt.Errorf("a NIR starts with 1 or 2, not %c", s[0])
+	}
+	n, _ := strconv.ParseUint(number, 10, 64)
+	key, _ := strconv.Atoi(s[13:])
+	if want := 97 - int(n%97); key != want {
+		return fmt.Errorf("wrong key %02d", key)
+	}
+	return nil
+}
+
+// dniLetters are the check letters of Spanish DNI and NIE numbers, by number modulo 23.
+const dniLetters = "TRWAGMYFPDXBNJZSQVHLCKE"
+
+// DNI checks a Spanish national identity number: 8 digits and a check letter.
+func DNI(value string) error {
+	s := compact(value)
+	if len(s) != 9 || !digits(s[:8]) {
+		return fmt.Errorf("a DNI has 8 digits and a letter")
+	}
+	n, _ := strconv.Atoi(s[:8])
+	if want := dniLetters[n%23]; s[8] != want {
+		return fmt.Errorf("wrong check letter %c", s[8])
+	}
+	return nil
+}
+
+// NIE checks a Spanish foreigner identity number: X, Y or Z, 7 digits and a check letter.
+func NIE(value string) error {
+	s := compact(value)
+	if len(s) != 9 {
+		return fmt.Errorf("a NIE has 9 characters, not %d", len(s))
+	}
+	prefix := map[byte]byte{'X': '0', 'Y': '1', 'Z': '2'}
+	d, ok := prefix[s[0]]
+	if !ok {
+		return fmt.Errorf("a NIE starts with X, Y or Z")
+	}
+	return DNI(string(d) + s[1:])
+}
+
+// SteuerID checks a German tax identification number (steuerliche Identifikationsnummer):
+// 11 digits, with an ISO 7064 MOD 11,10 check digit.
+func SteuerID(value string) error {
+	s := compact(value)
+	if len(s) != 11 || !digits(s) {
+		return fmt.Errorf("a German tax ID has 11 digits")
+	}
+	if s[0] == '0' {
+		return fmt.Errorf("a German tax ID does not start with 0")
+	}
+	// In the first 10 digits, exactly one digit is repeated, twice or three times.
+	var counts [10]int
+	for i := 0; i < 10; i++ {
+		counts[s[i]-'0']++
+	}
+	repeated := 0
+	for _, c := range counts {
+		if c > 3 {
+			return fmt.Errorf("a digit is repeated %d times", c)
+		}
+		if c > 1 {
+			repeated++
+		}
+	}
+	if repeated != 1 {
+		return fmt.Errorf("exactly one digit is repeated in a German tax ID")
+	}
+	product := 10
+	for i := 0; i < 10; i++ {
+		sum := (int(s[i]-'0') + product) % 10
+		if sum == 0 {
+			sum = 10
+		}
+		product = sum * 2 % 11
+	}
+	check := 11 - product
+	if check == 10 {
+		check = 0
+	}
+	if int(s[10]-'0') != check {
+		return fmt.Errorf("wrong check digit")
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package validate
+
+import "testing"
+
+func TestNational(t *testing.T) {
+	tests := []struct {
+		name  string
+		check Validator
+		value string
+		valid bool
+	}{
+		{"NIR", NIR, "269054958815780", true},
+		{"NIR with spaces", NIR, "2 69 05 49 588 157 80", true},
+		{"NIR born in 2A", NIR, "1 85 05 2A 123 456 33", true},
+		{"NIR born in 2B", NIR, "185052B12345660", true},
+		{"NIR in 2A with the key of 2B", NIR, "185052A12345660", false},
+		{"NIR wrong key", NIR, "269054958815781", false},
+		{"NIR too short", NIR, "26905495881578", false},
+		{"NIR wrong sex", NIR, "569054958815780", false},
+		{"NIR letters", NIR, "2690549588157AB", false},
+
+		{"DNI", DNI, "12345678Z", true},
+		{"DNI with a dash", DNI, "12345678-z", true},
+		{"DNI wrong letter", DNI, "12345678A", false},
+		{"DNI too short", DNI, "1234567Z", false},
+		{"NIE X", NIE, "X1234567L", true},
+		{"NIE Y", NIE, "Y1234567X", true},
+		{"NIE Z", NIE, "Z1234567R", true},
+		{"NIE wrong letter", NIE, "X1234567Z", false},
+		{"NIE wrong prefix", NIE, "A1234567L", false},
+
+		// Examples of the Bundeszentralamt für Steuern.
+		{"SteuerID", SteuerID, "86095742719", true},
+		{"SteuerID with spaces", SteuerID, "65 929 970 489", true},
+		{"SteuerID wrong check digit", SteuerID, "86095742718", false},
+		{"SteuerID starting with 0", SteuerID, "06095742719", false},
+		{"SteuerID without repeated digit", SteuerID, "12345678903", false},
+		{"SteuerID digit four times", SteuerID, "11112345675", false},
+		{"SteuerID too short", SteuerID, "8609574271", false},
+	}
+	for _, tt := range tests {
+		if err := tt.check(tt.value); (err == nil) != tt.valid {
+			t.Errorf("%s: %q = %v, want valid %v", tt.name, tt.value, err, tt.valid)
+		}
+	}
+}
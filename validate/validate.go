@@ -0,0 +1,116 @@
+// Package validate checks identifiers found in documents against their own rules:
+// check digits, checksums and formats, so that a value misread by a model, or mistyped,
+// is caught before it is stored.
+//
+// Validators are registered by identifier kind, like "iban" or "nir", the snake_case kinds
+// used in the metadata of b3. More can be added with Register.
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ErrUnsupported is returned when a value is in a variant of its format that cannot be checked,
+// like a national ID card with its own machine-readable zone. Such a value is not known to be invalid.
+var ErrUnsupported = errors.New("unsupported format")
+
+// Validator checks an identifier, and returns an error telling what is wrong with it.
+type Validator func(value string) error
+
+var (
+	mu         sync.RWMutex
+	validators = map[string]Validator{
+		"iban":                IBAN,
+		"card_number":         Luhn,
+		"credit_card_number":  Luhn,
+		"payment_card_number": Luhn,
+		"mrz":                 func(s string) error { _, err := ParseMRZ(s); return err },
+		"nir":                 NIR,
+		"fr_nir":              NIR,
+		"dni":                 DNI,
+		"es_dni":              DNI,
+		"nie":                 NIE,
+		"es_nie":              NIE,
+		"steuer_id":           SteuerID,
+		"de_tax_id":           SteuerID,
+	}
+)
+
+// Register adds or replaces the validator of a kind of identifier.
+func Register(kind string, v Validator) {
+	mu.Lock()
+	defer mu.Unlock()
+	validators[strings.ToLower(kind)] = v
+}
+
+// Known reports whether kind has a validator.
+func Known(kind string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := validators[strings.ToLower(kind)]
+	return ok
+}
+
+// Check validates an identifier of the given kind.
+// It returns nil when the value is valid, or when the kind has no validator.
+func Check(kind, value string) error {
+	mu.RLock()
+	v, ok := validators[strings.ToLower(kind)]
+	mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	return v(value)
+}
+
+// compact returns s without spaces, dots, dashes nor slashes, in upper case, as identifiers are often printed in groups.
+func compact(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case unicode.IsSpace(r), r == '.', r == '-', r == '/':
+		default:
+			b.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return b.String()
+}
+
+// digits reports whether s is only made of ASCII digits.
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Luhn checks a payment card number with the Luhn algorithm.
+func Luhn(value string) error {
+	s := compact(value)
+	if !digits(s) {
+		return fmt.Errorf("a card number has only digits")
+	}
+	if len(s) < 12 || len(s) > 19 {
+		return fmt.Errorf("a card number has 12 to 19 digits, not %d", len(s))
+	}
+	sum := 0
+	for i := 0; i < len(s); i++ {
+		d := int(s[len(s)-1-i] - '0')
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	if sum%10 != 0 {
+		return fmt.Errorf("wrong check digit")
+	}
+	return nil
+}
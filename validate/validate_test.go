@@ -0,0 +1,63 @@
+package validate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLuhn(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"4111 1111 1111 1111", true},
+		{"4012888888881881", true},
+		{"378282246310005", true},     // American Express, 15 digits.
+		{"5555-5555-5555-4444", true}, // Mastercard.
+		{"4111111111111112", false},
+		{"4111 1111 1111 111a", false},
+		{"79927398713", false}, // Valid Luhn number, but too short for a card.
+		{"", false},
+	}
+	for _, tt := range tests {
+		if err := Luhn(tt.value); (err == nil) != tt.valid {
+			t.Errorf("Luhn(%q) = %v, want valid %v", tt.value, err, tt.valid)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		kind, value string
+		valid       bool
+	}{
+		{"iban", "FR76 3000 6000 0112 3456 7890 189", true},
+		{"IBAN", "FR76 3000 6000 0112 3456 7890 188", false},
+		{"card_number", "4111111111111111", true},
+		{"nir", "2 69 05 49 588 157 80", true},
+		{"es_nie", "X1234567L", true},
+		{"de_tax_id", "86095742719", true},
+		{"passport_number", "anything", true}, // No validator.
+	}
+	for _, tt := range tests {
+		if err := Check(tt.kind, tt.value); (err == nil) != tt.valid {
+			t.Errorf("Check(%q, %q) = %v, want valid %v", tt.kind, tt.value, err, tt.valid)
+		}
+	}
+	if err := Check("mrz", "IDFRADOUEL<<<<<<<<<<<<<<<<<<<<932013\n0506932020438CHRISTIANE<<NI2906209F3"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Check(mrz, French ID card) = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	if Known("test_kind") {
+		t.Fatal("Known(test_kind) before Register")
+	}
+	Register("Test_Kind", func(string) error { return errors.New("always wrong") })
+	if !Known("test_kind") {
+		t.Error("Known(test_kind) = false after Register")
+	}
+	if err := Check("TEST_KIND", "x"); err == nil {
+		t.Error("Check(TEST_KIND) = nil, want the registered validator to be used")
+	}
+}